@@ -0,0 +1,263 @@
+package api
+
+import "fmt"
+import "sort"
+import "bytes"
+import "errors"
+import "strings"
+import "net/url"
+import "net/http"
+import "text/template"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
+
+// AdvisorySeverities maps advisory severities to message severities
+var AdvisorySeverities = map[string]string{
+	"low":      "info",
+	"medium":   "warning",
+	"high":     "critical",
+	"critical": "critical",
+}
+
+// Advisory is a security advisory descriptor listing affected components
+type Advisory struct {
+	Id                string             `json:"id"`
+	Title             string             `json:"title"`
+	Severity          string             `json:"severity"`
+	Description       string             `json:"description"`
+	Url               string             `json:"url"`
+	BuildPackVersions []BuildpackVersion `json:"buildpack_versions"`
+	Stacks            []string           `json:"stacks"`
+	Plans             []string           `json:"service_plans"`
+}
+
+// AdvisorySpace lists resources of a space affected by an advisory
+type AdvisorySpace struct {
+	Org       string   `json:"org"`
+	Space     string   `json:"space"`
+	Apps      []string `json:"apps"`
+	Instances []string `json:"service_instances"`
+}
+
+// AdvisoryResponse --
+type AdvisoryResponse struct {
+	Draft  *Draft          `json:"draft"`
+	Spaces []AdvisorySpace `json:"spaces"`
+}
+
+var advisoryTpl = template.Must(template.New("advisory").Parse(
+	`**Security advisory {{ .Id }}**{{ if .Severity }}, severity *{{ .Severity }}*{{ end }}
+
+{{ if .Description }}{{ .Description }}
+
+{{ end }}Affected components:
+{{ range .Components }}
+- {{ . }}
+{{- end }}
+{{ if .Url }}
+More information: <{{ .Url }}>
+{{ end }}`))
+
+func (m *MessageHandler) registerAdvisories(pRouter *mux.Router) {
+	pRouter.Path("/v1/advisories").
+		HandlerFunc(core.DecorateHandler(m.handleAdvisory)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+}
+
+// check validates advisory and returns matching message severity
+func (s *Advisory) check() (string, error) {
+	if "" == s.Id {
+		return "", errors.New("missing advisory id")
+	}
+	if 0 == len(s.BuildPackVersions) && 0 == len(s.Stacks) && 0 == len(s.Plans) {
+		return "", errors.New("advisory must list affected buildpack_versions, stacks or service_plans")
+	}
+
+	severity := strings.ToLower(s.Severity)
+	if val, ok := AdvisorySeverities[severity]; ok {
+		return val, nil
+	}
+	if "" == severity || cfmail.IsSeverity(severity) {
+		return severity, nil
+	}
+	return "", fmt.Errorf("invalid advisory severity '%s', must be one of low, medium, high, critical", s.Severity)
+}
+
+// subject returns message subject of advisory
+func (s *Advisory) subject() string {
+	if "" == s.Title {
+		return fmt.Sprintf("[%s] Security advisory", s.Id)
+	}
+	return fmt.Sprintf("[%s] %s", s.Id, s.Title)
+}
+
+// components returns readable names of affected components, stacks and
+// plans being named by their guid when they can't be resolved
+func (m *MessageReqCtx) advisoryComponents(pAdv *Advisory) []string {
+	res := []string{}
+	for _, cBp := range pAdv.BuildPackVersions {
+		if "" == cBp.Version {
+			res = append(res, fmt.Sprintf("buildpack `%s`", cBp.Name))
+		} else {
+			res = append(res, fmt.Sprintf("buildpack `%s` version `%s`", cBp.Name, cBp.Version))
+		}
+	}
+
+	if 0 != len(pAdv.Stacks) {
+		names := map[string]string{}
+		stacks, err := m.CCCli.ListStacks()
+		if err != nil {
+			log.WithError(err).Warn("unable to read stack names")
+		}
+		for _, cStack := range stacks {
+			names[cStack.Guid] = cStack.Name
+		}
+		for _, cID := range pAdv.Stacks {
+			name, ok := names[cID]
+			if !ok {
+				name = cID
+			}
+			res = append(res, fmt.Sprintf("stack `%s`", name))
+		}
+	}
+
+	if 0 != len(pAdv.Plans) {
+		names := map[string]string{}
+		for _, cChunk := range splitParams(pAdv.Plans, m.NbMaxGetParams) {
+			query := url.Values{}
+			query.Add("q", fmt.Sprintf("guid IN %s", strings.Join(cChunk, ",")))
+			plans, err := m.CCCli.ListServicePlansByQuery(query)
+			if err != nil {
+				log.WithError(err).Warn("unable to read service plan names")
+				break
+			}
+			for _, cPlan := range plans {
+				names[cPlan.Guid] = cPlan.Name
+			}
+		}
+		for _, cID := range pAdv.Plans {
+			name, ok := names[cID]
+			if !ok {
+				name = cID
+			}
+			res = append(res, fmt.Sprintf("service plan `%s`", name))
+		}
+	}
+	return res
+}
+
+// advisoryBody renders markdown body of advisory message, resources of
+// each recipient being listed below it by the impact table
+func (m *MessageReqCtx) advisoryBody(pAdv *Advisory, pSeverity string) string {
+	data := struct {
+		Id          string
+		Severity    string
+		Description string
+		Url         string
+		Components  []string
+	}{pAdv.Id, pSeverity, pAdv.Description, pAdv.Url, m.advisoryComponents(pAdv)}
+
+	buf := bytes.Buffer{}
+	if err := advisoryTpl.Execute(&buf, data); err != nil {
+		panic(core.NewHttpError(err, 500, 55))
+	}
+	return buf.String()
+}
+
+// advisorySpaces returns affected resources grouped by space, sorted by
+// organization and space names
+func (m *MessageReqCtx) advisorySpaces() []AdvisorySpace {
+	res := []AdvisorySpace{}
+	for _, cImpacts := range m.impacts {
+		if 0 == len(cImpacts) {
+			continue
+		}
+		space := AdvisorySpace{
+			Org:       cImpacts[0].Org,
+			Space:     cImpacts[0].Space,
+			Apps:      []string{},
+			Instances: []string{},
+		}
+		for _, cImpact := range cImpacts {
+			if "application" == cImpact.Kind {
+				space.Apps = append(space.Apps, cImpact.Name)
+			} else {
+				space.Instances = append(space.Instances, cImpact.Name)
+			}
+		}
+		res = append(res, space)
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		if res[pI].Org != res[pJ].Org {
+			return res[pI].Org < res[pJ].Org
+		}
+		return res[pI].Space < res[pJ].Space
+	})
+	return res
+}
+
+// handleAdvisory resolves resources affected by an advisory and creates a
+// pending draft of the security message to send to their owners
+func (m *MessageHandler) handleAdvisory(pRes http.ResponseWriter, pReq *http.Request) {
+	getCaller(m.UaaCli, pReq)
+
+	adv := Advisory{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&adv); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	severity, err := adv.check()
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	users, phones, err := m.getUaaUsers()
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 51))
+	}
+
+	data := MessageRequest{
+		RecipientsRequest: RecipientsRequest{
+			BuildPackVersions: adv.BuildPackVersions,
+			Stacks:            adv.Stacks,
+			Plans:             adv.Plans,
+		},
+		Subject:  adv.subject(),
+		Severity: severity,
+		Category: "security",
+	}
+	ctx, err := m.buildCtx(users, phones, pReq, data)
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 10))
+	}
+
+	ctx.ReqData.Message = ctx.advisoryBody(&adv, severity)
+	ctx.setBody(ctx.ReqData.Message)
+	m.readRecipients(ctx)
+
+	res := AdvisoryResponse{Spaces: ctx.advisorySpaces()}
+	if 0 == len(res.Spaces) {
+		log.WithFields(log.Fields{"advisory": adv.Id}).
+			Info("no resource affected by advisory")
+		core.WriteJson(pRes, res)
+		return
+	}
+
+	entry := m.newAudit(pReq, ctx, AuditMessage)
+	draft := m.createDraft(entry, ctx).public()
+	res.Draft = &draft
+	log.WithFields(log.Fields{
+		"advisory": adv.Id,
+		"draft":    res.Draft.Id,
+		"spaces":   len(res.Spaces),
+	}).Info("draft created from advisory")
+	core.WriteJsonStatus(pRes, 201, res)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,50 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Advisory", func() {
+	lStacks := []string{"7d2ef1a5-d5b2-4b8c-9d5d-4c5c3b2a7c11"}
+
+	lInvalid := []struct {
+		Name     string
+		Advisory Advisory
+	}{
+		{"without id", Advisory{Stacks: lStacks}},
+		{"without affected components", Advisory{Id: "CVE-2024-1234"}},
+		{"with unknown severity", Advisory{Id: "CVE-2024-1234", Stacks: lStacks, Severity: "urgent"}},
+	}
+
+	for _, cCase := range lInvalid {
+		lCase := cCase
+		It("rejects advisories "+lCase.Name, func() {
+			_, err := lCase.Advisory.Check()
+			Expect(err).NotTo(BeNil())
+		})
+	}
+
+	lSeverities := []struct {
+		Severity string
+		Expected string
+	}{
+		{"", ""},
+		{"low", "info"},
+		{"Medium", "warning"},
+		{"high", "critical"},
+		{"critical", "critical"},
+		{"warning", "warning"},
+	}
+
+	for _, cCase := range lSeverities {
+		lCase := cCase
+		It("maps severity '"+lCase.Severity+"' to message severity", func() {
+			lAdv := Advisory{Id: "CVE-2024-1234", Stacks: lStacks, Severity: lCase.Severity}
+			severity, err := lAdv.Check()
+			Expect(err).To(BeNil())
+			Expect(severity).To(Equal(lCase.Expected))
+		})
+	}
+})
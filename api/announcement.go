@@ -0,0 +1,231 @@
+package api
+
+import "sort"
+import "time"
+import "errors"
+import "net/http"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
+
+// Announcement is a sent message displayed as a banner during its display
+// window
+type Announcement struct {
+	Id       string    `json:"id"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Severity string    `json:"severity,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+func (m *MessageHandler) registerAnnouncements(pRouter *mux.Router) {
+	pRouter.Path("/v1/announcements").
+		HandlerFunc(core.DecorateHandler(m.handleAnnouncements)).
+		Methods("GET")
+
+	pRouter.Path("/v1/announcements").
+		HandlerFunc(core.DecorateHandler(m.handleAnnouncementsOptions)).
+		Methods("OPTIONS")
+}
+
+// setDisplay validates display window of message, start being optional
+func (m *MessageReqCtx) setDisplay(pStart *time.Time, pEnd *time.Time) {
+	if pEnd == nil {
+		if pStart != nil {
+			err := errors.New("display_start requires display_end")
+			panic(core.NewHttpError(err, 400, 40))
+		}
+		return
+	}
+	if pEnd.Before(time.Now()) {
+		err := errors.New("display_end must be in the future")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	if pStart != nil && !pStart.Before(*pEnd) {
+		err := errors.New("display_start must be before display_end")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+}
+
+// displayWindow returns display window of entry, starting when message was
+// sent unless given
+func (s *AuditEntry) displayWindow() (time.Time, time.Time, bool) {
+	if s.Request.DisplayEnd == nil || s.Sent == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start := *s.Sent
+	if s.Request.DisplayStart != nil {
+		start = *s.Request.DisplayStart
+	}
+	return start, *s.Request.DisplayEnd, true
+}
+
+// visibleTo returns true when entry targeted given user, directly or
+// through one of given orgs and spaces
+func (s *AuditEntry) visibleTo(pUserID string, pOrgs map[string]bool, pSpaces map[string]bool) bool {
+	if AuditMessageAll == s.Kind || contains(s.Request.Users, pUserID) {
+		return true
+	}
+	for _, cID := range s.Request.Orgs {
+		if pOrgs[cID] {
+			return true
+		}
+	}
+	spaces := s.Spaces
+	if 0 == len(spaces) {
+		spaces = s.Request.Spaces
+	}
+	for _, cID := range spaces {
+		if pSpaces[cID] {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeCacheDelay is the duration orgs and spaces visible to a user are
+// cached for
+const scopeCacheDelay = time.Minute
+
+// callerScopes are orgs and spaces visible to a user
+type callerScopes struct {
+	orgs    map[string]bool
+	spaces  map[string]bool
+	expires time.Time
+}
+
+func (m *MessageHandler) createCli(pReq *http.Request) core.CFClient {
+	cli, err := core.NewCCCliFromRequest(m.Config.CCEndPoint, pReq, m.Config.CCSkipVerify)
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 10))
+	}
+	return cli
+}
+
+// getCallerScopes returns orgs and spaces visible to given caller, read
+// with request token and cached for scopeCacheDelay
+func (m *MessageHandler) getCallerScopes(pReq *http.Request, pUserID string) (map[string]bool, map[string]bool) {
+	now := time.Now()
+	m.slock.Lock()
+	cached, ok := m.scopes[pUserID]
+	m.slock.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.orgs, cached.spaces
+	}
+
+	orgs, spaces := m.readCallerScopes(pReq)
+
+	m.slock.Lock()
+	for cID, cScopes := range m.scopes {
+		if !now.Before(cScopes.expires) {
+			delete(m.scopes, cID)
+		}
+	}
+	m.scopes[pUserID] = &callerScopes{orgs, spaces, now.Add(scopeCacheDelay)}
+	m.slock.Unlock()
+	return orgs, spaces
+}
+
+// readCallerScopes returns orgs and spaces visible with request token
+func (m *MessageHandler) readCallerScopes(pReq *http.Request) (map[string]bool, map[string]bool) {
+	cli := m.CCCreator(pReq)
+	orgs, err := cli.ListOrgs()
+	if err != nil {
+		log.WithError(err).Error("unable to fetch organizations from CC api")
+		panic(core.NewHttpError(err, 500, 50))
+	}
+	spaces, err := cli.ListSpaces()
+	if err != nil {
+		log.WithError(err).Error("unable to fetch spaces from CC api")
+		panic(core.NewHttpError(err, 500, 50))
+	}
+
+	resOrgs := make(map[string]bool, len(orgs))
+	for _, cOrg := range orgs {
+		resOrgs[cOrg.Guid] = true
+	}
+	resSpaces := make(map[string]bool, len(spaces))
+	for _, cSpace := range spaces {
+		resSpaces[cSpace.Guid] = true
+	}
+	return resOrgs, resSpaces
+}
+
+// severityRank orders severities, most severe first
+func severityRank(pSeverity string) int {
+	for cIdx, cVal := range cfmail.Severities {
+		if cVal == pSeverity {
+			return len(cfmail.Severities) - cIdx
+		}
+	}
+	return 0
+}
+
+// setCors allows configured origins to embed announcements
+func (m *MessageHandler) setCors(pRes http.ResponseWriter, pReq *http.Request) {
+	origin := pReq.Header.Get("Origin")
+	if "" == origin {
+		return
+	}
+	if !contains(m.Config.CorsOrigins, origin) && !contains(m.Config.CorsOrigins, "*") {
+		return
+	}
+	pRes.Header().Set("Access-Control-Allow-Origin", origin)
+	pRes.Header().Set("Access-Control-Allow-Headers", "Authorization")
+	pRes.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	pRes.Header().Add("Vary", "Origin")
+}
+
+func (m *MessageHandler) handleAnnouncementsOptions(pRes http.ResponseWriter, pReq *http.Request) {
+	m.setCors(pRes, pReq)
+	pRes.WriteHeader(204)
+}
+
+func (m *MessageHandler) handleAnnouncements(pRes http.ResponseWriter, pReq *http.Request) {
+	m.setCors(pRes, pReq)
+	caller := getCaller(m.UaaCli, pReq)
+
+	now := time.Now()
+	var orgs, spaces map[string]bool
+	res := []Announcement{}
+	for _, cEntry := range m.listAudit(AuditFilter{}) {
+		if AuditTest == cEntry.Kind || AuditSent != cEntry.Outcome {
+			continue
+		}
+		start, end, ok := cEntry.displayWindow()
+		if !ok || now.Before(start) || !now.Before(end) {
+			continue
+		}
+		if !cEntry.visibleTo(caller.Id, orgs, spaces) {
+			// scopes are only read when an announcement targets orgs or spaces
+			if orgs != nil {
+				continue
+			}
+			orgs, spaces = m.getCallerScopes(pReq, caller.Id)
+			if !cEntry.visibleTo(caller.Id, orgs, spaces) {
+				continue
+			}
+		}
+		res = append(res, Announcement{
+			Id:       cEntry.Id,
+			Subject:  cEntry.Subject,
+			Message:  m.feedBody(&cEntry),
+			Severity: cEntry.Request.Severity,
+			Category: cEntry.Request.Category,
+			Start:    start,
+			End:      end,
+		})
+	}
+
+	sort.SliceStable(res, func(pI, pJ int) bool {
+		return severityRank(res[pI].Severity) > severityRank(res[pJ].Severity)
+	})
+	core.WriteJson(pRes, res)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
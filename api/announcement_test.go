@@ -0,0 +1,193 @@
+package api_test
+
+import (
+	"os"
+	"time"
+	"io/ioutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	"github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingCli counts organization listings
+type countingCli struct {
+	FakeCli
+	orgCalls int
+}
+
+func (self *countingCli) ListOrgs() ([]cfclient.Org, error) {
+	self.orgCalls++
+	return self.FakeCli.ListOrgs()
+}
+
+var _ = Describe("Announcement", func() {
+	lNow := time.Now()
+	lPast := lNow.Add(-time.Hour)
+	lFuture := lNow.Add(time.Hour)
+	lLater := lNow.Add(2 * time.Hour)
+
+	lDisplays := []struct {
+		Name  string
+		Start *time.Time
+		End   *time.Time
+		Valid bool
+	}{
+		{"without window", nil, nil, true},
+		{"with end only", nil, &lFuture, true},
+		{"with start and end", &lFuture, &lLater, true},
+		{"with start only", &lFuture, nil, false},
+		{"with past end", nil, &lPast, false},
+		{"with start after end", &lLater, &lFuture, false},
+		{"with start at end", &lFuture, &lFuture, false},
+	}
+
+	for _, cCase := range lDisplays {
+		lCase := cCase
+		It("validates display "+lCase.Name, func() {
+			lCtx := NewTargetCtx(&FakeCli{})
+			lSet := func() { lCtx.SetDisplay(lCase.Start, lCase.End) }
+			if lCase.Valid {
+				Expect(lSet).NotTo(Panic())
+			} else {
+				Expect(lSet).To(Panic())
+			}
+		})
+	}
+
+	It("displays messages from their sending", func() {
+		lEntry := AuditEntry{Sent: &lPast}
+		lEntry.Request.DisplayEnd = &lFuture
+		lStart, lEnd, lOk := lEntry.DisplayWindow()
+		Expect(lOk).To(BeTrue())
+		Expect(lStart).To(Equal(lPast))
+		Expect(lEnd).To(Equal(lFuture))
+	})
+
+	It("displays messages from their display start", func() {
+		lEntry := AuditEntry{Sent: &lPast}
+		lEntry.Request.DisplayStart = &lFuture
+		lEntry.Request.DisplayEnd = &lLater
+		lStart, _, lOk := lEntry.DisplayWindow()
+		Expect(lOk).To(BeTrue())
+		Expect(lStart).To(Equal(lFuture))
+	})
+
+	It("does not display unsent messages or messages without end", func() {
+		lUnsent := AuditEntry{}
+		lUnsent.Request.DisplayEnd = &lFuture
+		_, _, lOk := lUnsent.DisplayWindow()
+		Expect(lOk).To(BeFalse())
+		_, _, lOk = (&AuditEntry{Sent: &lPast}).DisplayWindow()
+		Expect(lOk).To(BeFalse())
+	})
+
+	lOrgs := map[string]bool{"org-1": true}
+	lSpaces := map[string]bool{"space-1": true}
+	lVisible := []struct {
+		Name    string
+		Entry   AuditEntry
+		Visible bool
+	}{
+		{"to all users", AuditEntry{Kind: AuditMessageAll}, true},
+		{"to user", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Users: []string{"user-a"}}}}, true},
+		{"to other user", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Users: []string{"user-b"}}}}, false},
+		{"to org", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Orgs: []string{"org-1"}}}}, true},
+		{"to other org", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Orgs: []string{"org-2"}}}}, false},
+		{"to space", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Spaces: []string{"space-1"}}}}, true},
+		{"to resolved space", AuditEntry{Spaces: []string{"space-1"}}, true},
+		{"to other resolved space", AuditEntry{Spaces: []string{"space-2"}, Request: MessageRequest{RecipientsRequest: RecipientsRequest{Spaces: []string{"space-1"}}}}, false},
+	}
+
+	for _, cCase := range lVisible {
+		lCase := cCase
+		It("checks visibility of messages sent "+lCase.Name, func() {
+			Expect(lCase.Entry.VisibleTo("user-a", lOrgs, lSpaces)).To(Equal(lCase.Visible))
+		})
+	}
+
+	Context("Listing", func() {
+		var lDir string
+		var lServer *httptest.Server
+		var lHandler *MessageHandler
+		var lCli *countingCli
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-announcement")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+
+			var lUaa *core.UaaCli
+			lUaa, lServer = newFakeUaa(map[string]fakeUser{
+				"token-a": fakeUser{Info: core.UaaUserInfo{Id: "user-a", UserName: "alice"}},
+			})
+			lCli = &countingCli{}
+			lHandler = NewTestHandler(lUaa, lStore, &core.AppConfig{})
+			lHandler.CCCreator = func(*http.Request) core.CFClient {
+				return lCli
+			}
+		})
+
+		AfterEach(func() {
+			lServer.Close()
+			os.RemoveAll(lDir)
+		})
+
+		lSave := func(pID string, pKind string, pOrgs []string, pStart *time.Time, pEnd *time.Time) {
+			lEntry := AuditEntry{
+				Id:      pID,
+				Kind:    pKind,
+				Created: lPast,
+				Sent:    &lPast,
+				Outcome: AuditSent,
+			}
+			lEntry.Request.Orgs = pOrgs
+			lEntry.Request.DisplayStart = pStart
+			lEntry.Request.DisplayEnd = pEnd
+			lHandler.SaveAudit(&lEntry)
+		}
+
+		lList := func() []string {
+			lRes := httptest.NewRecorder()
+			lHandler.HandleAnnouncements()(lRes, authRequest("GET", "/v1/announcements", "token-a", ""))
+			Expect(lRes.Code).To(Equal(200))
+			lItems := []Announcement{}
+			Expect(json.NewDecoder(lRes.Body).Decode(&lItems)).To(BeNil())
+			lIds := []string{}
+			for _, cItem := range lItems {
+				lIds = append(lIds, cItem.Id)
+			}
+			return lIds
+		}
+
+		It("lists displayed announcements visible to caller", func() {
+			lSave("all", AuditMessageAll, nil, nil, &lFuture)
+			lSave("org", AuditMessage, []string{"ddddb760-ef75-40f4-9d52-1bb557b61af8"}, nil, &lFuture)
+			lSave("other-org", AuditMessage, []string{"unknown-org"}, nil, &lFuture)
+			lSave("upcoming", AuditMessageAll, nil, &lFuture, &lLater)
+			lSave("test", AuditTest, nil, nil, &lFuture)
+			lSave("permanent", AuditMessageAll, nil, nil, nil)
+			Expect(lList()).To(ConsistOf("all", "org"))
+		})
+
+		It("caches orgs and spaces of caller", func() {
+			lSave("org", AuditMessage, []string{"ddddb760-ef75-40f4-9d52-1bb557b61af8"}, nil, &lFuture)
+			Expect(lList()).To(HaveLen(1))
+			Expect(lList()).To(HaveLen(1))
+			Expect(lCli.orgCalls).To(Equal(1))
+		})
+
+		It("does not read orgs and spaces of caller when not needed", func() {
+			lSave("all", AuditMessageAll, nil, nil, &lFuture)
+			lSave("expired", AuditMessage, []string{"ddddb760-ef75-40f4-9d52-1bb557b61af8"}, nil, &lPast)
+			Expect(lList()).To(Equal([]string{"all"}))
+			Expect(lCli.orgCalls).To(Equal(0))
+		})
+	})
+})
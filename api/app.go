@@ -0,0 +1,122 @@
+package api
+
+import "fmt"
+import "time"
+import "errors"
+import "regexp"
+import "github.com/cloudfoundry-community/go-cfclient"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// AppStates lists application states usable in filters
+var AppStates = []string{"STARTED", "STOPPED"}
+
+// AppLifecycles lists application lifecycles usable in filters
+var AppLifecycles = []string{"buildpack", "docker"}
+
+// AppFilter selects applications by their attributes, applications having
+// to match all given criteria
+type AppFilter struct {
+	State           string `json:"state,omitempty"`
+	Lifecycle       string `json:"lifecycle,omitempty"`
+	Name            string `json:"name,omitempty"`
+	MinInstances    int    `json:"min_instances,omitempty"`
+	MinMemory       int    `json:"min_memory,omitempty"`
+	NotPushedMonths int    `json:"not_pushed_months,omitempty"`
+
+	name   *regexp.Regexp
+	pushed time.Time
+}
+
+// check validates filter criteria and prepares their evaluation
+func (s *AppFilter) check() error {
+	if "" == s.State && "" == s.Lifecycle && "" == s.Name &&
+		0 == s.MinInstances && 0 == s.MinMemory && 0 == s.NotPushedMonths {
+		return errors.New("apps filter requires at least one criterion")
+	}
+	if "" != s.State && !contains(AppStates, s.State) {
+		return fmt.Errorf("invalid apps state '%s', must be one of STARTED, STOPPED", s.State)
+	}
+	if "" != s.Lifecycle && !contains(AppLifecycles, s.Lifecycle) {
+		return fmt.Errorf("invalid apps lifecycle '%s', must be one of buildpack, docker", s.Lifecycle)
+	}
+	if s.MinInstances < 0 || s.MinMemory < 0 || s.NotPushedMonths < 0 {
+		return errors.New("apps filter thresholds must be positive")
+	}
+	if "" != s.Name {
+		re, err := regexp.Compile(s.Name)
+		if err != nil {
+			return fmt.Errorf("invalid apps name regexp '%s'", s.Name)
+		}
+		s.name = re
+	}
+	if 0 != s.NotPushedMonths {
+		s.pushed = time.Now().AddDate(0, -s.NotPushedMonths, 0)
+	}
+	return nil
+}
+
+// lastPush returns date application bits were last uploaded, falling back
+// to its creation date
+func lastPush(pApp *cfclient.App) (time.Time, bool) {
+	date := pApp.PackageUpdatedAt
+	if "" == date {
+		date = pApp.CreatedAt
+	}
+	res, err := time.Parse(time.RFC3339, date)
+	return res, nil == err
+}
+
+// match returns true when given application matches all filter criteria
+func (s *AppFilter) match(pApp *cfclient.App) bool {
+	if "" != s.State && s.State != pApp.State {
+		return false
+	}
+	if "" != s.Lifecycle {
+		docker := "" != pApp.DockerImage
+		if docker != ("docker" == s.Lifecycle) {
+			return false
+		}
+	}
+	if s.name != nil && !s.name.MatchString(pApp.Name) {
+		return false
+	}
+	if pApp.Instances < s.MinInstances || pApp.Memory < s.MinMemory {
+		return false
+	}
+	if 0 != s.NotPushedMonths {
+		pushed, ok := lastPush(pApp)
+		if !ok || !pushed.Before(s.pushed) {
+			return false
+		}
+	}
+	return true
+}
+
+// setAppFilter validates application filter of request
+func (m *MessageReqCtx) setAppFilter(pFilter *AppFilter) {
+	if pFilter == nil {
+		return
+	}
+	if err := pFilter.check(); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+}
+
+// addApps targets spaces of applications matching given filter
+func (m *MessageReqCtx) addApps(pFilter *AppFilter) {
+	if pFilter == nil {
+		return
+	}
+
+	m.mapApps(func(pApp *cfclient.App) {
+		if pFilter.match(pApp) {
+			m.ResData.MatchedApps++
+			m.addSpace(pApp.SpaceGuid)
+			m.addImpact(pApp.SpaceGuid, "application", pApp.Name)
+		}
+	})
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
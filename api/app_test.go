@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"time"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/cloudfoundry-community/go-cfclient"
+)
+
+var _ = Describe("AppFilter", func() {
+	lInvalid := []struct {
+		Name   string
+		Filter AppFilter
+	}{
+		{"without criterion", AppFilter{}},
+		{"with unknown state", AppFilter{State: "CRASHED"}},
+		{"with unknown lifecycle", AppFilter{Lifecycle: "cnb"}},
+		{"with negative threshold", AppFilter{MinInstances: -1}},
+		{"with invalid name regexp", AppFilter{Name: "app-("}},
+	}
+
+	for _, cCase := range lInvalid {
+		lCase := cCase
+		It("rejects filters "+lCase.Name, func() {
+			Expect(lCase.Filter.Check()).NotTo(BeNil())
+		})
+	}
+
+	lOld := time.Now().AddDate(-1, 0, 0).Format(time.RFC3339)
+	lRecent := time.Now().AddDate(0, 0, -1).Format(time.RFC3339)
+	lApp := cfclient.App{
+		Name:             "billing-api",
+		State:            "STARTED",
+		Instances:        3,
+		Memory:           1024,
+		PackageUpdatedAt: lOld,
+	}
+	lDocker := cfclient.App{
+		Name:        "billing-worker",
+		State:       "STOPPED",
+		Instances:   1,
+		Memory:      256,
+		DockerImage: "acme/worker:latest",
+		CreatedAt:   lRecent,
+	}
+
+	lCases := []struct {
+		Name   string
+		Filter AppFilter
+		App    cfclient.App
+		Match  bool
+	}{
+		{"state", AppFilter{State: "STARTED"}, lApp, true},
+		{"other state", AppFilter{State: "STOPPED"}, lApp, false},
+		{"buildpack lifecycle", AppFilter{Lifecycle: "buildpack"}, lApp, true},
+		{"docker lifecycle", AppFilter{Lifecycle: "docker"}, lDocker, true},
+		{"other lifecycle", AppFilter{Lifecycle: "docker"}, lApp, false},
+		{"name regexp", AppFilter{Name: "^billing-"}, lDocker, true},
+		{"other name", AppFilter{Name: "^orders-"}, lApp, false},
+		{"min instances", AppFilter{MinInstances: 3}, lApp, true},
+		{"too few instances", AppFilter{MinInstances: 2}, lDocker, false},
+		{"min memory", AppFilter{MinMemory: 512}, lApp, true},
+		{"too little memory", AppFilter{MinMemory: 512}, lDocker, false},
+		{"old push", AppFilter{NotPushedMonths: 6}, lApp, true},
+		{"recent creation without push", AppFilter{NotPushedMonths: 6}, lDocker, false},
+		{"all criteria", AppFilter{State: "STARTED", Name: "api$", MinInstances: 2}, lApp, true},
+		{"some criteria", AppFilter{State: "STARTED", Name: "worker$"}, lApp, false},
+	}
+
+	for _, cCase := range lCases {
+		lCase := cCase
+		It("matches "+lCase.Name, func() {
+			Expect(lCase.Filter.Check()).To(BeNil())
+			Expect(lCase.Filter.Match(&lCase.App)).To(Equal(lCase.Match))
+		})
+	}
+})
@@ -0,0 +1,368 @@
+package api
+
+import "fmt"
+import "sort"
+import "time"
+import "strings"
+import "net/http"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import "gopkg.in/gomail.v2"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+const auditCollection = "audit"
+
+// deliverySaveDelay is the minimum delay between two saves of the delivery
+// statistics of a message being sent
+const deliverySaveDelay = 10 * time.Second
+
+// pruneInterval is the delay between two removals of expired records
+const pruneInterval = 24 * time.Hour
+
+// Audit entry kinds
+const (
+	AuditMessage    = "message"
+	AuditMessageAll = "message_all"
+	AuditTest       = "test"
+)
+
+// Audit entry outcomes
+const (
+	AuditPending  = "pending"
+	AuditSent     = "sent"
+	AuditRejected = "rejected"
+	AuditFailed   = "failed"
+)
+
+// AuditEntry records a message submission, from its request to its outcome
+type AuditEntry struct {
+	Id       string         `json:"id"`
+	Kind     string         `json:"kind"`
+	User     string         `json:"user"`
+	UserId   string         `json:"user_id"`
+	Email    string         `json:"email"`
+	Request  MessageRequest `json:"request"`
+	Subject  string         `json:"subject"`
+	Count    int            `json:"count"`
+	Created  time.Time      `json:"created"`
+	Sent     *time.Time     `json:"sent,omitempty"`
+	Outcome  string         `json:"outcome"`
+	Error    string         `json:"error,omitempty"`
+	DraftId  string         `json:"draft_id,omitempty"`
+	Reviewer string         `json:"reviewer,omitempty"`
+	Orgs     []string       `json:"orgs,omitempty"`
+	Spaces   []string       `json:"spaces,omitempty"`
+
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+}
+
+// delivery counts send results of an audited message
+type delivery struct {
+	count     int
+	delivered int
+	failed    int
+	saved     time.Time
+}
+
+// AuditFilter --
+type AuditFilter struct {
+	From   time.Time
+	To     time.Time
+	Sender string
+	Target string
+	UserId string
+}
+
+func (m *MessageHandler) registerAudit(pRouter *mux.Router) {
+	pRouter.Path("/v1/audit").
+		HandlerFunc(core.DecorateHandler(m.handleAudit)).
+		Methods("GET")
+}
+
+// newAudit creates audit entry of given message submitted by request caller
+func (m *MessageHandler) newAudit(pReq *http.Request, pCtx *MessageReqCtx, pKind string) *AuditEntry {
+	caller := getCaller(m.UaaCli, pReq)
+	return &AuditEntry{
+		Id:      core.NewId(),
+		Kind:    pKind,
+		User:    caller.UserName,
+		UserId:  caller.Id,
+		Email:   caller.Email,
+		Request: pCtx.ReqData,
+		Subject: pCtx.ResData.Subject,
+		Count:   len(pCtx.ResData.Recipients),
+		Orgs:    pCtx.ResData.Orgs,
+		Spaces:  pCtx.ResData.Spaces,
+		Created: time.Now(),
+		Outcome: AuditPending,
+	}
+}
+
+func (m *MessageHandler) saveAudit(pEntry *AuditEntry) {
+	m.audits.Lock()
+	defer m.audits.Unlock()
+	if err := m.Store.Put(auditCollection, pEntry.Id, pEntry); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"audit": pEntry.Id,
+		}).Error("unable to save audit entry")
+		panic(core.NewHttpError(err, 500, 54))
+	}
+}
+
+func (m *MessageHandler) getAudit(pID string) *AuditEntry {
+	entry := AuditEntry{}
+	found, err := m.Store.Get(auditCollection, pID, &entry)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	if !found {
+		err := fmt.Errorf("unknown audit entry '%s'", pID)
+		panic(core.NewHttpError(err, 404, 41))
+	}
+	return &entry
+}
+
+// updateAudit applies given change to stored audit entry
+func (m *MessageHandler) updateAudit(pID string, pChange func(*AuditEntry)) error {
+	m.audits.Lock()
+	defer m.audits.Unlock()
+
+	entry := AuditEntry{}
+	found, err := m.Store.Get(auditCollection, pID, &entry)
+	if err != nil || !found {
+		return err
+	}
+	pChange(&entry)
+	return m.Store.Put(auditCollection, pID, entry)
+}
+
+// deliver enqueues given message and records the outcome into audit entry,
+// delivery results being counted as mails are sent. Webhooks are notified
+// of all messages but tests
+func (m *MessageHandler) deliver(pEntry *AuditEntry, pData *MessageResponse) {
+	now := time.Now()
+	pEntry.Sent = &now
+	pEntry.Outcome = AuditSent
+
+	if pData.sendsOn("email") {
+		m.dlock.Lock()
+		m.deliveries[pEntry.Id] = &delivery{count: len(pData.Recipients), saved: now}
+		m.dlock.Unlock()
+	}
+	m.saveAudit(pEntry)
+
+	defer func() {
+		if err := recover(); err != nil {
+			desc := fmt.Sprintf("%v", err)
+			if httpErr, ok := err.(core.HttpError); ok {
+				desc = httpErr.Error.Error()
+			}
+			m.updateAudit(pEntry.Id, func(pStored *AuditEntry) {
+				pStored.Outcome = AuditFailed
+				pStored.Error = desc
+			})
+			panic(err)
+		}
+	}()
+
+	m.sendMessages(pData, pEntry.Id)
+	if AuditTest != pEntry.Kind && m.hooks != nil {
+		m.hooks.Notify(pEntry.Id, newWebhookPayload(pEntry, pData))
+	}
+}
+
+// trackMails records given mails as belonging to message pID until their
+// send result is known
+func (m *MessageHandler) trackMails(pID string, pMsgs []*gomail.Message) {
+	m.dlock.Lock()
+	defer m.dlock.Unlock()
+	for _, cMsg := range pMsgs {
+		m.mails[cMsg] = pID
+	}
+}
+
+// onDelivery counts send result of given mail, stored audit entry being
+// updated at most every deliverySaveDelay and once all mails are processed
+func (m *MessageHandler) onDelivery(pMsg *gomail.Message, pErr error) {
+	m.dlock.Lock()
+	id, tracked := m.mails[pMsg]
+	delete(m.mails, pMsg)
+	stats, ok := m.deliveries[id]
+	if !tracked || !ok {
+		m.dlock.Unlock()
+		return
+	}
+	if pErr != nil {
+		stats.failed += 1
+	} else {
+		stats.delivered += 1
+	}
+	done := stats.delivered+stats.failed >= stats.count
+	if done {
+		delete(m.deliveries, id)
+	}
+	save := done || time.Since(stats.saved) >= deliverySaveDelay
+	if save {
+		stats.saved = time.Now()
+	}
+	m.dlock.Unlock()
+
+	if !save {
+		return
+	}
+
+	err := m.updateAudit(id, func(pEntry *AuditEntry) {
+		pEntry.Delivered = stats.delivered
+		pEntry.Failed = stats.failed
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"audit": id,
+		}).Error("unable to save delivery statistics")
+	}
+}
+
+func parseAuditDate(pName string, pVal string) time.Time {
+	if "" == pVal {
+		return time.Time{}
+	}
+	if date, err := time.Parse(time.RFC3339, pVal); err == nil {
+		return date
+	}
+	date, err := time.Parse("2006-01-02", pVal)
+	if err != nil {
+		err := fmt.Errorf("invalid %s date '%s'", pName, pVal)
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	return date
+}
+
+func parseAuditFilter(pReq *http.Request) AuditFilter {
+	query := pReq.URL.Query()
+	res := AuditFilter{
+		From:   parseAuditDate("from", query.Get("from")),
+		To:     parseAuditDate("to", query.Get("to")),
+		Sender: query.Get("sender"),
+		Target: query.Get("target"),
+	}
+	// plain dates include the whole day
+	if 10 == len(query.Get("to")) {
+		res.To = res.To.AddDate(0, 0, 1)
+	}
+	return res
+}
+
+// targets returns all guids and addresses targeted by entry request
+func (s *AuditEntry) targets() []string {
+	res := []string{}
+	res = append(res, s.Request.Orgs...)
+	res = append(res, s.Request.Spaces...)
+	res = append(res, s.Request.Services...)
+	res = append(res, s.Request.Plans...)
+	res = append(res, s.Request.Brokers...)
+	res = append(res, s.Request.BuildPacks...)
+	res = append(res, s.Request.Stacks...)
+	res = append(res, s.Request.Users...)
+	res = append(res, s.Request.Recipients...)
+	return res
+}
+
+func (s *AuditFilter) match(pEntry *AuditEntry) bool {
+	if "" != s.UserId && s.UserId != pEntry.UserId {
+		return false
+	}
+	if !s.From.IsZero() && pEntry.Created.Before(s.From) {
+		return false
+	}
+	if !s.To.IsZero() && !pEntry.Created.Before(s.To) {
+		return false
+	}
+	if "" != s.Sender &&
+		s.Sender != pEntry.User &&
+		s.Sender != pEntry.UserId &&
+		!strings.EqualFold(s.Sender, pEntry.Email) {
+		return false
+	}
+	if "" == s.Target {
+		return true
+	}
+	if "all" == s.Target && AuditMessageAll == pEntry.Kind {
+		return true
+	}
+	for _, cTarget := range pEntry.targets() {
+		if strings.EqualFold(cTarget, s.Target) {
+			return true
+		}
+	}
+	return false
+}
+
+// listAudit returns entries matching given filter, most recent first
+func (m *MessageHandler) listAudit(pFilter AuditFilter) []AuditEntry {
+	docs, err := m.Store.List(auditCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	res := []AuditEntry{}
+	for _, cDoc := range docs {
+		entry := AuditEntry{}
+		if err := json.Unmarshal(cDoc, &entry); err != nil {
+			continue
+		}
+		if pFilter.match(&entry) {
+			res = append(res, entry)
+		}
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		return res[pI].Created.After(res[pJ].Created)
+	})
+	return res
+}
+
+// pruneAudit removes entries older than configured retention, pending
+// entries being kept until their draft is reviewed
+func (m *MessageHandler) pruneAudit() {
+	if 0 == m.Config.RetentionDays {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -m.Config.RetentionDays)
+	count, err := m.Store.Prune(auditCollection, func(pDoc json.RawMessage) bool {
+		entry := AuditEntry{}
+		if err := json.Unmarshal(pDoc, &entry); err != nil {
+			return false
+		}
+		return AuditPending != entry.Outcome && entry.Created.Before(limit)
+	})
+	if err != nil {
+		log.WithError(err).Error("unable to prune audit entries")
+		return
+	}
+	log.WithFields(log.Fields{"count": count}).Debug("pruned audit entries")
+}
+
+// schedulePruning runs given pruning function now and every pruneInterval
+func schedulePruning(pFunc func()) {
+	go func() {
+		for {
+			pFunc()
+			time.Sleep(pruneInterval)
+		}
+	}()
+}
+
+func (m *MessageHandler) handleAudit(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := getCaller(m.UaaCli, pReq)
+	filter := parseAuditFilter(pReq)
+	// entries of other users are restricted to approvers
+	if !hasScope(m.UaaCli, pReq, m.Config.ApproverScope) {
+		filter.UserId = caller.Id
+	}
+	core.WriteJson(pRes, m.listAudit(filter))
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
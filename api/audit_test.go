@@ -0,0 +1,265 @@
+package api_test
+
+import (
+	"os"
+	"time"
+	"errors"
+	"io/ioutil"
+	"encoding/json"
+	"net/http/httptest"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/gomail.v2"
+)
+
+var _ = Describe("Audit", func() {
+	lCreated := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	lEntry := AuditEntry{
+		Kind:    AuditMessage,
+		User:    "alice",
+		UserId:  "user-a",
+		Email:   "Alice@Example.com",
+		Created: lCreated,
+		Request: MessageRequest{
+			RecipientsRequest: RecipientsRequest{
+				Orgs:       []string{"org-1"},
+				Recipients: []string{"ext@example.com"},
+			},
+		},
+	}
+
+	Context("Filter", func() {
+		lCases := []struct {
+			Name   string
+			Filter AuditFilter
+			Match  bool
+		}{
+			{"without criterion", AuditFilter{}, true},
+			{"of same user", AuditFilter{UserId: "user-a"}, true},
+			{"of other user", AuditFilter{UserId: "user-b"}, false},
+			{"starting before", AuditFilter{From: lCreated.Add(-time.Hour)}, true},
+			{"starting after", AuditFilter{From: lCreated.Add(time.Hour)}, false},
+			{"ending after", AuditFilter{To: lCreated.Add(time.Hour)}, true},
+			{"ending at creation", AuditFilter{To: lCreated}, false},
+			{"of sender name", AuditFilter{Sender: "alice"}, true},
+			{"of sender guid", AuditFilter{Sender: "user-a"}, true},
+			{"of sender email in other case", AuditFilter{Sender: "alice@example.com"}, true},
+			{"of other sender", AuditFilter{Sender: "bob"}, false},
+			{"of targeted org", AuditFilter{Target: "org-1"}, true},
+			{"of recipient in other case", AuditFilter{Target: "EXT@example.com"}, true},
+			{"of other target", AuditFilter{Target: "org-2"}, false},
+			{"of all users", AuditFilter{Target: "all"}, false},
+		}
+
+		for _, cCase := range lCases {
+			lCase := cCase
+			It("filters entries "+lCase.Name, func() {
+				Expect(lCase.Filter.Match(&lEntry)).To(Equal(lCase.Match))
+			})
+		}
+
+		It("matches messages sent to all users", func() {
+			lAll := lEntry
+			lAll.Kind = AuditMessageAll
+			lFilter := AuditFilter{Target: "all"}
+			Expect(lFilter.Match(&lAll)).To(BeTrue())
+		})
+
+		It("includes the whole day of plain to dates", func() {
+			lFilter := ParseAuditFilter(httptest.NewRequest("GET", "/v1/audit?to=2024-03-10", nil))
+			Expect(lFilter.To).To(Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)))
+			Expect(lFilter.Match(&lEntry)).To(BeTrue())
+		})
+
+		It("keeps exact to dates", func() {
+			lFilter := ParseAuditFilter(httptest.NewRequest("GET", "/v1/audit?to=2024-03-10T12:00:00Z", nil))
+			Expect(lFilter.To).To(Equal(lCreated))
+			Expect(lFilter.Match(&lEntry)).To(BeFalse())
+		})
+
+		It("rejects invalid dates", func() {
+			lReq := httptest.NewRequest("GET", "/v1/audit?from=yesterday", nil)
+			Expect(func() { ParseAuditFilter(lReq) }).To(Panic())
+		})
+	})
+
+	Context("Store", func() {
+		var lDir string
+		var lHandler *MessageHandler
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-audit")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+			lHandler = NewTestHandler(nil, lStore, &core.AppConfig{RetentionDays: 30})
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(lDir)
+		})
+
+		lSave := func(pID string, pOutcome string, pAge int) {
+			lItem := lEntry
+			lItem.Id = pID
+			lItem.Outcome = pOutcome
+			lItem.Created = time.Now().AddDate(0, 0, -pAge)
+			lHandler.SaveAudit(&lItem)
+		}
+
+		lExists := func(pID string) bool {
+			lDoc := AuditEntry{}
+			lFound, lErr := lHandler.Store.Get("audit", pID, &lDoc)
+			Expect(lErr).To(BeNil())
+			return lFound
+		}
+
+		It("removes entries older than retention", func() {
+			lSave("recent", AuditSent, 1)
+			lSave("expired", AuditSent, 31)
+			lSave("failed", AuditFailed, 31)
+			lHandler.PruneAudit()
+			Expect(lExists("recent")).To(BeTrue())
+			Expect(lExists("expired")).To(BeFalse())
+			Expect(lExists("failed")).To(BeFalse())
+		})
+
+		It("keeps pending entries", func() {
+			lSave("pending", AuditPending, 31)
+			lHandler.PruneAudit()
+			Expect(lExists("pending")).To(BeTrue())
+		})
+
+		It("keeps all entries without retention", func() {
+			lHandler.Config.RetentionDays = 0
+			lSave("expired", AuditSent, 400)
+			lHandler.PruneAudit()
+			Expect(lExists("expired")).To(BeTrue())
+		})
+
+		lMails := func(pID string, pCount int) []*gomail.Message {
+			lMsgs := []*gomail.Message{}
+			for cIdx := 0; cIdx < pCount; cIdx++ {
+				lMsgs = append(lMsgs, gomail.NewMessage())
+			}
+			lHandler.TrackMails(pID, lMsgs)
+			return lMsgs
+		}
+
+		It("saves delivery statistics once all mails are processed", func() {
+			lSave("sent", AuditSent, 0)
+			lHandler.TrackDelivery("sent", 3)
+			lMsgs := lMails("sent", 3)
+
+			lHandler.OnDelivery(lMsgs[0], nil)
+			lHandler.OnDelivery(lMsgs[1], errors.New("smtp error"))
+			lStored := lHandler.GetAudit("sent")
+			Expect(lStored.Delivered).To(Equal(0))
+			Expect(lStored.Failed).To(Equal(0))
+
+			lHandler.OnDelivery(lMsgs[2], nil)
+			lStored = lHandler.GetAudit("sent")
+			Expect(lStored.Delivered).To(Equal(2))
+			Expect(lStored.Failed).To(Equal(1))
+		})
+
+		It("counts each mail once", func() {
+			lSave("sent", AuditSent, 0)
+			lHandler.TrackDelivery("sent", 2)
+			lMsgs := lMails("sent", 2)
+			lHandler.OnDelivery(lMsgs[0], nil)
+			lHandler.OnDelivery(lMsgs[0], nil)
+			Expect(lHandler.GetAudit("sent").Delivered).To(Equal(0))
+		})
+
+		It("does not add tracking headers to mails", func() {
+			lMsgs := lMails("sent", 1)
+			Expect(lMsgs[0].GetHeader("X-Cf-Wall-Id")).To(BeEmpty())
+		})
+
+		It("ignores untracked mails", func() {
+			lSave("sent", AuditSent, 0)
+			lHandler.TrackDelivery("sent", 1)
+			lHandler.OnDelivery(gomail.NewMessage(), nil)
+			Expect(lHandler.GetAudit("sent").Delivered).To(Equal(0))
+		})
+
+		It("stores each entry in its own file", func() {
+			lSave("first", AuditSent, 0)
+			lSave("second", AuditSent, 0)
+			_, lErr := os.Stat(lDir + "/audit/first.json")
+			Expect(lErr).To(BeNil())
+			_, lErr = os.Stat(lDir + "/audit/second.json")
+			Expect(lErr).To(BeNil())
+		})
+
+		It("moves entries of former single file collections", func() {
+			lData, _ := json.Marshal(map[string]AuditEntry{"former": lEntry})
+			Expect(ioutil.WriteFile(lDir+"/audit.json", lData, 0600)).To(BeNil())
+			Expect(lExists("former")).To(BeTrue())
+			_, lErr := os.Stat(lDir + "/audit.json")
+			Expect(os.IsNotExist(lErr)).To(BeTrue())
+		})
+	})
+
+	Context("Access", func() {
+		var lDir string
+		var lHandler *MessageHandler
+		var lServer *httptest.Server
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-audit")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+
+			var lUaa *core.UaaCli
+			lUaa, lServer = newFakeUaa(map[string]fakeUser{
+				"token-a": fakeUser{Info: core.UaaUserInfo{Id: "user-a", UserName: "alice"}},
+				"token-r": fakeUser{Info: core.UaaUserInfo{Id: "user-r", UserName: "root"}, Scopes: []string{"cf-wall.approve"}},
+			})
+			lHandler = NewTestHandler(lUaa, lStore, &core.AppConfig{ApproverScope: "cf-wall.approve"})
+
+			for _, cID := range []string{"user-a", "user-b"} {
+				lItem := lEntry
+				lItem.Id = "entry-" + cID
+				lItem.UserId = cID
+				lHandler.SaveAudit(&lItem)
+			}
+		})
+
+		AfterEach(func() {
+			lServer.Close()
+			os.RemoveAll(lDir)
+		})
+
+		lList := func(pToken string) []AuditEntry {
+			lRes := httptest.NewRecorder()
+			lHandler.HandleAudit()(lRes, authRequest("GET", "/v1/audit", pToken, ""))
+			Expect(lRes.Code).To(Equal(200))
+			lEntries := []AuditEntry{}
+			Expect(json.NewDecoder(lRes.Body).Decode(&lEntries)).To(BeNil())
+			return lEntries
+		}
+
+		It("lists own entries only to users", func() {
+			lEntries := lList("token-a")
+			Expect(lEntries).To(HaveLen(1))
+			Expect(lEntries[0].UserId).To(Equal("user-a"))
+		})
+
+		It("lists all entries to approvers", func() {
+			Expect(lList("token-r")).To(HaveLen(2))
+		})
+
+		It("rejects unknown users", func() {
+			lRes := httptest.NewRecorder()
+			lHandler.HandleAudit()(lRes, authRequest("GET", "/v1/audit", "token-x", ""))
+			Expect(lRes.Code).To(Equal(400))
+		})
+	})
+})
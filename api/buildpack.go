@@ -0,0 +1,196 @@
+package api
+
+import "fmt"
+import "regexp"
+import "sync"
+import "github.com/Masterminds/semver"
+import log "github.com/sirupsen/logrus"
+import "github.com/cloudfoundry-community/go-cfclient"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// versionPattern extracts version from buildpack strings such as
+// "java-buildpack=v4.5-offline" or "https://host/ruby-buildpack#v1.6.47",
+// versions having to start the string or to follow a separator
+var versionPattern = regexp.MustCompile(`(?:^|[-_=#@ ])v?([0-9]+\.[0-9]+(?:\.[0-9]+)?)`)
+
+// authorityPattern matches host and port of urls, which must not be taken
+// for versions
+var authorityPattern = regexp.MustCompile(`://[^/#]*`)
+
+// BuildpackVersion selects applications by name and version of the
+// buildpack they were staged with
+type BuildpackVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	name       *regexp.Regexp
+	constraint *semver.Constraints
+}
+
+// appBuildpack is a buildpack name and version an application was staged
+// with, version being empty when unknown
+type appBuildpack struct {
+	Name    string
+	Version string
+}
+
+// check validates name pattern and version constraint of selector
+func (s *BuildpackVersion) check() error {
+	if "" == s.Name {
+		return fmt.Errorf("missing buildpack name pattern")
+	}
+	re, err := regexp.Compile(s.Name)
+	if err != nil {
+		return fmt.Errorf("invalid buildpack name regexp '%s'", s.Name)
+	}
+	s.name = re
+
+	if "" != s.Version {
+		constraint, err := semver.NewConstraint(s.Version)
+		if err != nil {
+			return fmt.Errorf("invalid buildpack version constraint '%s': %s", s.Version, err.Error())
+		}
+		s.constraint = constraint
+	}
+	return nil
+}
+
+// match returns true when one of given buildpacks matches selector, buildpacks
+// of unknown version never matching a version constraint
+func (s *BuildpackVersion) match(pBuildpacks []appBuildpack) bool {
+	for _, cBp := range pBuildpacks {
+		if !s.name.MatchString(cBp.Name) {
+			continue
+		}
+		if s.constraint == nil {
+			return true
+		}
+		version, err := semver.NewVersion(cBp.Version)
+		if err == nil && s.constraint.Check(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersion returns first version found in given buildpack string, url
+// authorities being skipped
+func parseVersion(pValue string) string {
+	value := authorityPattern.ReplaceAllString(pValue, "://")
+	match := versionPattern.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// setBuildpackVersions validates buildpack version selectors of request
+func (m *MessageReqCtx) setBuildpackVersions(pSelectors []BuildpackVersion) {
+	for cIdx := range pSelectors {
+		if err := pSelectors[cIdx].check(); err != nil {
+			panic(core.NewHttpError(err, 400, 40))
+		}
+	}
+}
+
+// dropletWorkers is the number of current droplets fetched concurrently
+const dropletWorkers = 10
+
+// getDropletBuildpacks returns buildpacks of the current droplet of given
+// applications, indexed by application guid. Applications whose droplet
+// can't be read are left out
+func (m *MessageReqCtx) getDropletBuildpacks(pApps []string) map[string][]appBuildpack {
+	log.WithFields(log.Fields{"count": len(pApps)}).Debug("reading current droplets")
+
+	res := make(map[string][]appBuildpack)
+	lock := sync.Mutex{}
+	jobs := make(chan string)
+	wg := sync.WaitGroup{}
+
+	for cIdx := 0; cIdx < dropletWorkers; cIdx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cApp := range jobs {
+				droplet, err := core.GetV3CurrentDroplet(m.CCCli, cApp)
+				if err != nil {
+					log.WithError(err).WithFields(log.Fields{"app": cApp}).
+						Warn("unable to read current droplet, using application buildpack fields only")
+					continue
+				}
+				if droplet == nil {
+					continue
+				}
+				buildpacks := dropletBuildpacks(droplet)
+				lock.Lock()
+				res[cApp] = buildpacks
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, cApp := range pApps {
+		jobs <- cApp
+	}
+	close(jobs)
+	wg.Wait()
+	return res
+}
+
+// dropletBuildpacks returns names and versions of buildpacks of given
+// droplet, versions being parsed from detect output when not given
+func dropletBuildpacks(pDroplet *core.V3Droplet) []appBuildpack {
+	res := []appBuildpack{}
+	for _, cBp := range pDroplet.Buildpacks {
+		name := cBp.BuildpackName
+		if "" == name {
+			name = cBp.Name
+		}
+		version := cBp.Version
+		if "" == version {
+			version = parseVersion(cBp.DetectOutput)
+		}
+		res = append(res, appBuildpack{Name: name, Version: version})
+	}
+	return res
+}
+
+// appBuildpacks returns buildpacks of given application, taken from its
+// droplet and from its requested and detected buildpacks
+func appBuildpacks(pApp *cfclient.App, pDroplets map[string][]appBuildpack) []appBuildpack {
+	res := append([]appBuildpack{}, pDroplets[pApp.Guid]...)
+	for _, cVal := range []string{pApp.Buildpack, pApp.DetectedBuildpack} {
+		if "" != cVal {
+			res = append(res, appBuildpack{Name: cVal, Version: parseVersion(cVal)})
+		}
+	}
+	return res
+}
+
+// addBuildpackVersions targets spaces of applications staged with a
+// buildpack matching one of given selectors
+func (m *MessageReqCtx) addBuildpackVersions(pSelectors []BuildpackVersion) {
+	if 0 == len(pSelectors) {
+		return
+	}
+
+	guids := []string{}
+	m.mapApps(func(pApp *cfclient.App) {
+		guids = append(guids, pApp.Guid)
+	})
+	droplets := m.getDropletBuildpacks(guids)
+	m.mapApps(func(pApp *cfclient.App) {
+		buildpacks := appBuildpacks(pApp, droplets)
+		for cIdx := range pSelectors {
+			if pSelectors[cIdx].match(buildpacks) {
+				m.addSpace(pApp.SpaceGuid)
+				m.addImpact(pApp.SpaceGuid, "application", pApp.Name)
+				return
+			}
+		}
+	})
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
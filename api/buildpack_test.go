@@ -0,0 +1,138 @@
+package api_test
+
+import (
+	"sync"
+	"strings"
+	"net/http"
+	"io/ioutil"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// dropletCli answers current droplet requests of applications with given
+// droplet bodies, other applications having no current droplet
+type dropletCli struct {
+	FakeCli
+	droplets map[string]string
+	paths    map[*cfclient.Request]string
+	lock     sync.Mutex
+}
+
+func (self *dropletCli) NewRequest(method, path string) *cfclient.Request {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	lReq := &cfclient.Request{}
+	self.paths[lReq] = path
+	return lReq
+}
+
+func (self *dropletCli) DoRequest(r *cfclient.Request) (*http.Response, error) {
+	self.lock.Lock()
+	lPath := self.paths[r]
+	self.lock.Unlock()
+
+	lBody, lOk := "", false
+	lParts := strings.Split(lPath, "/")
+	if 6 == len(lParts) && "/v3/apps/"+lParts[3]+"/droplets/current" == lPath {
+		lBody, lOk = self.droplets[lParts[3]]
+	}
+	if !lOk {
+		return &http.Response{
+			StatusCode: 404,
+			Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		}, nil
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(lBody)),
+	}, nil
+}
+
+var _ = Describe("BuildpackVersion", func() {
+	lVersions := []struct {
+		Value   string
+		Version string
+	}{
+		{"java-buildpack=v4.5-offline", "4.5"},
+		{"https://github.com/cloudfoundry/ruby-buildpack#v1.6.47", "1.6.47"},
+		{"https://10.0.0.1/ruby-buildpack", ""},
+		{"https://10.0.0.1:8443/ruby-buildpack#v1.8.0", "1.8.0"},
+		{"go_buildpack-cflinuxfs3-v1.8.40.zip", "1.8.40"},
+		{"1.2.3", "1.2.3"},
+		{"nodejs 1.7.10", "1.7.10"},
+		{"staticfile_buildpack", ""},
+		{"python3.8-buildpack", ""},
+	}
+
+	for _, cCase := range lVersions {
+		lCase := cCase
+		It("parses version of '"+lCase.Value+"'", func() {
+			Expect(ParseVersion(lCase.Value)).To(Equal(lCase.Version))
+		})
+	}
+
+	lInvalid := []struct {
+		Name     string
+		Selector BuildpackVersion
+	}{
+		{"without name", BuildpackVersion{Version: ">=1.0"}},
+		{"with invalid name regexp", BuildpackVersion{Name: "ruby("}},
+		{"with invalid constraint", BuildpackVersion{Name: "ruby", Version: "not a version"}},
+	}
+
+	for _, cCase := range lInvalid {
+		lCase := cCase
+		It("rejects selectors "+lCase.Name, func() {
+			Expect(lCase.Selector.Check()).NotTo(BeNil())
+		})
+	}
+
+	lRuby := []AppBuildpack{AppBuildpack{Name: "ruby_buildpack", Version: "1.6.47"}}
+	lUnknown := []AppBuildpack{AppBuildpack{Name: "ruby_buildpack", Version: ""}}
+
+	lMatches := []struct {
+		Name       string
+		Selector   BuildpackVersion
+		Buildpacks []AppBuildpack
+		Match      bool
+	}{
+		{"name only", BuildpackVersion{Name: "^ruby"}, lRuby, true},
+		{"other name", BuildpackVersion{Name: "^java"}, lRuby, false},
+		{"version constraint", BuildpackVersion{Name: "ruby", Version: "< 1.7"}, lRuby, true},
+		{"version out of constraint", BuildpackVersion{Name: "ruby", Version: ">= 1.7"}, lRuby, false},
+		{"unknown version with constraint", BuildpackVersion{Name: "ruby", Version: "< 1.7"}, lUnknown, false},
+		{"unknown version without constraint", BuildpackVersion{Name: "ruby"}, lUnknown, true},
+		{"no buildpack", BuildpackVersion{Name: "ruby"}, []AppBuildpack{}, false},
+	}
+
+	for _, cCase := range lMatches {
+		lCase := cCase
+		It("matches "+lCase.Name, func() {
+			Expect(lCase.Selector.Check()).To(BeNil())
+			Expect(lCase.Selector.Match(lCase.Buildpacks)).To(Equal(lCase.Match))
+		})
+	}
+
+	It("targets applications by buildpacks of their current droplet", func() {
+		lCtx := NewTargetCtx(&dropletCli{
+			droplets: map[string]string{
+				"0b7c3d2e-1f4a-4b5c-8d6e-7f8a9b0c1d2e": `{"buildpacks": [{"name": "ruby_buildpack", "version": "1.6.47"}]}`,
+			},
+			paths: make(map[*cfclient.Request]string),
+		})
+		lSelector := BuildpackVersion{Name: "^ruby", Version: "< 1.7"}
+		Expect(lSelector.Check()).To(BeNil())
+		lCtx.AddBuildpackVersions([]BuildpackVersion{lSelector})
+		Expect(lCtx.Spaces()).To(Equal([]string{"fc95a4c6-b07f-4b9b-871e-1f5d67b06071"}))
+	})
+
+	It("ignores applications without current droplet", func() {
+		lCtx := NewTargetCtx(&dropletCli{paths: make(map[*cfclient.Request]string)})
+		lSelector := BuildpackVersion{Name: "^ruby"}
+		Expect(lSelector.Check()).To(BeNil())
+		lCtx.AddBuildpackVersions([]BuildpackVersion{lSelector})
+		Expect(lCtx.Spaces()).To(BeEmpty())
+	})
+})
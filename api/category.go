@@ -0,0 +1,120 @@
+package api
+
+import "fmt"
+import "strings"
+import "net/http"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Categories messages can be tagged with
+var Categories = []string{"incident", "maintenance", "deprecation", "newsletter", "security"}
+
+// Channels messages can be delivered on
+var Channels = []string{"email", "sms"}
+
+// OptInChannels are channels on which messages are only received when
+// explicitly requested in category preferences
+var OptInChannels = []string{"sms"}
+
+// CategoryResponse --
+type CategoryResponse struct {
+	Name      string `json:"name"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+// CategoriesResponse --
+type CategoriesResponse struct {
+	Categories []CategoryResponse `json:"categories"`
+	Channels   []string           `json:"channels"`
+	OptIn      []string           `json:"opt_in"`
+}
+
+func contains(pList []string, pVal string) bool {
+	for _, cVal := range pList {
+		if cVal == pVal {
+			return true
+		}
+	}
+	return false
+}
+
+// isMandatory returns true when users cannot opt out of given category
+func isMandatory(pConf *core.AppConfig, pCategory string) bool {
+	return contains(pConf.MandatoryCategories, pCategory)
+}
+
+// wants returns true when preference allows messages of given category on
+// given channel, categories without preference being received on all
+// channels but opt-in ones
+func (s *Preference) wants(pCategory string, pChannel string) bool {
+	channels, ok := s.Categories[pCategory]
+	if !ok {
+		return !contains(OptInChannels, pChannel)
+	}
+	return contains(channels, pChannel)
+}
+
+// checkCategories validates category preferences, mandatory categories
+// being required by email
+func checkCategories(pConf *core.AppConfig, pCategories map[string][]string) error {
+	for cCat, cChannels := range pCategories {
+		if !contains(Categories, cCat) {
+			return fmt.Errorf("invalid category '%s', must be one of %s", cCat, strings.Join(Categories, ", "))
+		}
+		for _, cChannel := range cChannels {
+			if !contains(Channels, cChannel) {
+				return fmt.Errorf("invalid channel '%s', must be one of %s", cChannel, strings.Join(Channels, ", "))
+			}
+		}
+		if isMandatory(pConf, cCat) && !contains(cChannels, "email") {
+			return fmt.Errorf("category '%s' is mandatory and cannot be opted out of", cCat)
+		}
+	}
+	return nil
+}
+
+func (m *MessageReqCtx) setCategory(pCategory string) {
+	if "" != pCategory && !contains(Categories, pCategory) {
+		err := fmt.Errorf("invalid category '%s', must be one of %s", pCategory, strings.Join(Categories, ", "))
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	m.ResData.Category = pCategory
+}
+
+// applyCategory removes recipients who opted out of message category on
+// given channel
+func (m *MessageReqCtx) applyCategory(pPrefs map[string]Preference, pChannel string) {
+	category := m.ResData.Category
+	if "" == category || isMandatory(m.Config, category) {
+		return
+	}
+
+	ids := make(map[string]string, len(m.UserMails))
+	for cID, cMail := range m.UserMails {
+		ids[cMail] = cID
+	}
+
+	kept := []string{}
+	for _, cAddr := range m.ResData.Recipients {
+		if pref, ok := pPrefs[ids[cAddr]]; ok && !pref.wants(category, pChannel) {
+			m.ResData.OptedOut += 1
+			continue
+		}
+		kept = append(kept, cAddr)
+	}
+	m.ResData.Recipients = kept
+}
+
+func (s *PreferenceHandler) handleCategories(pRes http.ResponseWriter, pReq *http.Request) {
+	res := CategoriesResponse{Channels: Channels, OptIn: OptInChannels}
+	for _, cCat := range Categories {
+		res.Categories = append(res.Categories, CategoryResponse{
+			Name:      cCat,
+			Mandatory: isMandatory(s.Config, cCat),
+		})
+	}
+	core.WriteJson(pRes, res)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,213 @@
+package api_test
+
+import (
+	"os"
+	"io/ioutil"
+	"net/http/httptest"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Category", func() {
+	lConf := &core.AppConfig{MandatoryCategories: []string{"incident", "security"}}
+
+	lWants := []struct {
+		Name     string
+		Channels map[string][]string
+		Channel  string
+		Wants    bool
+	}{
+		{"email without preference", nil, "email", true},
+		{"sms without preference", nil, "sms", false},
+		{"email when chosen", map[string][]string{"newsletter": {"email"}}, "email", true},
+		{"sms when not chosen", map[string][]string{"newsletter": {"email"}}, "sms", false},
+		{"sms when chosen", map[string][]string{"newsletter": {"sms"}}, "sms", true},
+		{"email when opted out", map[string][]string{"newsletter": {}}, "email", false},
+		{"email of other category", map[string][]string{"maintenance": {}}, "email", true},
+	}
+
+	for _, cCase := range lWants {
+		lCase := cCase
+		It("checks newsletter wanted on "+lCase.Name, func() {
+			lPref := Preference{Categories: lCase.Channels}
+			Expect(lPref.Wants("newsletter", lCase.Channel)).To(Equal(lCase.Wants))
+		})
+	}
+
+	lChecks := []struct {
+		Name       string
+		Categories map[string][]string
+		Valid      bool
+	}{
+		{"no preference", nil, true},
+		{"opted out category", map[string][]string{"newsletter": {}}, true},
+		{"sms opt-in", map[string][]string{"maintenance": {"email", "sms"}}, true},
+		{"unknown category", map[string][]string{"promotion": {"email"}}, false},
+		{"unknown channel", map[string][]string{"newsletter": {"fax"}}, false},
+		{"mandatory incident by email", map[string][]string{"incident": {"email", "sms"}}, true},
+		{"mandatory incident opted out", map[string][]string{"incident": {}}, false},
+		{"mandatory security by sms only", map[string][]string{"security": {"sms"}}, false},
+	}
+
+	for _, cCase := range lChecks {
+		lCase := cCase
+		It("validates preference with "+lCase.Name, func() {
+			lErr := CheckCategories(lConf, lCase.Categories)
+			Expect(lErr == nil).To(Equal(lCase.Valid))
+		})
+	}
+
+	Context("Applied to recipients", func() {
+		var lCtx *MessageReqCtx
+		lPrefs := map[string]Preference{
+			"user-out":   Preference{Categories: map[string][]string{"newsletter": {}, "incident": {}}},
+			"user-sms":   Preference{Categories: map[string][]string{"newsletter": {"sms"}, "incident": {"email", "sms"}}},
+			"user-other": Preference{Categories: map[string][]string{"maintenance": {}}},
+		}
+
+		BeforeEach(func() {
+			lCtx = NewTargetCtx(&FakeCli{})
+			lCtx.Config = lConf
+			lCtx.UserMails = map[string]string{
+				"user-out":   "out@example.com",
+				"user-sms":   "sms@example.com",
+				"user-other": "other@example.com",
+				"user-none":  "none@example.com",
+			}
+			lCtx.ResData.Recipients = []string{
+				"out@example.com",
+				"sms@example.com",
+				"other@example.com",
+				"none@example.com",
+				"external@example.com",
+			}
+		})
+
+		It("removes recipients who opted out of category", func() {
+			lCtx.ResData.Category = "newsletter"
+			lCtx.ApplyCategory(lPrefs, "email")
+			Expect(lCtx.ResData.Recipients).To(Equal([]string{
+				"other@example.com",
+				"none@example.com",
+				"external@example.com",
+			}))
+			Expect(lCtx.ResData.OptedOut).To(Equal(2))
+		})
+
+		It("keeps only recipients who opted in on opt-in channels", func() {
+			lCtx.ResData.Category = "newsletter"
+			lCtx.ApplyCategory(lPrefs, "sms")
+			Expect(lCtx.ResData.Recipients).To(Equal([]string{
+				"sms@example.com",
+				"none@example.com",
+				"external@example.com",
+			}))
+		})
+
+		It("keeps all recipients of mandatory categories", func() {
+			lCtx.ResData.Category = "incident"
+			lCtx.ApplyCategory(lPrefs, "email")
+			Expect(lCtx.ResData.Recipients).To(HaveLen(5))
+			Expect(lCtx.ResData.OptedOut).To(Equal(0))
+		})
+
+		It("keeps all recipients of uncategorized messages", func() {
+			lCtx.ApplyCategory(lPrefs, "email")
+			Expect(lCtx.ResData.Recipients).To(HaveLen(5))
+		})
+	})
+})
+
+var _ = Describe("Preference", func() {
+	lLanguages := []struct {
+		Value    string
+		Expected string
+	}{
+		{"fr", "fr"},
+		{" FR ", "fr"},
+		{"fr_FR", "fr-fr"},
+		{"pt-BR", "pt-br"},
+		{"", ""},
+	}
+
+	for _, cCase := range lLanguages {
+		lCase := cCase
+		It("normalizes language '"+lCase.Value+"'", func() {
+			Expect(NormalizeLanguage(lCase.Value)).To(Equal(lCase.Expected))
+		})
+	}
+
+	Context("Update", func() {
+		var lDir string
+		var lServer *httptest.Server
+		var lHandler *PreferenceHandler
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-pref")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+
+			var lUaa *core.UaaCli
+			lUaa, lServer = newFakeUaa(map[string]fakeUser{
+				"token-a": fakeUser{Info: core.UaaUserInfo{Id: "user-a", UserName: "alice"}},
+			})
+			lHandler = &PreferenceHandler{
+				Config: &core.AppConfig{MandatoryCategories: []string{"incident", "security"}},
+				UaaCli: lUaa,
+				Store:  lStore,
+			}
+		})
+
+		AfterEach(func() {
+			lServer.Close()
+			os.RemoveAll(lDir)
+		})
+
+		lCases := []struct {
+			Name   string
+			Body   string
+			Status int
+		}{
+			{"valid preferences", `{"language": "fr_FR", "categories": {"newsletter": []}}`, 200},
+			{"invalid language", `{"language": "french!"}`, 400},
+			{"unknown category", `{"categories": {"promotion": []}}`, 400},
+			{"mandatory category opted out", `{"categories": {"security": []}}`, 400},
+			{"malformed json", `{"language": `, 400},
+		}
+
+		for _, cCase := range lCases {
+			lCase := cCase
+			It("answers "+lCase.Name, func() {
+				lRes := httptest.NewRecorder()
+				lHandler.HandlePut()(lRes, authRequest("PUT", "/v1/preferences", "token-a", lCase.Body))
+				Expect(lRes.Code).To(Equal(lCase.Status))
+			})
+		}
+
+		It("stores normalized preferences of caller", func() {
+			lRes := httptest.NewRecorder()
+			lHandler.HandlePut()(lRes, authRequest("PUT", "/v1/preferences", "token-a", `{"language": "fr_FR"}`))
+			Expect(lRes.Code).To(Equal(200))
+
+			lPref := Preference{}
+			lFound, lErr := lHandler.Store.Get("preferences", "user-a", &lPref)
+			Expect(lErr).To(BeNil())
+			Expect(lFound).To(BeTrue())
+			Expect(lPref.Language).To(Equal("fr-fr"))
+		})
+
+		It("leaves preferences unchanged on invalid update", func() {
+			lRes := httptest.NewRecorder()
+			lHandler.HandlePut()(lRes, authRequest("PUT", "/v1/preferences", "token-a", `{"categories": {"incident": []}}`))
+			Expect(lRes.Code).To(Equal(400))
+
+			lPref := Preference{}
+			lFound, _ := lHandler.Store.Get("preferences", "user-a", &lPref)
+			Expect(lFound).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package api
+
+import "fmt"
+import "errors"
+import "strings"
+import "net/url"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/chat"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Deliveries lists channels a message can be sent on, chat announcements
+// being posted to channels of targeted organizations and spaces rather
+// than to each user
+var Deliveries = []string{"email", "chat", "sms"}
+
+// checkChatChannels validates configured chat channel mapping
+func checkChatChannels(pChannels []core.ChatChannel) error {
+	for _, cChannel := range pChannels {
+		if "" == cChannel.Org {
+			return fmt.Errorf("missing org for chat channel '%s'", cChannel.Url)
+		}
+		target := chat.Target{Kind: cChannel.Kind, Url: cChannel.Url}
+		if err := target.Check(); err != nil {
+			return fmt.Errorf("chat channel of org '%s': %s", cChannel.Org, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *MessageReqCtx) setChannels(pChannels []string) {
+	for _, cChannel := range pChannels {
+		if !contains(Deliveries, cChannel) {
+			err := fmt.Errorf("invalid channel '%s', must be one of %s", cChannel, strings.Join(Deliveries, ", "))
+			panic(core.NewHttpError(err, 400, 40))
+		}
+	}
+	m.ResData.Channels = pChannels
+}
+
+// sendsOn returns true when message is delivered on given channel, messages
+// without channels being sent by email only
+func (m *MessageResponse) sendsOn(pChannel string) bool {
+	if 0 == len(m.Channels) {
+		return "email" == pChannel
+	}
+	return contains(m.Channels, pChannel)
+}
+
+// public returns response without chat webhook urls, which are secrets
+func (s RecipientsResponse) public() RecipientsResponse {
+	chats := make([]chat.Target, 0, len(s.Chats))
+	for _, cTarget := range s.Chats {
+		cTarget.Url = ""
+		chats = append(chats, cTarget)
+	}
+	s.Chats = chats
+	return s
+}
+
+// findChat returns configured chat channel of given org, or of given space
+// when not empty
+func (m *MessageReqCtx) findChat(pOrg string, pSpace string) *core.ChatChannel {
+	for cIdx, cChannel := range m.Config.ChatChannels {
+		if cChannel.Org == pOrg && cChannel.Space == pSpace {
+			return &m.Config.ChatChannels[cIdx]
+		}
+	}
+	return nil
+}
+
+// addChat adds chat target of given resource, taken from configured mapping
+// or from the chat annotation of the resource. Returns false when resource
+// has no chat target
+func (m *MessageReqCtx) addChat(pKind string, pGUID string, pConf *core.ChatChannel) bool {
+	source := fmt.Sprintf("%s:%s", strings.TrimSuffix(pKind, "s"), pGUID)
+	target := chat.Target{Source: source}
+
+	if pConf != nil {
+		target.Kind = pConf.Kind
+		target.Url = pConf.Url
+		target.Channel = pConf.Channel
+	} else {
+		if "" == m.Config.ChatAnnotation {
+			return false
+		}
+		meta, err := core.GetV3Metadata(m.CCCli, pKind, pGUID)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"source": source}).
+				Warn("unable to read chat annotation")
+			return false
+		}
+		val, ok := meta.Annotations[m.Config.ChatAnnotation]
+		if !ok {
+			return false
+		}
+		parsed, err := chat.ParseTarget(val)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"source": source}).
+				Warn("ignoring invalid chat annotation")
+			return false
+		}
+		// annotations are set by tenants, only trusted hosts are posted to
+		addr, _ := url.Parse(parsed.Url)
+		if !core.HostAllowed(m.Config.ChatHosts, addr.Hostname()) {
+			log.WithFields(log.Fields{"source": source, "host": addr.Hostname()}).
+				Warn("ignoring chat annotation of host not listed in chat-hosts")
+			return false
+		}
+		target.Kind = parsed.Kind
+		target.Url = parsed.Url
+	}
+
+	for _, cTarget := range m.ResData.Chats {
+		if cTarget.Url == target.Url && cTarget.Channel == target.Channel {
+			return true
+		}
+	}
+	m.ResData.Chats = append(m.ResData.Chats, target)
+	return true
+}
+
+// readChats resolves chat targets of targeted spaces and organizations,
+// spaces without their own channel falling back to the channel of their
+// organization
+func (m *MessageReqCtx) readChats() {
+	if !m.ResData.sendsOn("chat") {
+		return
+	}
+
+	orgs := append([]string{}, m.ReqData.Orgs...)
+	if 0 != len(m.spaces) {
+		for _, cSpace := range m.getSpacesByGuid(m.spaces) {
+			if !m.addChat("spaces", cSpace.Guid, m.findChat(cSpace.OrganizationGuid, cSpace.Guid)) {
+				orgs = append(orgs, cSpace.OrganizationGuid)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, cID := range orgs {
+		if seen[cID] {
+			continue
+		}
+		seen[cID] = true
+		m.addChat("organizations", cID, m.findChat(cID, ""))
+	}
+}
+
+// readAllChats targets all configured chat channels
+func (m *MessageReqCtx) readAllChats() {
+	if !m.ResData.sendsOn("chat") {
+		return
+	}
+	for cIdx, cChannel := range m.Config.ChatChannels {
+		kind, guid := "organizations", cChannel.Org
+		if "" != cChannel.Space {
+			kind, guid = "spaces", cChannel.Space
+		}
+		m.addChat(kind, guid, &m.Config.ChatChannels[cIdx])
+	}
+}
+
+// checkChats fails when message is sent on chat, no chat target was found
+// and no other requested channel has any recipient
+func (m *MessageReqCtx) checkChats() {
+	if !m.ResData.sendsOn("chat") || 0 != len(m.ResData.Chats) {
+		return
+	}
+	mails := m.ResData.sendsOn("email") && 0 != len(m.ResData.Recipients)
+	phones := m.ResData.sendsOn("sms") && 0 != len(m.ResData.Phones)
+	if !mails && !phones {
+		err := errors.New("no chat channel found for targeted organizations and spaces")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	log.Warn("no chat channel found for targeted organizations and spaces")
+}
+
+// sendChats enqueues chat posts of given message
+func (m *MessageHandler) sendChats(pData *MessageResponse) {
+	for _, cTarget := range pData.Chats {
+		m.chats <- &chat.Post{
+			Target:   cTarget,
+			Title:    pData.Subject,
+			Text:     pData.Markdown,
+			Severity: pData.Severity,
+		}
+	}
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/chat"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chat", func() {
+	lCases := []struct {
+		Name       string
+		Channels   []string
+		Chats      bool
+		Recipients bool
+		Phones     bool
+		Valid      bool
+	}{
+		{"on email only", []string{"email"}, false, false, false, true},
+		{"on chat with chat target", []string{"chat"}, true, false, false, true},
+		{"on chat without chat target", []string{"chat"}, false, true, true, false},
+		{"on chat and email with recipients", []string{"chat", "email"}, false, true, false, true},
+		{"on chat and email without recipients", []string{"chat", "email"}, false, false, false, false},
+		{"on chat and sms with phones", []string{"chat", "sms"}, false, true, true, true},
+		{"on chat and sms without phones", []string{"chat", "sms"}, false, true, false, false},
+	}
+
+	for _, cCase := range lCases {
+		lCase := cCase
+		It("checks destinations of messages sent "+lCase.Name, func() {
+			lCtx := NewTargetCtx(&FakeCli{})
+			lCtx.ResData.Channels = lCase.Channels
+			if lCase.Chats {
+				lCtx.ResData.Chats = []chat.Target{chat.Target{Kind: "slack"}}
+			}
+			if lCase.Recipients {
+				lCtx.ResData.Recipients = []string{"user@example.com"}
+			}
+			if lCase.Phones {
+				lCtx.ResData.Phones = []string{"+33600000000"}
+			}
+			if lCase.Valid {
+				Expect(func() { lCtx.CheckChats() }).NotTo(Panic())
+			} else {
+				Expect(func() { lCtx.CheckChats() }).To(Panic())
+			}
+		})
+	}
+})
@@ -0,0 +1,262 @@
+package api
+
+import "fmt"
+import "sort"
+import "time"
+import "errors"
+import "net/http"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+const draftCollection = "drafts"
+
+// Draft statuses
+const (
+	DraftPending  = "pending"
+	DraftApproved = "approved"
+	DraftRejected = "rejected"
+)
+
+// Review --
+type Review struct {
+	User     string    `json:"user"`
+	Decision string    `json:"decision"`
+	Comment  string    `json:"comment"`
+	Date     time.Time `json:"date"`
+}
+
+// Draft is a message waiting for approval, stored with its resolved
+// recipients and rendered bodies so that reviewers approve exactly what
+// will be sent
+type Draft struct {
+	Id       string          `json:"id"`
+	Status   string          `json:"status"`
+	Author   string          `json:"author"`
+	AuthorId string          `json:"author_id"`
+	Created  time.Time       `json:"created"`
+	Count    int             `json:"count"`
+	Message  MessageResponse `json:"message"`
+	Reviews  []Review        `json:"reviews"`
+	AuditId  string          `json:"audit_id,omitempty"`
+}
+
+// ReviewRequest --
+type ReviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (m *MessageHandler) registerDrafts(pRouter *mux.Router) {
+	pRouter.Path("/v1/drafts").
+		HandlerFunc(core.DecorateHandler(m.handleDrafts)).
+		Methods("GET")
+
+	pRouter.Path("/v1/drafts/{id}").
+		HandlerFunc(core.DecorateHandler(m.handleDraft)).
+		Methods("GET")
+
+	pRouter.Path("/v1/drafts/{id}/preview").
+		HandlerFunc(core.DecorateHandler(m.handleDraftPreview)).
+		Methods("GET")
+
+	pRouter.Path("/v1/drafts/{id}/approve").
+		HandlerFunc(core.DecorateHandler(m.handleApprove)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+
+	pRouter.Path("/v1/drafts/{id}/reject").
+		HandlerFunc(core.DecorateHandler(m.handleReject)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+}
+
+// dispatch sends given message, or stores it as a pending draft when
+// approval is required
+func (m *MessageHandler) dispatch(pRes http.ResponseWriter, pReq *http.Request, pCtx *MessageReqCtx, pKind string) {
+	pCtx.checkSms()
+	entry := m.newAudit(pReq, pCtx, pKind)
+	if !m.Config.ApprovalRequired {
+		m.deliver(entry, &pCtx.ResData)
+		pRes.WriteHeader(204)
+		return
+	}
+
+	draft := m.createDraft(entry, pCtx)
+	core.WriteJsonStatus(pRes, 202, draft.public())
+}
+
+// createDraft stores context message as a pending draft of given audit entry
+func (m *MessageHandler) createDraft(pEntry *AuditEntry, pCtx *MessageReqCtx) *Draft {
+	draft := Draft{
+		Id:       core.NewId(),
+		Status:   DraftPending,
+		Author:   pEntry.User,
+		AuthorId: pEntry.UserId,
+		Created:  pEntry.Created,
+		Count:    pEntry.Count,
+		Message:  pCtx.ResData,
+		Reviews:  []Review{},
+		AuditId:  pEntry.Id,
+	}
+	if err := m.Store.Put(draftCollection, draft.Id, draft); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	pEntry.DraftId = draft.Id
+	m.saveAudit(pEntry)
+
+	log.WithFields(log.Fields{
+		"draft":  draft.Id,
+		"author": draft.Author,
+		"count":  draft.Count,
+	}).Info("message submitted for approval")
+	return &draft
+}
+
+// public returns draft without chat webhook urls
+func (s Draft) public() Draft {
+	s.Message.RecipientsResponse = s.Message.RecipientsResponse.public()
+	return s
+}
+
+func (m *MessageHandler) getDraft(pID string) *Draft {
+	draft := Draft{}
+	found, err := m.Store.Get(draftCollection, pID, &draft)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	if !found {
+		err := fmt.Errorf("unknown draft '%s'", pID)
+		panic(core.NewHttpError(err, 404, 41))
+	}
+	return &draft
+}
+
+// readDraft returns requested draft, drafts being readable by their author
+// and by owners of the approver scope only
+func (m *MessageHandler) readDraft(pReq *http.Request) *Draft {
+	caller := getCaller(m.UaaCli, pReq)
+	draft := m.getDraft(mux.Vars(pReq)["id"])
+	if draft.AuthorId != caller.Id && !hasScope(m.UaaCli, pReq, m.Config.ApproverScope) {
+		err := fmt.Errorf("scope '%s' is required to read drafts of other users", m.Config.ApproverScope)
+		panic(core.NewHttpError(err, 403, 11))
+	}
+	return draft
+}
+
+func (m *MessageHandler) handleDrafts(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := getCaller(m.UaaCli, pReq)
+	approver := hasScope(m.UaaCli, pReq, m.Config.ApproverScope)
+
+	docs, err := m.Store.List(draftCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	status := pReq.URL.Query().Get("status")
+	res := []Draft{}
+	for _, cDoc := range docs {
+		draft := Draft{}
+		if err := json.Unmarshal(cDoc, &draft); err != nil {
+			continue
+		}
+		if !approver && draft.AuthorId != caller.Id {
+			continue
+		}
+		if "" == status || status == draft.Status {
+			res = append(res, draft.public())
+		}
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		return res[pI].Created.After(res[pJ].Created)
+	})
+	core.WriteJson(pRes, res)
+}
+
+func (m *MessageHandler) handleDraft(pRes http.ResponseWriter, pReq *http.Request) {
+	core.WriteJson(pRes, m.readDraft(pReq).public())
+}
+
+func (m *MessageHandler) handleDraftPreview(pRes http.ResponseWriter, pReq *http.Request) {
+	draft := m.readDraft(pReq)
+
+	dest := pReq.URL.Query().Get("sample")
+	if "" == dest && 0 != len(draft.Message.Recipients) {
+		dest = draft.Message.Recipients[0]
+	}
+	if "" == dest {
+		err := errors.New("no recipient to preview draft for")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	m.writePreview(pRes, pReq, &draft.Message, dest)
+}
+
+func (m *MessageHandler) handleApprove(pRes http.ResponseWriter, pReq *http.Request) {
+	draft := m.review(pReq, DraftApproved)
+	entry := m.getAudit(draft.AuditId)
+	entry.Reviewer = draft.Reviews[len(draft.Reviews)-1].User
+	m.deliver(entry, &draft.Message)
+	core.WriteJson(pRes, draft.public())
+}
+
+func (m *MessageHandler) handleReject(pRes http.ResponseWriter, pReq *http.Request) {
+	draft := m.review(pReq, DraftRejected)
+	entry := m.getAudit(draft.AuditId)
+	entry.Reviewer = draft.Reviews[len(draft.Reviews)-1].User
+	entry.Outcome = AuditRejected
+	m.saveAudit(entry)
+	core.WriteJson(pRes, draft.public())
+}
+
+// review records decision of the caller on requested draft. Caller must
+// own the approver scope and must not be the author of the draft
+func (m *MessageHandler) review(pReq *http.Request, pDecision string) *Draft {
+	caller := requireScope(m.UaaCli, pReq, m.Config.ApproverScope, "review messages")
+
+	data := ReviewRequest{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&data); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	m.drafts.Lock()
+	defer m.drafts.Unlock()
+
+	draft := m.getDraft(mux.Vars(pReq)["id"])
+	if draft.AuthorId == caller.Id {
+		err := errors.New("messages cannot be reviewed by their author")
+		panic(core.NewHttpError(err, 403, 11))
+	}
+	if draft.Status != DraftPending {
+		err := fmt.Errorf("draft is already %s", draft.Status)
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	// messages are only sent along with their audit entry
+	if "" == draft.AuditId {
+		err := fmt.Errorf("draft '%s' has no audit entry", draft.Id)
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	draft.Status = pDecision
+	draft.Reviews = append(draft.Reviews, Review{
+		User:     caller.UserName,
+		Decision: pDecision,
+		Comment:  data.Comment,
+		Date:     time.Now(),
+	})
+	if err := m.Store.Put(draftCollection, draft.Id, draft); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	log.WithFields(log.Fields{
+		"draft":    draft.Id,
+		"reviewer": caller.UserName,
+		"decision": pDecision,
+	}).Info("message reviewed")
+	return draft
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
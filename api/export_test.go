@@ -0,0 +1,227 @@
+package api
+
+import "time"
+import "net/http"
+import "gopkg.in/gomail.v2"
+import "github.com/gorilla/mux"
+import "github.com/cloudfoundry-community/go-cfclient"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
+
+// internals exposed to api_test specs
+
+var DispatchImpacts = dispatchImpacts
+var RenderImpacts = renderImpacts
+var UserLanguage = userLanguage
+
+var ParseVersion = parseVersion
+
+type AppBuildpack = appBuildpack
+
+func (s *Advisory) Check() (string, error) {
+	return s.check()
+}
+
+func (s *BuildpackVersion) Check() error {
+	return s.check()
+}
+
+func (s *BuildpackVersion) Match(pBuildpacks []AppBuildpack) bool {
+	return s.match(pBuildpacks)
+}
+
+// NewTargetCtx returns a message context resolving targets with given client
+func NewTargetCtx(pCli core.CFClient) *MessageReqCtx {
+	return &MessageReqCtx{
+		CCCli:          pCli,
+		NbMaxGetParams: 50,
+		Config:         &core.AppConfig{},
+	}
+}
+
+func (m *MessageReqCtx) Spaces() []string {
+	return m.spaces
+}
+
+func (m *MessageReqCtx) Impacts() map[string][]Impact {
+	return m.impacts
+}
+
+func (m *MessageReqCtx) SetRoles(pOrgRoles []string, pSpaceRoles []string) {
+	m.setRoles(pOrgRoles, pSpaceRoles)
+}
+
+func (m *MessageReqCtx) AddOrgs(pGuids []string) {
+	m.addOrgs(pGuids)
+}
+
+func (m *MessageReqCtx) AddSpaces(pGuids []string) {
+	m.addSpaces(pGuids)
+}
+
+func (m *MessageReqCtx) ReadSpaces() {
+	m.readSpaces()
+}
+
+func (m *MessageReqCtx) AddStacks(pGuids []string) {
+	m.addStacks(pGuids)
+}
+
+func (m *MessageReqCtx) AddServicePlans(pGuids []string, pDeprecated bool) {
+	m.addServicePlans(pGuids, pDeprecated)
+}
+
+func (m *MessageReqCtx) AddBrokers(pGuids []string) {
+	m.addBrokers(pGuids)
+}
+
+var ParseAuditFilter = parseAuditFilter
+var NormalizeLanguage = normalizeLanguage
+var CheckCategories = checkCategories
+
+// NewTestHandler returns a message handler without mail, chat or sms queue
+func NewTestHandler(pUaa *core.UaaCli, pStore *core.Store, pConf *core.AppConfig) *MessageHandler {
+	return &MessageHandler{
+		UaaCli:     pUaa,
+		Config:     pConf,
+		Store:      pStore,
+		deliveries: make(map[string]*delivery),
+		mails:      make(map[*gomail.Message]string),
+		scopes:     make(map[string]*callerScopes),
+	}
+}
+
+var FeedSecret = feedSecret
+
+func (m *MessageHandler) RegisterFeeds(pRouter *mux.Router) {
+	m.registerFeeds(pRouter)
+}
+
+func (s *AuditEntry) TargetsOrg(pOrg string) bool {
+	return s.targetsOrg(pOrg)
+}
+
+func (m *MessageHandler) HandleAnnouncements() http.HandlerFunc {
+	return core.DecorateHandler(m.handleAnnouncements)
+}
+
+func (m *MessageReqCtx) SetDisplay(pStart *time.Time, pEnd *time.Time) {
+	m.setDisplay(pStart, pEnd)
+}
+
+func (s *AuditEntry) DisplayWindow() (time.Time, time.Time, bool) {
+	return s.displayWindow()
+}
+
+func (s *AuditEntry) VisibleTo(pUserID string, pOrgs map[string]bool, pSpaces map[string]bool) bool {
+	return s.visibleTo(pUserID, pOrgs, pSpaces)
+}
+
+func (m *MessageHandler) HandleAudit() http.HandlerFunc {
+	return core.DecorateHandler(m.handleAudit)
+}
+
+func (m *MessageHandler) SaveAudit(pEntry *AuditEntry) {
+	m.saveAudit(pEntry)
+}
+
+func (m *MessageHandler) GetAudit(pID string) *AuditEntry {
+	return m.getAudit(pID)
+}
+
+func (m *MessageHandler) PruneAudit() {
+	m.pruneAudit()
+}
+
+// TrackDelivery starts counting send results of pCount mails of given entry
+func (m *MessageHandler) TrackDelivery(pID string, pCount int) {
+	m.deliveries[pID] = &delivery{count: pCount, saved: time.Now()}
+}
+
+func (m *MessageHandler) TrackMails(pID string, pMsgs []*gomail.Message) {
+	m.trackMails(pID, pMsgs)
+}
+
+func (m *MessageHandler) OnDelivery(pMsg *gomail.Message, pErr error) {
+	m.onDelivery(pMsg, pErr)
+}
+
+func (s *AuditFilter) Match(pEntry *AuditEntry) bool {
+	return s.match(pEntry)
+}
+
+func (s *Suppression) Compile() error {
+	return s.compile()
+}
+
+func (s *Suppression) Match(pAddr string) bool {
+	return s.match(cfmail.AddressKey(pAddr))
+}
+
+func (m *MessageReqCtx) ApplySuppressions(pList []Suppression) {
+	m.applySuppressions(pList)
+}
+
+func (s *Preference) Wants(pCategory string, pChannel string) bool {
+	return s.wants(pCategory, pChannel)
+}
+
+func (m *MessageReqCtx) ApplyCategory(pPrefs map[string]Preference, pChannel string) {
+	m.applyCategory(pPrefs, pChannel)
+}
+
+func (s *PreferenceHandler) HandlePut() http.HandlerFunc {
+	return core.DecorateHandler(s.handlePut)
+}
+
+func (s *AppFilter) Check() error {
+	return s.check()
+}
+
+func (s *AppFilter) Match(pApp *cfclient.App) bool {
+	return s.match(pApp)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
+
+func (m *MessageReqCtx) ReadPhones(pPrefs map[string]Preference) {
+	m.readPhones(pPrefs)
+}
+
+func (m *MessageReqCtx) CheckSms() {
+	m.checkSms()
+}
+
+func (m *MessageReqCtx) CheckChats() {
+	m.checkChats()
+}
+
+func (s *Webhook) Check(pHosts []string) error {
+	return s.check(pHosts)
+}
+
+// NewTestWebhookHandler returns a webhook handler without sender queue
+func NewTestWebhookHandler(pStore *core.Store, pConf *core.AppConfig) *WebhookHandler {
+	return &WebhookHandler{
+		Config: pConf,
+		Store:  pStore,
+	}
+}
+
+func (s *WebhookHandler) FailPendingDeliveries() {
+	s.failPendingDeliveries()
+}
+
+func (s *WebhookHandler) PruneDeliveries() {
+	s.pruneDeliveries()
+}
+
+func (m *MessageReqCtx) AddBuildpackVersions(pSelectors []BuildpackVersion) {
+	m.addBuildpackVersions(pSelectors)
+}
+
+func (m *MessageReqCtx) GetOrgLanguages(pUsers map[string]bool) map[string]string {
+	return m.getOrgLanguages(pUsers)
+}
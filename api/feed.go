@@ -0,0 +1,315 @@
+package api
+
+import "fmt"
+import "time"
+import "errors"
+import "net/http"
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/xml"
+import "github.com/gorilla/mux"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// feedSize is the maximum number of announcements listed in feeds
+const feedSize = 50
+
+// feedGlobal is the scope of the feed of all announcements
+const feedGlobal = "all"
+
+// FeedSecretResponse --
+type FeedSecretResponse struct {
+	Secret string `json:"secret"`
+	Atom   string `json:"atom"`
+	Rss    string `json:"rss"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Author     string         `xml:"author>name"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func (m *MessageHandler) registerFeeds(pRouter *mux.Router) {
+	pRouter.Path("/v1/feeds.{format:atom|rss}").
+		HandlerFunc(core.DecorateHandler(m.handleFeed)).
+		Methods("GET")
+
+	pRouter.Path("/v1/feeds/secret").
+		HandlerFunc(core.DecorateHandler(m.handleFeedSecret)).
+		Methods("GET")
+
+	pRouter.Path("/v1/feeds/{org}.{format:atom|rss}").
+		HandlerFunc(core.DecorateHandler(m.handleFeed)).
+		Methods("GET")
+
+	pRouter.Path("/v1/feeds/{org}/secret").
+		HandlerFunc(core.DecorateHandler(m.handleFeedSecret)).
+		Methods("GET")
+}
+
+// feedSecret returns the secret granting access to the feed of given scope,
+// derived from the configured feed key
+func feedSecret(pKey string, pScope string) string {
+	mac := hmac.New(sha256.New, []byte(pKey))
+	mac.Write([]byte(pScope))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func feedScope(pReq *http.Request) string {
+	if org, ok := mux.Vars(pReq)["org"]; ok {
+		return org
+	}
+	return feedGlobal
+}
+
+// checkFeedScope fails when request caller may not read the feed of given
+// scope: the global feed requires the approver scope, organization feeds
+// require the organization to be visible to the caller
+func (m *MessageHandler) checkFeedScope(pReq *http.Request, pScope string) {
+	if feedGlobal == pScope {
+		requireScope(m.UaaCli, pReq, m.Config.ApproverScope, "read the global feed")
+		return
+	}
+	caller := getCaller(m.UaaCli, pReq)
+	orgs, _ := m.getCallerScopes(pReq, caller.Id)
+	if !orgs[pScope] {
+		err := fmt.Errorf("organization '%s' is not visible to caller", pScope)
+		panic(core.NewHttpError(err, 403, 11))
+	}
+}
+
+// checkFeedAccess authenticates feed request either by its secret parameter
+// or by its authorization token
+func (m *MessageHandler) checkFeedAccess(pReq *http.Request, pScope string) {
+	secret := pReq.URL.Query().Get("secret")
+	if "" == secret {
+		m.checkFeedScope(pReq, pScope)
+		return
+	}
+	if "" == m.Config.FeedKey ||
+		!hmac.Equal([]byte(secret), []byte(feedSecret(m.Config.FeedKey, pScope))) {
+		err := errors.New("invalid feed secret")
+		panic(core.NewHttpError(err, 403, 11))
+	}
+}
+
+// targetsOrg returns true when entry announcement was sent to given
+// organization, messages to all users being sent to all organizations
+func (s *AuditEntry) targetsOrg(pOrg string) bool {
+	if AuditMessageAll == s.Kind || feedGlobal == pOrg {
+		return true
+	}
+	if 0 != len(s.Orgs) {
+		return contains(s.Orgs, pOrg)
+	}
+	return contains(s.Request.Orgs, pOrg)
+}
+
+// getFeedEntries returns most recent announcements sent to given
+// organization
+func (m *MessageHandler) getFeedEntries(pScope string) []AuditEntry {
+	res := []AuditEntry{}
+	for _, cEntry := range m.listAudit(AuditFilter{}) {
+		if AuditTest == cEntry.Kind || AuditSent != cEntry.Outcome || cEntry.Sent == nil {
+			continue
+		}
+		if !cEntry.targetsOrg(pScope) {
+			continue
+		}
+		res = append(res, cEntry)
+		if len(res) == feedSize {
+			break
+		}
+	}
+	return res
+}
+
+// feedBody returns html body of announcement in default language
+func (m *MessageHandler) feedBody(pEntry *AuditEntry) string {
+	body := pEntry.Request.Message
+	if "" == body {
+		body = selectLanguage(pEntry.Request.Messages, normalizeLanguage(m.Config.DefaultLanguage), "")
+	}
+	return renderMarkdown(body)
+}
+
+func feedBaseUrl(pReq *http.Request) string {
+	scheme := "http"
+	if pReq.TLS != nil {
+		scheme = "https"
+	}
+	if proto := pReq.Header.Get("X-Forwarded-Proto"); "" != proto {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, pReq.Host)
+}
+
+func feedTitle(pScope string) string {
+	if feedGlobal == pScope {
+		return "cf-wall announcements"
+	}
+	return fmt.Sprintf("cf-wall announcements for organization %s", pScope)
+}
+
+func (m *MessageHandler) buildAtom(pReq *http.Request, pScope string, pEntries []AuditEntry) atomFeed {
+	base := feedBaseUrl(pReq)
+	res := atomFeed{
+		Title:   feedTitle(pScope),
+		Id:      fmt.Sprintf("urn:cf-wall:feed:%s", pScope),
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: base + pReq.URL.Path, Rel: "self"},
+			{Href: base + "/ui/history"},
+		},
+		Entries: []atomEntry{},
+	}
+	if 0 != len(pEntries) {
+		res.Updated = pEntries[0].Sent.UTC().Format(time.RFC3339)
+	}
+
+	for cIdx := range pEntries {
+		entry := &pEntries[cIdx]
+		item := atomEntry{
+			Title:   entry.Subject,
+			Id:      fmt.Sprintf("urn:cf-wall:message:%s", entry.Id),
+			Updated: entry.Sent.UTC().Format(time.RFC3339),
+			Author:  entry.User,
+			Content: atomText{Type: "html", Body: m.feedBody(entry)},
+		}
+		if "" != entry.Request.Category {
+			item.Categories = []atomCategory{{Term: entry.Request.Category}}
+		}
+		res.Entries = append(res.Entries, item)
+	}
+	return res
+}
+
+func (m *MessageHandler) buildRss(pReq *http.Request, pScope string, pEntries []AuditEntry) rssFeed {
+	res := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feedTitle(pScope),
+			Link:          feedBaseUrl(pReq) + "/ui/history",
+			Description:   feedTitle(pScope),
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			Items:         []rssItem{},
+		},
+	}
+
+	for cIdx := range pEntries {
+		entry := &pEntries[cIdx]
+		item := rssItem{
+			Title:       entry.Subject,
+			Guid:        rssGuid{IsPermaLink: "false", Value: fmt.Sprintf("urn:cf-wall:message:%s", entry.Id)},
+			PubDate:     entry.Sent.UTC().Format(time.RFC1123Z),
+			Description: m.feedBody(entry),
+		}
+		if "" != entry.Request.Category {
+			item.Categories = []string{entry.Request.Category}
+		}
+		res.Channel.Items = append(res.Channel.Items, item)
+	}
+	return res
+}
+
+func (m *MessageHandler) handleFeed(pRes http.ResponseWriter, pReq *http.Request) {
+	scope := feedScope(pReq)
+	m.checkFeedAccess(pReq, scope)
+	entries := m.getFeedEntries(scope)
+
+	var feed interface{}
+	contentType := "application/atom+xml; charset=utf-8"
+	if "rss" == mux.Vars(pReq)["format"] {
+		feed = m.buildRss(pReq, scope, entries)
+		contentType = "application/rss+xml; charset=utf-8"
+	} else {
+		feed = m.buildAtom(pReq, scope, entries)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 55))
+	}
+	pRes.Header().Set("Content-Type", contentType)
+	pRes.Write([]byte(xml.Header))
+	pRes.Write(data)
+}
+
+func (m *MessageHandler) handleFeedSecret(pRes http.ResponseWriter, pReq *http.Request) {
+	if "" == m.Config.FeedKey {
+		err := errors.New("feed secrets are disabled, feed-key is not configured")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	scope := feedScope(pReq)
+	m.checkFeedScope(pReq, scope)
+	secret := feedSecret(m.Config.FeedKey, scope)
+	path := "/v1/feeds"
+	if feedGlobal != scope {
+		path = fmt.Sprintf("/v1/feeds/%s", scope)
+	}
+	base := feedBaseUrl(pReq) + path
+	core.WriteJson(pRes, FeedSecretResponse{
+		Secret: secret,
+		Atom:   fmt.Sprintf("%s.atom?secret=%s", base, secret),
+		Rss:    fmt.Sprintf("%s.rss?secret=%s", base, secret),
+	})
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
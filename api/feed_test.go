@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"os"
+	"time"
+	"io/ioutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Feed", func() {
+	lOrg := "ddddb760-ef75-40f4-9d52-1bb557b61af8"
+
+	It("derives distinct secrets by key and scope", func() {
+		lSecret := FeedSecret("key", lOrg)
+		Expect(lSecret).To(HaveLen(64))
+		Expect(FeedSecret("key", lOrg)).To(Equal(lSecret))
+		Expect(FeedSecret("key", "all")).NotTo(Equal(lSecret))
+		Expect(FeedSecret("other-key", lOrg)).NotTo(Equal(lSecret))
+	})
+
+	lTargets := []struct {
+		Name    string
+		Entry   AuditEntry
+		Org     string
+		Targets bool
+	}{
+		{"message to all users", AuditEntry{Kind: AuditMessageAll}, "org-1", true},
+		{"any message in global feed", AuditEntry{Kind: AuditMessage}, "all", true},
+		{"message to org", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Orgs: []string{"org-1"}}}}, "org-1", true},
+		{"message to other org", AuditEntry{Request: MessageRequest{RecipientsRequest: RecipientsRequest{Orgs: []string{"org-2"}}}}, "org-1", false},
+		{"message resolved to org", AuditEntry{Orgs: []string{"org-1"}}, "org-1", true},
+		{"message resolved to other org", AuditEntry{Orgs: []string{"org-2"}, Request: MessageRequest{RecipientsRequest: RecipientsRequest{Orgs: []string{"org-1"}}}}, "org-1", false},
+	}
+
+	for _, cCase := range lTargets {
+		lCase := cCase
+		It("checks org targeted by "+lCase.Name, func() {
+			Expect(lCase.Entry.TargetsOrg(lCase.Org)).To(Equal(lCase.Targets))
+		})
+	}
+
+	Context("Access", func() {
+		var lDir string
+		var lServer *httptest.Server
+		var lHandler *MessageHandler
+		var lRouter *mux.Router
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-feed")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+
+			var lUaa *core.UaaCli
+			lUaa, lServer = newFakeUaa(map[string]fakeUser{
+				"token-a": fakeUser{Info: core.UaaUserInfo{Id: "user-a", UserName: "alice"}},
+				"token-r": fakeUser{Info: core.UaaUserInfo{Id: "user-r", UserName: "root"}, Scopes: []string{"cf-wall.approve"}},
+			})
+			lHandler = NewTestHandler(lUaa, lStore, &core.AppConfig{
+				ApproverScope: "cf-wall.approve",
+				FeedKey:       "feed-key",
+			})
+			lHandler.CCCreator = func(*http.Request) core.CFClient {
+				return &FakeCli{}
+			}
+			lRouter = mux.NewRouter()
+			lHandler.RegisterFeeds(lRouter)
+
+			lSent := time.Now().Add(-time.Hour)
+			for cID, cOrg := range map[string]string{"Org maintenance": lOrg, "Other maintenance": "other-org"} {
+				lEntry := AuditEntry{
+					Id:      core.NewId(),
+					Kind:    AuditMessage,
+					Subject: cID,
+					Created: lSent,
+					Sent:    &lSent,
+					Outcome: AuditSent,
+				}
+				lEntry.Request.Orgs = []string{cOrg}
+				lHandler.SaveAudit(&lEntry)
+			}
+		})
+
+		AfterEach(func() {
+			lServer.Close()
+			os.RemoveAll(lDir)
+		})
+
+		lGet := func(pUrl string, pToken string) *httptest.ResponseRecorder {
+			lReq := httptest.NewRequest("GET", pUrl, nil)
+			if "" != pToken {
+				lReq = authRequest("GET", pUrl, pToken, "")
+			}
+			lRes := httptest.NewRecorder()
+			lRouter.ServeHTTP(lRes, lReq)
+			return lRes
+		}
+
+		lCases := []struct {
+			Name   string
+			Url    string
+			Token  string
+			Status int
+		}{
+			{"org feed with its secret", "/v1/feeds/" + lOrg + ".atom?secret=" + FeedSecret("feed-key", lOrg), "", 200},
+			{"global feed with its secret", "/v1/feeds.rss?secret=" + FeedSecret("feed-key", "all"), "", 200},
+			{"org feed with secret of other org", "/v1/feeds/" + lOrg + ".atom?secret=" + FeedSecret("feed-key", "other-org"), "", 403},
+			{"org feed with global secret", "/v1/feeds/" + lOrg + ".atom?secret=" + FeedSecret("feed-key", "all"), "", 403},
+			{"org feed with secret of other key", "/v1/feeds/" + lOrg + ".atom?secret=" + FeedSecret("other-key", lOrg), "", 403},
+			{"org feed with truncated secret", "/v1/feeds/" + lOrg + ".atom?secret=" + FeedSecret("feed-key", lOrg)[0:32], "", 403},
+			{"feed without secret nor token", "/v1/feeds/" + lOrg + ".atom", "", 400},
+			{"org feed visible to caller", "/v1/feeds/" + lOrg + ".atom", "token-a", 200},
+			{"org feed not visible to caller", "/v1/feeds/other-org.atom", "token-a", 403},
+			{"global feed without approver scope", "/v1/feeds.atom", "token-a", 403},
+			{"global feed with approver scope", "/v1/feeds.atom", "token-r", 200},
+			{"org secret visible to caller", "/v1/feeds/" + lOrg + "/secret", "token-a", 200},
+			{"org secret not visible to caller", "/v1/feeds/other-org/secret", "token-a", 403},
+			{"global secret without approver scope", "/v1/feeds/secret", "token-a", 403},
+		}
+
+		for _, cCase := range lCases {
+			lCase := cCase
+			It("answers "+lCase.Name, func() {
+				Expect(lGet(lCase.Url, lCase.Token).Code).To(Equal(lCase.Status))
+			})
+		}
+
+		It("rejects secrets when feed key is not configured", func() {
+			lHandler.Config.FeedKey = ""
+			lRes := lGet("/v1/feeds/"+lOrg+".atom?secret="+FeedSecret("", lOrg), "")
+			Expect(lRes.Code).To(Equal(403))
+			Expect(lGet("/v1/feeds/"+lOrg+"/secret", "token-a").Code).To(Equal(400))
+		})
+
+		It("gives feed urls with their secret", func() {
+			lRes := lGet("/v1/feeds/"+lOrg+"/secret", "token-a")
+			lData := FeedSecretResponse{}
+			Expect(json.NewDecoder(lRes.Body).Decode(&lData)).To(BeNil())
+			Expect(lData.Secret).To(Equal(FeedSecret("feed-key", lOrg)))
+			Expect(lData.Atom).To(HaveSuffix("/v1/feeds/" + lOrg + ".atom?secret=" + lData.Secret))
+		})
+
+		It("lists announcements of organization only", func() {
+			lBody := lGet("/v1/feeds/"+lOrg+".atom?secret="+FeedSecret("feed-key", lOrg), "").Body.String()
+			Expect(lBody).To(ContainSubstring("Org maintenance"))
+			Expect(lBody).NotTo(ContainSubstring("Other maintenance"))
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package api
+
+import "fmt"
+import "sort"
+import "bytes"
+import "errors"
+import "net/url"
+import "strings"
+import "html/template"
+import "github.com/cloudfoundry-community/go-cfclient"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Impact --
+type Impact struct {
+	Org   string `json:"org"`
+	Space string `json:"space"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+}
+
+var impactTpl = template.Must(template.New("impacts").Parse(`
+<p>The following resources you have access to are concerned by this message:</p>
+<table border="1" cellpadding="4" cellspacing="0" style="border-collapse:collapse;">
+  <tr><th>Organization</th><th>Space</th><th>Type</th><th>Name</th></tr>
+  {{- range . }}
+  <tr><td>{{ .Org }}</td><td>{{ .Space }}</td><td>{{ .Kind }}</td><td>{{ .Name }}</td></tr>
+  {{- end }}
+</table>
+`))
+
+func renderImpacts(pImpacts []Impact) string {
+	if 0 == len(pImpacts) {
+		return ""
+	}
+
+	buf := bytes.Buffer{}
+	err := impactTpl.Execute(&buf, pImpacts)
+	if err != nil {
+		log.WithError(err).Error("unable to render impact table")
+		return ""
+	}
+	return buf.String()
+}
+
+func splitParams(pList []string, pSize int) [][]string {
+	res := [][]string{}
+	if pSize <= 0 {
+		pSize = len(pList)
+	}
+	for cIdx := 0; cIdx < len(pList); cIdx += pSize {
+		end := cIdx + pSize
+		if end > len(pList) {
+			end = len(pList)
+		}
+		res = append(res, pList[cIdx:end])
+	}
+	return res
+}
+
+func (m *MessageReqCtx) addImpact(pSpaceID string, pKind string, pName string) {
+	if m.impacts == nil {
+		m.impacts = make(map[string][]Impact)
+	}
+	for _, cImpact := range m.impacts[pSpaceID] {
+		if cImpact.Kind == pKind && cImpact.Name == pName {
+			return
+		}
+	}
+	m.impacts[pSpaceID] = append(m.impacts[pSpaceID], Impact{Kind: pKind, Name: pName})
+}
+
+// readImpacts resolves org and space names of impacted resources and dispatches
+// them to the users of each impacted space
+func (m *MessageReqCtx) readImpacts() {
+	if 0 == len(m.impacts) {
+		return
+	}
+
+	spaceIDs := []string{}
+	for cID := range m.impacts {
+		spaceIDs = append(spaceIDs, cID)
+	}
+
+	spaces := m.getSpacesByGuid(spaceIDs)
+	orgIDs := []string{}
+	for _, cSpace := range spaces {
+		orgIDs = append(orgIDs, cSpace.OrganizationGuid)
+	}
+	orgs := m.getOrgsByGuid(orgIDs)
+	users := m.getSpacesRolesUsers(spaceIDs)
+
+	m.ResData.Impacts = dispatchImpacts(m.impacts, spaces, orgs, users, m.UserMails)
+}
+
+// dispatchImpacts names impacted resources after their org and space, and
+// groups them by address of the users of each impacted space. Spaces are
+// processed by guid order so that impact tables are stable
+func dispatchImpacts(
+	pImpacts map[string][]Impact,
+	pSpaces map[string]cfclient.Space,
+	pOrgs map[string]cfclient.Org,
+	pUsers map[string][]string,
+	pMails map[string]string) map[string][]Impact {
+
+	spaceIDs := []string{}
+	for cID := range pSpaces {
+		spaceIDs = append(spaceIDs, cID)
+	}
+	sort.Strings(spaceIDs)
+
+	var res map[string][]Impact
+	for _, cID := range spaceIDs {
+		space := pSpaces[cID]
+		impacts := pImpacts[cID]
+		for cIdx := range impacts {
+			impacts[cIdx].Org = pOrgs[space.OrganizationGuid].Name
+			impacts[cIdx].Space = space.Name
+		}
+
+		for _, cUser := range pUsers[cID] {
+			mail, ok := pMails[cUser]
+			if !ok {
+				continue
+			}
+			if res == nil {
+				res = make(map[string][]Impact)
+			}
+			res[mail] = append(res[mail], impacts...)
+		}
+	}
+	return res
+}
+
+func (m *MessageReqCtx) getSpacesByGuid(pList []string) map[string]cfclient.Space {
+	res := make(map[string]cfclient.Space)
+	for _, cChunk := range splitParams(pList, m.NbMaxGetParams) {
+		query := url.Values{}
+		query.Add("q", fmt.Sprintf("guid IN %s", strings.Join(cChunk, ",")))
+
+		log.WithFields(log.Fields{"spaces": cChunk}).
+			Debug("reading spaces")
+
+		spaces, err := m.CCCli.ListSpacesByQuery(query)
+		if err != nil {
+			uerr := errors.New("unable to fetch spaces from CC api")
+			log.WithError(err).Error(uerr.Error())
+			panic(core.NewHttpError(err, 500, 50))
+		}
+		for _, cSpace := range spaces {
+			res[cSpace.Guid] = cSpace
+		}
+	}
+	return res
+}
+
+func (m *MessageReqCtx) getOrgsByGuid(pList []string) map[string]cfclient.Org {
+	res := make(map[string]cfclient.Org)
+	for _, cChunk := range splitParams(pList, m.NbMaxGetParams) {
+		query := url.Values{}
+		query.Add("q", fmt.Sprintf("guid IN %s", strings.Join(cChunk, ",")))
+
+		log.WithFields(log.Fields{"orgs": cChunk}).
+			Debug("reading orgs")
+
+		orgs, err := m.CCCli.ListOrgsByQuery(query)
+		if err != nil {
+			uerr := errors.New("unable to fetch organizations from CC api")
+			log.WithError(err).Error(uerr.Error())
+			panic(core.NewHttpError(err, 500, 50))
+		}
+		for _, cOrg := range orgs {
+			res[cOrg.Guid] = cOrg
+		}
+	}
+	return res
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/cloudfoundry-community/go-cfclient"
+)
+
+var _ = Describe("Impacts", func() {
+	var lSpaces map[string]cfclient.Space
+	var lOrgs map[string]cfclient.Org
+	var lMails map[string]string
+
+	BeforeEach(func() {
+		lSpaces = map[string]cfclient.Space{
+			"space-a": cfclient.Space{Guid: "space-a", Name: "dev", OrganizationGuid: "org-1"},
+			"space-b": cfclient.Space{Guid: "space-b", Name: "prod", OrganizationGuid: "org-1"},
+		}
+		lOrgs = map[string]cfclient.Org{
+			"org-1": cfclient.Org{Guid: "org-1", Name: "acme"},
+		}
+		lMails = map[string]string{
+			"user-1": "user-1@example.com",
+			"user-2": "user-2@example.com",
+		}
+	})
+
+	It("groups named impacts by space user address", func() {
+		lRes := DispatchImpacts(
+			map[string][]Impact{
+				"space-a": []Impact{Impact{Kind: "application", Name: "app-a"}},
+				"space-b": []Impact{Impact{Kind: "service", Name: "db-b"}},
+			},
+			lSpaces, lOrgs,
+			map[string][]string{
+				"space-a": []string{"user-1", "user-2"},
+				"space-b": []string{"user-1", "unknown-user"},
+			},
+			lMails)
+
+		Expect(lRes).To(HaveLen(2))
+		Expect(lRes["user-1@example.com"]).To(Equal([]Impact{
+			Impact{Org: "acme", Space: "dev", Kind: "application", Name: "app-a"},
+			Impact{Org: "acme", Space: "prod", Kind: "service", Name: "db-b"},
+		}))
+		Expect(lRes["user-2@example.com"]).To(Equal([]Impact{
+			Impact{Org: "acme", Space: "dev", Kind: "application", Name: "app-a"},
+		}))
+	})
+
+	It("returns nil when impacted spaces have no known user", func() {
+		lRes := DispatchImpacts(
+			map[string][]Impact{"space-a": []Impact{Impact{Kind: "application", Name: "app-a"}}},
+			lSpaces, lOrgs, map[string][]string{}, lMails)
+		Expect(lRes).To(BeNil())
+	})
+
+	It("renders escaped impact tables", func() {
+		lRes := RenderImpacts([]Impact{
+			Impact{Org: "acme", Space: "dev", Kind: "application", Name: "<app>"},
+		})
+		Expect(lRes).To(ContainSubstring("<td>acme</td><td>dev</td><td>application</td><td>&lt;app&gt;</td>"))
+	})
+
+	It("renders nothing without impact", func() {
+		Expect(RenderImpacts([]Impact{})).To(Equal(""))
+	})
+})
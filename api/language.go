@@ -0,0 +1,173 @@
+package api
+
+import "fmt"
+import "strings"
+import "net/url"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// selectLanguage returns pVariants entry matching pLang, trying the base
+// language of regional locales ("fr" for "fr-be") before falling back
+// to pDefault
+func selectLanguage(pVariants map[string]string, pLang string, pDefault string) string {
+	if val, ok := pVariants[pLang]; ok {
+		return val
+	}
+	if idx := strings.Index(pLang, "-"); idx > 0 {
+		if val, ok := pVariants[pLang[0:idx]]; ok {
+			return val
+		}
+	}
+	return pDefault
+}
+
+// setTranslations renders subject and body of each language variant given
+// in request, the variant of default language being used when no
+// language-less subject or message are given
+func (m *MessageReqCtx) setTranslations(pTag string) {
+	defLang := normalizeLanguage(m.Config.DefaultLanguage)
+
+	for cLang, cSub := range m.ReqData.Subjects {
+		lang := normalizeLanguage(cLang)
+		if m.ResData.Subjects == nil {
+			m.ResData.Subjects = make(map[string]string)
+		}
+		m.ResData.Subjects[lang] = cSub
+		if len(pTag) != 0 {
+			m.ResData.Subjects[lang] = fmt.Sprintf("%s %s", pTag, cSub)
+		}
+		if lang == defLang && "" == m.ReqData.Subject {
+			m.setSubject(cSub, pTag)
+		}
+	}
+
+	for cLang, cMsg := range m.ReqData.Messages {
+		lang := normalizeLanguage(cLang)
+		if m.ResData.Messages == nil {
+			m.ResData.Messages = make(map[string]string)
+		}
+		m.ResData.Messages[lang] = renderMarkdown(cMsg)
+		if lang == defLang && "" == m.ReqData.Message {
+			m.setBody(cMsg)
+		}
+	}
+
+	if 0 != len(m.ReqData.Messages) && "" == m.ResData.Message {
+		err := fmt.Errorf("missing message for default language '%s'", defLang)
+		panic(core.NewHttpError(err, 400, 40))
+	}
+}
+
+// readLanguages computes the language of each recipient from its stored
+// preference, the annotation of the organization it was reached through
+// or the configured default language
+func (m *MessageReqCtx) readLanguages(pPrefs map[string]Preference) {
+	if 0 == len(m.ResData.Subjects) && 0 == len(m.ResData.Messages) {
+		return
+	}
+
+	ids := make(map[string]string, len(m.UserMails))
+	for cID, cMail := range m.UserMails {
+		ids[cMail] = cID
+	}
+
+	users := make(map[string]bool, len(m.ResData.Recipients))
+	for _, cMail := range m.ResData.Recipients {
+		if id, ok := ids[cMail]; ok {
+			users[id] = true
+		}
+	}
+
+	orgLangs := m.getOrgLanguages(users)
+	defLang := normalizeLanguage(m.Config.DefaultLanguage)
+	m.ResData.Languages = make(map[string]string, len(m.ResData.Recipients))
+	for _, cMail := range m.ResData.Recipients {
+		m.ResData.Languages[cMail] = userLanguage(ids[cMail], pPrefs, orgLangs, defLang)
+	}
+}
+
+// userLanguage returns language of given user: its stored preference, the
+// language of the organization it was reached through, or pDefault. Users
+// unknown from UAA, given by an empty id, always get pDefault
+func userLanguage(pID string, pPrefs map[string]Preference, pOrgLangs map[string]string, pDefault string) string {
+	if "" == pID {
+		return pDefault
+	}
+	if pref, ok := pPrefs[pID]; ok && "" != pref.Language {
+		return pref.Language
+	}
+	if lang, ok := pOrgLangs[pID]; ok {
+		return lang
+	}
+	return pDefault
+}
+
+// orgMemberRoles are the organization role types, all members of an
+// organization having at least the organization_user role
+var orgMemberRoles = []string{
+	"organization_user",
+	"organization_manager",
+	"organization_billing_manager",
+	"organization_auditor",
+}
+
+// getOrgLanguages returns language of given users from the configured
+// language annotation of the targeted organizations they are member of,
+// indexed by user guid. Organizations are processed in target order, first
+// one winning for users member of several of them
+func (m *MessageReqCtx) getOrgLanguages(pUsers map[string]bool) map[string]string {
+	res := make(map[string]string)
+	if "" == m.Config.LangAnnotation || 0 == len(m.ResData.Orgs) || 0 == len(pUsers) {
+		return res
+	}
+
+	langs := make(map[string]string)
+	annotated := []string{}
+	for _, cChunk := range splitParams(m.ResData.Orgs, m.NbMaxGetParams) {
+		metas, err := core.ListV3Metadata(m.CCCli, "organizations", cChunk)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"orgs": cChunk}).
+				Warn("unable to read organization languages, using default")
+			continue
+		}
+		for _, cID := range cChunk {
+			lang := normalizeLanguage(metas[cID].Annotations[m.Config.LangAnnotation])
+			if "" != lang {
+				langs[cID] = lang
+				annotated = append(annotated, cID)
+			}
+		}
+	}
+
+	members := make(map[string][]string)
+	for _, cChunk := range splitParams(annotated, m.NbMaxGetParams) {
+		query := url.Values{}
+		query.Add("types", strings.Join(orgMemberRoles, ","))
+		query.Add("organization_guids", strings.Join(cChunk, ","))
+		query.Add("per_page", "5000")
+		roles, err := core.ListV3Roles(m.CCCli, query)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"orgs": cChunk}).
+				Warn("unable to read organization members, using default language")
+			continue
+		}
+		for _, cRole := range roles {
+			if pUsers[cRole.User] {
+				members[cRole.Org] = append(members[cRole.Org], cRole.User)
+			}
+		}
+	}
+
+	for _, cID := range annotated {
+		for _, cUser := range members[cID] {
+			if _, ok := res[cUser]; !ok {
+				res[cUser] = langs[cID]
+			}
+		}
+	}
+	return res
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"net/url"
+	"net/http"
+	"encoding/json"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	"github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// statusCli answers all raw CC requests with given status
+type statusCli struct {
+	FakeCli
+	status int
+}
+
+func (self *statusCli) DoRequest(r *cfclient.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: self.status,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"errors": []}`)),
+	}, nil
+}
+
+// orgLangCli answers v3 organization and role listings, recording the
+// requested paths
+type orgLangCli struct {
+	FakeCli
+	langs map[string]string
+	roles []roleFixture
+	paths []string
+	path  string
+}
+
+func (self *orgLangCli) NewRequest(method, path string) *cfclient.Request {
+	self.path = path
+	self.paths = append(self.paths, path)
+	return &cfclient.Request{}
+}
+
+func (self *orgLangCli) ListUsersByQuery(url.Values) (cfclient.Users, error) {
+	Fail("organization users must not be listed")
+	return nil, nil
+}
+
+func (self *orgLangCli) DoRequest(r *cfclient.Request) (*http.Response, error) {
+	lUrl, lErr := url.Parse(self.path)
+	Expect(lErr).To(BeNil())
+
+	lItems := []interface{}{}
+	switch lUrl.Path {
+	case "/v3/organizations":
+		for _, cID := range strings.Split(lUrl.Query().Get("guids"), ",") {
+			lItems = append(lItems, map[string]interface{}{
+				"guid":     cID,
+				"metadata": map[string]interface{}{"annotations": map[string]string{"lang": self.langs[cID]}},
+			})
+		}
+	case "/v3/roles":
+		lOrgs := strings.Split(lUrl.Query().Get("organization_guids"), ",")
+		for _, cRole := range self.roles {
+			if contains(lOrgs, cRole.Org) {
+				lItems = append(lItems, map[string]interface{}{
+					"type": cRole.Type,
+					"relationships": map[string]interface{}{
+						"user":         map[string]interface{}{"data": map[string]string{"guid": cRole.User}},
+						"organization": map[string]interface{}{"data": map[string]string{"guid": cRole.Org}},
+					},
+				})
+			}
+		}
+	default:
+		Fail("unexpected request " + self.path)
+	}
+
+	lBody, lErr := json.Marshal(map[string]interface{}{
+		"pagination": map[string]interface{}{"next": nil},
+		"resources":  lItems,
+	})
+	Expect(lErr).To(BeNil())
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(string(lBody))),
+	}, nil
+}
+
+var _ = Describe("Language", func() {
+	lPrefs := map[string]Preference{
+		"user-pref":  Preference{Language: "de"},
+		"user-empty": Preference{Language: ""},
+	}
+	lOrgLangs := map[string]string{
+		"user-pref":  "es",
+		"user-empty": "it",
+		"user-org":   "fr",
+	}
+
+	lCases := []struct {
+		Name string
+		Id   string
+		Lang string
+	}{
+		{"prefers stored preference over organization annotation", "user-pref", "de"},
+		{"uses organization annotation without preference language", "user-empty", "it"},
+		{"uses organization annotation without preference", "user-org", "fr"},
+		{"falls back to default language", "user-none", "en"},
+		{"uses default language for users unknown from UAA", "", "en"},
+	}
+
+	for _, cCase := range lCases {
+		lCase := cCase
+		It(lCase.Name, func() {
+			Expect(UserLanguage(lCase.Id, lPrefs, lOrgLangs, "en")).To(Equal(lCase.Lang))
+		})
+	}
+
+	It("ignores organization metadata of failed CC responses", func() {
+		lMeta, lErr := core.GetV3Metadata(&statusCli{status: 404}, "organizations", "org-1")
+		Expect(lErr).NotTo(BeNil())
+		Expect(lMeta).To(BeNil())
+	})
+
+	It("reads languages of all targeted organizations at once", func() {
+		lCli := &orgLangCli{
+			langs: map[string]string{"org-fr": "fr", "org-de": "de_DE", "org-none": ""},
+			roles: []roleFixture{
+				{"organization_user", "user-fr", "org-fr", ""},
+				{"organization_manager", "user-fr", "org-fr", ""},
+				{"organization_user", "user-both", "org-de", ""},
+				{"organization_user", "user-both", "org-fr", ""},
+				{"organization_user", "user-other", "org-fr", ""},
+			},
+		}
+		lCtx := NewTargetCtx(lCli)
+		lCtx.Config = &core.AppConfig{LangAnnotation: "lang"}
+		lCtx.ResData.Orgs = []string{"org-de", "org-none", "org-fr"}
+
+		lLangs := lCtx.GetOrgLanguages(map[string]bool{"user-fr": true, "user-both": true})
+		Expect(lLangs).To(Equal(map[string]string{"user-fr": "fr", "user-both": "de-de"}))
+		Expect(lCli.paths).To(HaveLen(2))
+	})
+})
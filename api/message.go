@@ -1,6 +1,7 @@
 package api
 
 import "fmt"
+import "time"
 import "strings"
 import "encoding/json"
 import "errors"
@@ -9,29 +10,55 @@ import "net/url"
 import "net/mail"
 import "github.com/cloudfoundry-community/go-cfclient"
 import "github.com/gorilla/mux"
-import "github.com/golang-commonmark/markdown"
 import log "github.com/sirupsen/logrus"
 import "gopkg.in/gomail.v2"
+import "github.com/orange-cloudfoundry/cf-wall/chat"
 import "github.com/orange-cloudfoundry/cf-wall/core"
+import "github.com/orange-cloudfoundry/cf-wall/sms"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
 import "sync"
 
+const testTag = "[TEST]"
+
 //MessageReqCtx --
 type MessageReqCtx struct {
 	CCCli          core.CFClient
 	UserMails      map[string]string
+	UserPhones     map[string]string
 	ReqData        MessageRequest
 	ResData        MessageResponse
 	NbMaxGetParams int
-
-	apps   []cfclient.App
-	spaces []string
+	Config         *core.AppConfig
+
+	apps       []cfclient.App
+	spaces     []string
+	impacts    map[string][]Impact
+	recipients map[string]bool
+	orgRoles   []string
+	spaceRoles []string
 }
 
 //MessageHandler --
 type MessageHandler struct {
 	UaaCli *core.UaaCli
 	Config *core.AppConfig
+	Store  *core.Store
 	queue  chan *gomail.Message
+	chats  chan *chat.Post
+	sms    chan *sms.Message
+	hooks  *WebhookHandler
+	layout *cfmail.Layout
+	drafts sync.Mutex
+	audits sync.Mutex
+
+	deliveries map[string]*delivery
+	mails      map[*gomail.Message]string
+	dlock      sync.Mutex
+
+	// CCCreator creates CC clients acting on behalf of request callers
+	CCCreator func(*http.Request) core.CFClient
+	scopes    map[string]*callerScopes
+	slock     sync.Mutex
 }
 
 // RecipientsRequest --
@@ -40,35 +67,93 @@ type RecipientsRequest struct {
 	Spaces     []string `json:"spaces"`
 	Orgs       []string `json:"orgs"`
 	Services   []string `json:"services"`
+	Plans      []string `json:"service_plans"`
+	Brokers    []string `json:"service_brokers"`
 	BuildPacks []string `json:"buildpacks"`
+	Stacks     []string `json:"stacks"`
 	Recipients []string `json:"recipients"`
+	OrgRoles   []string `json:"org_roles"`
+	SpaceRoles []string `json:"space_roles"`
+
+	DeprecatedPlans   bool               `json:"deprecated_plans"`
+	Apps              *AppFilter         `json:"apps,omitempty"`
+	BuildPackVersions []BuildpackVersion `json:"buildpack_versions,omitempty"`
 }
 
 //MessageRequest --
 type MessageRequest struct {
 	RecipientsRequest
-	Subject string `json:"subject"`
-	Message string `json:"message"`
+	Subject  string            `json:"subject"`
+	Message  string            `json:"message"`
+	Summary  string            `json:"summary"`
+	Subjects map[string]string `json:"subjects"`
+	Messages map[string]string `json:"messages"`
+	Severity string            `json:"severity"`
+	Sender   string            `json:"sender"`
+	Category string            `json:"category"`
+	Channels []string          `json:"channels"`
+
+	DisplayStart *time.Time `json:"display_start,omitempty"`
+	DisplayEnd   *time.Time `json:"display_end,omitempty"`
+
+	Test           bool     `json:"test"`
+	TestRecipients []string `json:"test_recipients"`
 }
 
 // RecipientsResponse --
 type RecipientsResponse struct {
-	Recipients []string `json:"recipients"`
+	Recipients  []string            `json:"recipients"`
+	Impacts     map[string][]Impact `json:"impacts,omitempty"`
+	Languages   map[string]string   `json:"languages,omitempty"`
+	Duplicates  int                 `json:"duplicates"`
+	Suppressed  map[string]string   `json:"suppressed,omitempty"`
+	OptedOut    int                 `json:"opted_out"`
+	MatchedApps int                 `json:"matched_apps,omitempty"`
+	Chats       []chat.Target       `json:"chats,omitempty"`
+	Orgs        []string            `json:"orgs,omitempty"`
+	Spaces      []string            `json:"spaces,omitempty"`
+	Phones      []string            `json:"phones,omitempty"`
 }
 
 //MessageResponse --
 type MessageResponse struct {
 	RecipientsResponse
-	Subject string `json:"subject"`
-	Message string `json:"message"`
-	From    string `json:"from"`
+	Subject  string            `json:"subject"`
+	Message  string            `json:"message"`
+	Markdown string            `json:"markdown,omitempty"`
+	Summary  string            `json:"summary,omitempty"`
+	Subjects map[string]string `json:"subjects,omitempty"`
+	Messages map[string]string `json:"messages,omitempty"`
+	Severity string            `json:"severity,omitempty"`
+	From     string            `json:"from"`
+	ReplyTo  string            `json:"reply_to,omitempty"`
+	Sender   string            `json:"sender,omitempty"`
+	Category string            `json:"category,omitempty"`
+	Channels []string          `json:"channels,omitempty"`
+}
+
+// SenderResponse --
+type SenderResponse struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// RenderResponse --
+type RenderResponse struct {
+	Html string `json:"html"`
 }
 
 // NewMessageHandler --
 func NewMessageHandler(
 	pConf *core.AppConfig,
 	pRouter *mux.Router,
-	pQueue chan *gomail.Message) (*MessageHandler, error) {
+	pStore *core.Store,
+	pMailer *cfmail.MailHandler,
+	pChat *chat.Notifier,
+	pSms *sms.Gateway,
+	pHooks *WebhookHandler) (*MessageHandler, error) {
 
 	cli, err := core.NewUaaCli(pConf)
 	if err != nil {
@@ -76,11 +161,31 @@ func NewMessageHandler(
 		return nil, err
 	}
 
+	if err := checkSenders(pConf.MailSenders); err != nil {
+		log.WithError(err).Error("invalid mail-senders configuration")
+		return nil, err
+	}
+
+	if err := checkChatChannels(pConf.ChatChannels); err != nil {
+		log.WithError(err).Error("invalid chat-channels configuration")
+		return nil, err
+	}
+
 	obj := MessageHandler{
 		UaaCli: cli,
 		Config: pConf,
-		queue:  pQueue,
+		Store:  pStore,
+		queue:  pMailer.Queue,
+		chats:  pChat.Queue,
+		sms:    pSms.Queue,
+		hooks:  pHooks,
+		layout: pMailer.Layout,
+
+		deliveries: make(map[string]*delivery),
+		mails:      make(map[*gomail.Message]string),
+		scopes:     make(map[string]*callerScopes),
 	}
+	obj.CCCreator = obj.createCli
 
 	pRouter.Path("/v1/message").
 		HandlerFunc(core.DecorateHandler(obj.handleMessage)).
@@ -97,10 +202,43 @@ func NewMessageHandler(
 		HeadersRegexp("Content-Type", "application/json.*").
 		Methods("POST")
 
+	pRouter.Path("/v1/preview").
+		HandlerFunc(core.DecorateHandler(obj.handlePreview)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+
+	pRouter.Path("/v1/senders").
+		HandlerFunc(core.DecorateHandler(obj.handleSenders)).
+		Methods("GET")
+
+	pRouter.Path("/v1/render").
+		HandlerFunc(core.DecorateHandler(obj.handleRender)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+
+	pMailer.OnResult = obj.onDelivery
+	schedulePruning(obj.pruneAudit)
+
+	obj.registerDrafts(pRouter)
+	obj.registerAudit(pRouter)
+	obj.registerFeeds(pRouter)
+	obj.registerAnnouncements(pRouter)
+	obj.registerAdvisories(pRouter)
 	return &obj, nil
 }
 
-func (m *MessageHandler) createCtx(pUsers map[string]string, pReq *http.Request) (*MessageReqCtx, error) {
+func (m *MessageHandler) createCtx(pUsers map[string]string, pPhones map[string]string, pReq *http.Request) (*MessageReqCtx, error) {
+	data := MessageRequest{}
+	decoder := json.NewDecoder(pReq.Body)
+	err := decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	return m.buildCtx(pUsers, pPhones, pReq, data)
+}
+
+// buildCtx creates message context of given request data
+func (m *MessageHandler) buildCtx(pUsers map[string]string, pPhones map[string]string, pReq *http.Request, pData MessageRequest) (*MessageReqCtx, error) {
 	cccli, err := core.NewCCCliFromRequest(m.Config.CCEndPoint, pReq, m.Config.CCSkipVerify)
 	if err != nil {
 		log.WithError(err).Error("unable to create CC client")
@@ -110,77 +248,111 @@ func (m *MessageHandler) createCtx(pUsers map[string]string, pReq *http.Request)
 	ctx := MessageReqCtx{
 		CCCli:           cccli,
 		UserMails:       pUsers,
+		UserPhones:      pPhones,
 		NbMaxGetParams : m.Config.NbMaxGetParams,
-		ReqData:         MessageRequest{},
+		Config:          m.Config,
+		ReqData:         pData,
 		ResData:         MessageResponse{},
 	}
 
-	decoder := json.NewDecoder(pReq.Body)
-	err = decoder.Decode(&ctx.ReqData)
-	if err != nil {
-		return nil, err
-	}
-
-	ctx.setFrom(m.Config.MailFrom)
+	ctx.setFrom(ctx.ReqData.Sender)
 	ctx.setSubject(ctx.ReqData.Subject, m.Config.MailTag)
 	ctx.addRecipents(m.Config.MailCc)
 	ctx.addRecipents(ctx.ReqData.Recipients)
 	ctx.setBody(ctx.ReqData.Message)
+	ctx.ResData.Summary = ctx.ReqData.Summary
+	ctx.setTranslations(m.Config.MailTag)
+	ctx.setSeverity(ctx.ReqData.Severity)
+	ctx.setCategory(ctx.ReqData.Category)
+	ctx.setChannels(ctx.ReqData.Channels)
+	ctx.setRoles(ctx.ReqData.OrgRoles, ctx.ReqData.SpaceRoles)
+	ctx.setAppFilter(ctx.ReqData.Apps)
+	ctx.setBuildpackVersions(ctx.ReqData.BuildPackVersions)
+	ctx.setDisplay(ctx.ReqData.DisplayStart, ctx.ReqData.DisplayEnd)
 	return &ctx, nil
 }
 
-func (m *MessageHandler) getUaaUsers() (map[string]string, error) {
+// getUaaUsers returns addresses and phone numbers of UAA users, indexed by
+// user guid
+func (m *MessageHandler) getUaaUsers() (map[string]string, map[string]string, error) {
 	res := make(map[string]string, 0)
+	phones := make(map[string]string, 0)
 	log.Debug("reading UAA users")
 	users, err := m.UaaCli.GetUserList()
 
 	if err != nil {
 		log.WithError(err).Error("unable to featch UAA users")
-		return res, err
+		return res, phones, err
 	}
 	for _, cEl := range users {
-		_, err := mail.ParseAddress(cEl.Email)
+		addr, err := cfmail.NormalizeAddress(cEl.Email)
 		if err == nil {
-			res[cEl.Id] = cEl.Email
+			res[cEl.Id] = addr
+		}
+		if "" != cEl.Phone {
+			phones[cEl.Id] = cEl.Phone
 		}
 	}
-	return res, nil
+	return res, phones, nil
 }
 
-func (m *MessageHandler) getRecipients(pReq *http.Request) (*MessageResponse, error) {
-	users, err := m.getUaaUsers()
+// newCtx creates message context from request payload, without resolving
+// targeted recipients
+func (m *MessageHandler) newCtx(pReq *http.Request) (*MessageReqCtx, error) {
+	users, phones, err := m.getUaaUsers()
 	if err != nil {
 		return nil, err
 	}
+	return m.createCtx(users, phones, pReq)
+}
+
+// readRecipients resolves recipients targeted by context request
+func (m *MessageHandler) readRecipients(pCtx *MessageReqCtx) {
+	pCtx.addOrgs(pCtx.ReqData.Orgs)
+	pCtx.addSpaces(pCtx.ReqData.Spaces)
+	pCtx.addBuidPacks(pCtx.ReqData.BuildPacks)
+	pCtx.addBuildpackVersions(pCtx.ReqData.BuildPackVersions)
+	pCtx.addStacks(pCtx.ReqData.Stacks)
+	pCtx.addApps(pCtx.ReqData.Apps)
+	pCtx.addServices(pCtx.ReqData.Services)
+	pCtx.addBrokers(pCtx.ReqData.Brokers)
+	pCtx.addServicePlans(pCtx.ReqData.Plans, pCtx.ReqData.DeprecatedPlans)
+	pCtx.addUsers(pCtx.ReqData.Users)
+	pCtx.readSpaces()
+	pCtx.readTargets()
+	pCtx.readChats()
+	pCtx.applySuppressions(getSuppressions(m.Store))
+	prefs := getPreferences(m.Store)
+	pCtx.readPhones(prefs)
+	pCtx.applyCategory(prefs, "email")
+	pCtx.checkChats()
+	pCtx.readImpacts()
+	pCtx.readLanguages(prefs)
+}
 
-	ctx, err := m.createCtx(users, pReq)
+func (m *MessageHandler) getRecipients(pReq *http.Request) (*MessageResponse, error) {
+	ctx, err := m.newCtx(pReq)
 	if err != nil {
 		return nil, err
 	}
-
-	ctx.addOrgs(ctx.ReqData.Orgs)
-	ctx.addSpaces(ctx.ReqData.Spaces)
-	ctx.addBuidPacks(ctx.ReqData.BuildPacks)
-	ctx.addServices(ctx.ReqData.Services)
-	ctx.addUsers(ctx.ReqData.Users)
-	ctx.readSpaces()
-
+	m.readRecipients(ctx)
 	return &ctx.ResData, nil
 }
 
 func (m *MessageHandler) handleMessage(pRes http.ResponseWriter, pReq *http.Request) {
-	data, err := m.getRecipients(pReq)
+	ctx, err := m.newCtx(pReq)
 	if err != nil {
 		panic(core.NewHttpError(err, 500, 51))
 	}
 
-	m.sendMessages(
-		data.From,
-		data.Recipients,
-		data.Subject,
-		data.Message)
+	if ctx.ReqData.Test {
+		m.sendTest(ctx, pReq)
+		pRes.WriteHeader(204)
+		return
+	}
 
-	pRes.WriteHeader(204)
+	m.readRecipients(ctx)
+	m.dispatch(pRes, pReq, ctx, AuditMessage)
 }
 
 func (m *MessageHandler) handleRecipients(pRes http.ResponseWriter, pReq *http.Request) {
@@ -188,50 +360,245 @@ func (m *MessageHandler) handleRecipients(pRes http.ResponseWriter, pReq *http.R
 	if err != nil {
 		panic(core.NewHttpError(err, 500, 51))
 	}
-	core.WriteJson(pRes, data.RecipientsResponse)
+	core.WriteJson(pRes, data.RecipientsResponse.public())
 }
 
 func (m *MessageHandler) handleMessageAll(pRes http.ResponseWriter, pReq *http.Request) {
-	users, err := m.getUaaUsers()
+	users, phones, err := m.getUaaUsers()
 	if err != nil {
 		panic(core.NewHttpError(err, 500, 51))
 	}
 
-	ctx, err := m.createCtx(users, pReq)
+	ctx, err := m.createCtx(users, phones, pReq)
 	if err != nil {
 		panic(core.NewHttpError(err, 500, 50))
 	}
+	if ctx.ReqData.Test {
+		m.sendTest(ctx, pReq)
+		pRes.WriteHeader(204)
+		return
+	}
+
 	ctx.addAlusers()
+	ctx.readAllChats()
+	ctx.applySuppressions(getSuppressions(m.Store))
+	prefs := getPreferences(m.Store)
+	ctx.readPhones(prefs)
+	ctx.applyCategory(prefs, "email")
+	ctx.checkChats()
+	ctx.readLanguages(prefs)
+	m.dispatch(pRes, pReq, ctx, AuditMessageAll)
+	//core.WriteJson(pRes, ctx.ResData)
+}
+
+func (m *MessageHandler) handleSenders(pRes http.ResponseWriter, pReq *http.Request) {
+	res := make([]SenderResponse, 0, len(m.Config.MailSenders))
+	for _, cSender := range m.Config.MailSenders {
+		res = append(res, SenderResponse{
+			Id:      cSender.Id,
+			Name:    cSender.Name,
+			Address: cSender.Address,
+			ReplyTo: cSender.ReplyTo,
+		})
+	}
+	core.WriteJson(pRes, res)
+}
+
+func (m *MessageHandler) handleRender(pRes http.ResponseWriter, pReq *http.Request) {
+	data := struct {
+		Message string `json:"message"`
+	}{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&data); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
 
-	m.sendMessages(
-		ctx.ResData.From,
-		ctx.ResData.Recipients,
-		ctx.ResData.Subject,
-		ctx.ResData.Message)
+	core.WriteJson(pRes, RenderResponse{renderMarkdown(data.Message)})
+}
 
-	pRes.WriteHeader(204)
-	//core.WriteJson(pRes, ctx.ResData)
+// sendMessages enqueues mails, chat posts and sms of given message, mails
+// being tracked as belonging to pID. All mails are built before
+// anything is sent so that a rendering failure sends nothing
+func (m *MessageHandler) sendMessages(pData *MessageResponse, pID string) {
+	msgs := []*gomail.Message{}
+	if pData.sendsOn("email") {
+		var err error
+		if msgs, err = m.buildMessages(pData); err != nil {
+			panic(core.NewHttpError(err, 500, 55))
+		}
+	}
+
+	m.trackMails(pID, msgs)
+	for _, cMsg := range msgs {
+		m.queue <- cMsg
+	}
+	if pData.sendsOn("chat") {
+		m.sendChats(pData)
+	}
+	if pData.sendsOn("sms") {
+		m.sendSms(pData)
+	}
 }
 
-func (m *MessageHandler) sendMessages(
-	pFrom string,
-	pTo []string,
-	pSub string,
-	pBody string) {
+// sendTest sends message marked as test to the given test recipients only,
+// or to the caller when none are given, targeted audience, chat channels
+// and sms being ignored
+func (m *MessageHandler) sendTest(pCtx *MessageReqCtx, pReq *http.Request) {
+	pCtx.resetRecipients()
+	pCtx.ResData.Languages = nil
+	pCtx.ResData.Impacts = nil
+	pCtx.ResData.Channels = nil
+	pCtx.ResData.Chats = nil
+	pCtx.ResData.Phones = nil
+
+	// test lists would otherwise bypass approval
+	if 0 != len(pCtx.ReqData.TestRecipients) && m.Config.ApprovalRequired {
+		err := errors.New("test recipients are not allowed when approval is required")
+		panic(core.NewHttpError(err, 400, 40))
+	}
 
-	for _, cDest := range pTo {
-		msg := gomail.NewMessage()
-		msg.SetHeader("From", pFrom)
-		msg.SetHeader("To", cDest)
-		msg.SetHeader("Subject", pSub)
-		msg.SetHeader("Auto-submitted", "auto-generated")
-		msg.SetBody("text/html", pBody)
-		m.queue <- msg
+	if 0 != len(pCtx.ReqData.TestRecipients) {
+		pCtx.addRecipents(pCtx.ReqData.TestRecipients)
+	} else {
+		caller := getCaller(m.UaaCli, pReq)
+		if "" == caller.Email {
+			err := errors.New("no email address found for caller")
+			panic(core.NewHttpError(err, 400, 40))
+		}
+		pCtx.addRecipents([]string{caller.Email})
+		if pref, ok := getPreferences(m.Store)[caller.Id]; ok && "" != pref.Language {
+			pCtx.ResData.Languages = map[string]string{pCtx.ResData.Recipients[0]: pref.Language}
+		}
 	}
+
+	pCtx.setTest()
+	log.WithFields(log.Fields{
+		"recipients": pCtx.ResData.Recipients,
+	}).Info("sending test message")
+	m.deliver(m.newAudit(pReq, pCtx, AuditTest), &pCtx.ResData)
 }
 
-func (m *MessageReqCtx) setFrom(pFrom string) {
-	m.ResData.From = pFrom
+// mailParts are the html and plain text bodies of a mail
+type mailParts struct {
+	Html string
+	Text string
+}
+
+// renderMessage returns html and plain text bodies of mail sent to given
+// recipient, html body being wrapped into the configured layout
+func (m *MessageHandler) renderMessage(pData *MessageResponse, pDest string) (mailParts, error) {
+	body := pData.getBody(pDest)
+	html, err := m.layout.Render(pData.getSubject(pDest), body, pData.Severity)
+	if err != nil {
+		return mailParts{}, err
+	}
+	return mailParts{html, m.layout.RenderText(body, pData.Severity)}, nil
+}
+
+// buildMessages creates mails of all recipients of given message. Recipients
+// reading the same subject and body share their rendered parts, the layout
+// being rendered and inlined once per language and impact list
+func (m *MessageHandler) buildMessages(pData *MessageResponse) ([]*gomail.Message, error) {
+	res := make([]*gomail.Message, 0, len(pData.Recipients))
+	rendered := make(map[string]mailParts)
+	for _, cDest := range pData.Recipients {
+		key := pData.getSubject(cDest) + "\x00" + pData.getBody(cDest)
+		parts, ok := rendered[key]
+		if !ok {
+			var err error
+			if parts, err = m.renderMessage(pData, cDest); err != nil {
+				return nil, err
+			}
+			rendered[key] = parts
+		}
+		res = append(res, buildMessage(pData, cDest, parts))
+	}
+	return res, nil
+}
+
+// buildMessage creates mail sent to given recipient, with a plain text part
+// and its html alternative
+func buildMessage(pData *MessageResponse, pDest string, pParts mailParts) *gomail.Message {
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", pData.From)
+	if "" != pData.Sender {
+		msg.SetHeader("Sender", pData.Sender)
+	}
+	if "" != pData.ReplyTo {
+		msg.SetHeader("Reply-To", pData.ReplyTo)
+	}
+	msg.SetHeader("To", pDest)
+	msg.SetHeader("Subject", pData.getSubject(pDest))
+	msg.SetHeader("Auto-submitted", "auto-generated")
+	msg.SetBody("text/plain", pParts.Text)
+	msg.AddAlternative("text/html", pParts.Html)
+	return msg
+}
+
+// getBody returns message body for given recipient, including the list
+// of its impacted resources if any
+func (m *MessageResponse) getBody(pDest string) string {
+	body := selectLanguage(m.Messages, m.Languages[pDest], m.Message)
+	return body + renderImpacts(m.Impacts[pDest])
+}
+
+// getSubject returns message subject in the language of given recipient
+func (m *MessageResponse) getSubject(pDest string) string {
+	return selectLanguage(m.Subjects, m.Languages[pDest], m.Subject)
+}
+
+// setFrom sets message origin to the configured sender identity of given
+// id, or to the default mail-from address when empty. Sender header is set
+// to the default address when sending on behalf of another identity
+func (m *MessageReqCtx) setFrom(pSenderID string) {
+	m.ResData.From = m.Config.MailFrom
+	m.ResData.ReplyTo = m.Config.MailReplyTo
+	if "" == pSenderID {
+		return
+	}
+
+	sender := findSender(m.Config.MailSenders, pSenderID)
+	if sender == nil {
+		err := fmt.Errorf("unknown sender '%s'", pSenderID)
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	addr := mail.Address{Name: sender.Name, Address: sender.Address}
+	m.ResData.From = addr.String()
+	if "" != sender.ReplyTo {
+		m.ResData.ReplyTo = sender.ReplyTo
+	}
+	if sender.Address != m.Config.MailFrom {
+		m.ResData.Sender = m.Config.MailFrom
+	}
+}
+
+func findSender(pSenders []core.MailSender, pID string) *core.MailSender {
+	for cIdx := range pSenders {
+		if pSenders[cIdx].Id == pID {
+			return &pSenders[cIdx]
+		}
+	}
+	return nil
+}
+
+// checkSenders validates addresses of configured sender identities
+func checkSenders(pSenders []core.MailSender) error {
+	for _, cSender := range pSenders {
+		if "" == cSender.Id {
+			return fmt.Errorf("missing id for sender '%s'", cSender.Address)
+		}
+		if _, err := mail.ParseAddress(cSender.Address); err != nil {
+			return fmt.Errorf("invalid address '%s' for sender '%s'", cSender.Address, cSender.Id)
+		}
+		if "" == cSender.ReplyTo {
+			continue
+		}
+		if _, err := mail.ParseAddress(cSender.ReplyTo); err != nil {
+			return fmt.Errorf("invalid reply-to '%s' for sender '%s'", cSender.ReplyTo, cSender.Id)
+		}
+	}
+	return nil
 }
 
 func (m *MessageReqCtx) setSubject(pSub string, pTag string) {
@@ -241,22 +608,64 @@ func (m *MessageReqCtx) setSubject(pSub string, pTag string) {
 	}
 }
 
+// setTest marks subjects of all languages as test
+func (m *MessageReqCtx) setTest() {
+	m.ResData.Subject = fmt.Sprintf("%s %s", testTag, m.ResData.Subject)
+	for cLang, cSub := range m.ResData.Subjects {
+		m.ResData.Subjects[cLang] = fmt.Sprintf("%s %s", testTag, cSub)
+	}
+}
+
+func (m *MessageReqCtx) setSeverity(pSeverity string) {
+	if "" != pSeverity && !cfmail.IsSeverity(pSeverity) {
+		err := fmt.Errorf("invalid severity '%s', must be one of %s",
+			pSeverity, strings.Join(cfmail.Severities, ", "))
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	m.ResData.Severity = pSeverity
+}
+
 func (m *MessageReqCtx) addRecipents(pList []string) {
 	for _, cItem := range pList {
-		_, err := mail.ParseAddress(cItem)
+		addr, err := cfmail.NormalizeAddress(cItem)
 		if err != nil {
 			uerr := fmt.Errorf("invalid email address '%s'", cItem)
 			log.WithError(err).Error(uerr.Error())
 			panic(core.NewHttpError(uerr, 500, 51))
 		}
-		m.ResData.Recipients = append(m.ResData.Recipients, cItem)
+		m.addRecipient(addr)
+	}
+}
+
+// addRecipient adds given normalized address to recipients unless its
+// mailbox is already present, counting removed duplicates
+func (m *MessageReqCtx) addRecipient(pAddr string) {
+	if m.recipients == nil {
+		m.recipients = make(map[string]bool)
+	}
+	key := cfmail.AddressKey(pAddr)
+	if m.recipients[key] {
+		m.ResData.Duplicates += 1
+		return
 	}
+	m.recipients[key] = true
+	m.ResData.Recipients = append(m.ResData.Recipients, pAddr)
+}
+
+// resetRecipients --
+func (m *MessageReqCtx) resetRecipients() {
+	m.recipients = nil
+	m.ResData.Recipients = nil
+	m.ResData.Duplicates = 0
 }
 
 func (m *MessageReqCtx) setBody(pMarkdown string) {
-	mk := markdown.New(markdown.XHTMLOutput(true), markdown.Nofollow(true))
-	html := mk.RenderToString([]byte(pMarkdown))
-	m.ResData.Message = html
+	m.ResData.Message = renderMarkdown(pMarkdown)
+	m.ResData.Markdown = pMarkdown
+}
+
+func renderMarkdown(pMarkdown string) string {
+	return cfmail.RenderMarkdown(pMarkdown)
 }
 
 func (m *MessageReqCtx) addSpaces(pSpaces []string) {
@@ -283,26 +692,74 @@ func (m *MessageReqCtx) addBuidPacks(pBps []string) {
 			_, ok := needles[pApp.DetectedBuildpackGuid]
 			if ok {
 				m.addSpace(pApp.SpaceGuid)
+				m.addImpact(pApp.SpaceGuid, "application", pApp.Name)
 			}
 		}
 	})
 }
 
+func (m *MessageReqCtx) addStacks(pStacks []string) {
+	if len(pStacks) == 0 {
+		return
+	}
+
+	needles := map[string]bool{}
+	for _, cStack := range pStacks {
+		needles[cStack] = true
+	}
+
+	// build targeted spaces from application stacks
+	m.mapApps(func(pApp *cfclient.App) {
+		if needles[pApp.StackGuid] {
+			m.addSpace(pApp.SpaceGuid)
+			m.addImpact(pApp.SpaceGuid, "application", pApp.Name)
+		}
+	})
+}
+
 func (m *MessageReqCtx) addOrgs(pOrgs []string) {
 	if len(pOrgs) == 0 {
 		return
 	}
 
+	if 0 != len(m.orgRoles) {
+		m.addUsers(m.getRolesUsers("organization", pOrgs, m.orgRoles))
+		return
+	}
+
 	users := m.getOrgsUsers(pOrgs)
 	for _, cEl := range users {
 		m.addUser(cEl.Guid)
 	}
 }
 
+// readTargets computes spaces reached by targets, and organizations reached
+// either directly or through one of their spaces
+func (m *MessageReqCtx) readTargets() {
+	seen := make(map[string]bool)
+	orgs := append([]string{}, m.ReqData.Orgs...)
+	if 0 != len(m.spaces) {
+		for _, cSpace := range m.getSpacesByGuid(m.spaces) {
+			orgs = append(orgs, cSpace.OrganizationGuid)
+			m.ResData.Spaces = append(m.ResData.Spaces, cSpace.Guid)
+		}
+	}
+	for _, cID := range orgs {
+		if !seen[cID] {
+			seen[cID] = true
+			m.ResData.Orgs = append(m.ResData.Orgs, cID)
+		}
+	}
+}
+
 func (m *MessageReqCtx) readSpaces() {
 	if 0 == len(m.spaces) {
 		return
 	}
+	if 0 != len(m.spaceRoles) {
+		m.addUsers(m.getRolesUsers("space", m.spaces, m.spaceRoles))
+		return
+	}
 	users := m.getSpacesUsers(m.spaces)
 	for _, cEl := range users {
 		m.addUser(cEl.Guid)
@@ -321,13 +778,13 @@ func (m *MessageReqCtx) addUsers(pUsers []string) {
 func (m *MessageReqCtx) addUser(pGUID string) {
 	mail, ok := m.UserMails[pGUID]
 	if ok {
-		m.ResData.Recipients = append(m.ResData.Recipients, mail)
+		m.addRecipient(mail)
 	}
 }
 
 func (m *MessageReqCtx) addAlusers() {
 	for _, cMail := range m.UserMails {
-		m.ResData.Recipients = append(m.ResData.Recipients, cMail)
+		m.addRecipient(cMail)
 	}
 }
 
@@ -343,25 +800,108 @@ func (m *MessageReqCtx) addServices(pGuids []string) {
 	}
 
 	// 2. search instances matching services
+	m.addInstances(func(pInst *cfclient.ServiceInstance) bool {
+		return services[pInst.ServiceGuid]
+	})
+}
+
+// addBrokers targets instances of all services offered by given brokers,
+// including space scoped brokers
+func (m *MessageReqCtx) addBrokers(pGuids []string) {
+	if 0 == len(pGuids) {
+		return
+	}
+
+	brokers := map[string]bool{}
+	for _, cID := range pGuids {
+		brokers[cID] = true
+	}
+
+	log.WithFields(log.Fields{"brokers": pGuids}).
+		Debug("reading services of brokers")
+	services, err := m.CCCli.ListServices()
+	if err != nil {
+		uerr := errors.New("unable to fetch services from CC api")
+		log.WithError(err).Error(uerr.Error())
+		panic(core.NewHttpError(err, 500, 50))
+	}
+
+	guids := []string{}
+	for _, cService := range services {
+		if brokers[cService.ServiceBrokerGuid] {
+			guids = append(guids, cService.Guid)
+		}
+	}
+	m.addServices(guids)
+}
+
+// addServicePlans targets instances of given service plans, along with the
+// deprecated plans when requested
+func (m *MessageReqCtx) addServicePlans(pGuids []string, pDeprecated bool) {
+	plans := map[string]bool{}
+	for _, cID := range pGuids {
+		plans[cID] = true
+	}
+	if pDeprecated {
+		for _, cID := range m.getDeprecatedPlans() {
+			plans[cID] = true
+		}
+	}
+	if 0 == len(plans) {
+		return
+	}
+
+	m.addInstances(func(pInst *cfclient.ServiceInstance) bool {
+		return plans[pInst.ServicePlanGuid]
+	})
+}
+
+// getDeprecatedPlans returns guids of service plans which are either
+// inactive or not public
+func (m *MessageReqCtx) getDeprecatedPlans() []string {
+	log.Debug("reading service plans")
+
+	query := url.Values{}
+	query.Set("results-per-page", "100")
+	plans, err := m.CCCli.ListServicePlansByQuery(query)
+	if err != nil {
+		uerr := errors.New("unable to fetch service plans from CC api")
+		log.WithError(err).Error(uerr.Error())
+		panic(core.NewHttpError(err, 500, 50))
+	}
+
+	res := []string{}
+	for cIdx := range plans {
+		if isPlanDeprecated(&plans[cIdx]) {
+			res = append(res, plans[cIdx].Guid)
+		}
+	}
+	return res
+}
+
+// addInstances targets spaces of service instances matching given filter and
+// spaces of applications bound to them
+func (m *MessageReqCtx) addInstances(pMatch func(*cfclient.ServiceInstance) bool) {
 	usedInst := make([]string, 0)
 	instances := m.getServiceInstances()
-	for _, cInst := range instances {
-		_, ok := services[cInst.ServiceGuid]
-		if ok {
-
+	for cIdx := range instances {
+		cInst := &instances[cIdx]
+		if pMatch(cInst) {
 			m.addSpace(cInst.SpaceGuid)
+			m.addImpact(cInst.SpaceGuid, "service instance", cInst.Name)
 			usedInst = append(usedInst, cInst.Guid)
 		}
 	}
 
-	// 3. get bindings from instances
+	// get bindings from instances
 	bindings := m.getServiceBindings(usedInst)
 
-	// 4. browse bindings to get application spaces
+	// browse bindings to get application spaces
 	for _, cBind := range bindings {
 		m.mapApps(func(pApp *cfclient.App) {
 			if pApp.Guid == cBind.AppGuid {
 				m.addSpace(pApp.SpaceGuid)
+				m.addImpact(pApp.SpaceGuid, "application", pApp.Name)
 			}
 		})
 	}
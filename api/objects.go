@@ -7,6 +7,7 @@ import "errors"
 import "github.com/gorilla/mux"
 import log "github.com/sirupsen/logrus"
 import "github.com/orange-cloudfoundry/cf-wall/core"
+import "github.com/cloudfoundry-community/go-cfclient"
 import "regexp"
 
 // Org --
@@ -34,12 +35,37 @@ type Buildpack struct {
 	ID   string `json:"guid"`
 }
 
+// Stack --
+type Stack struct {
+	Name        string `json:"name"`
+	ID          string `json:"guid"`
+	Description string `json:"description,omitempty"`
+}
+
 // Service --
 type Service struct {
 	Name string `json:"name"`
 	ID   string `json:"guid"`
 }
 
+// ServiceBroker --
+type ServiceBroker struct {
+	Name    string `json:"name"`
+	ID      string `json:"guid"`
+	SpaceID string `json:"space_guid,omitempty"`
+}
+
+// ServicePlan --
+type ServicePlan struct {
+	Name        string `json:"name"`
+	ID          string `json:"guid"`
+	ServiceID   string `json:"service_guid"`
+	Description string `json:"description,omitempty"`
+	Active      bool   `json:"active"`
+	Public      bool   `json:"public"`
+	Deprecated  bool   `json:"deprecated"`
+}
+
 // ObjectHandler --
 type ObjectHandler struct {
 	Config    *core.AppConfig
@@ -67,6 +93,12 @@ func NewObjectHandler(pConf *core.AppConfig, pRouter *mux.Router) *ObjectHandler
 		HandlerFunc(core.DecorateHandler(obj.getBuildpackRegexp))
 	pRouter.Path("/v1/services").
 		HandlerFunc(core.DecorateHandler(obj.getServices))
+	pRouter.Path("/v1/services/{guid}/plans").
+		HandlerFunc(core.DecorateHandler(obj.getServicePlans))
+	pRouter.Path("/v1/service_brokers").
+		HandlerFunc(core.DecorateHandler(obj.getServiceBrokers))
+	pRouter.Path("/v1/stacks").
+		HandlerFunc(core.DecorateHandler(obj.getStacks))
 
 	return &obj
 }
@@ -100,6 +132,83 @@ func (s *ObjectHandler) getServices(pRes http.ResponseWriter, pReq *http.Request
 	core.WriteJson(pRes, res)
 }
 
+func (s *ObjectHandler) getServiceBrokers(pRes http.ResponseWriter, pReq *http.Request) {
+	api := s.CCCreator(pReq)
+
+	log.Info("reading service brokers from CC api")
+	brokers, err := api.ListServiceBrokers()
+	if err != nil {
+		uerr := errors.New("unable to read service brokers from CC api")
+		log.WithError(err).Error(uerr.Error())
+		panic(core.NewHttpError(uerr, 500, 50))
+	}
+
+	res := []ServiceBroker{}
+	for _, cEl := range brokers {
+		elem := ServiceBroker{cEl.Name, cEl.Guid, cEl.SpaceGUID}
+		res = append(res, elem)
+	}
+	log.WithFields(log.Fields{"brokers": res}).
+		Debug("fetched service brokers from CC api")
+	core.WriteJson(pRes, res)
+}
+
+// isPlanDeprecated returns true when plan can no longer be provisioned by
+// all users
+func isPlanDeprecated(pPlan *cfclient.ServicePlan) bool {
+	return !pPlan.Active || !pPlan.Public
+}
+
+func (s *ObjectHandler) getServicePlans(pRes http.ResponseWriter, pReq *http.Request) {
+	vars := mux.Vars(pReq)
+	serviceID := vars["guid"]
+
+	api := s.CCCreator(pReq)
+
+	log.WithFields(log.Fields{
+		"service": serviceID,
+	}).Info("reading plans of service from CC api")
+	query := url.Values{}
+	query.Add("q", fmt.Sprintf("service_guid:%s", serviceID))
+	plans, err := api.ListServicePlansByQuery(query)
+	if err != nil {
+		uerr := errors.New("unable to read service plans from CC api")
+		log.WithError(err).Error(uerr.Error())
+		panic(core.NewHttpError(uerr, 500, 50))
+	}
+
+	res := []ServicePlan{}
+	for cIdx := range plans {
+		cEl := &plans[cIdx]
+		elem := ServicePlan{cEl.Name, cEl.Guid, cEl.ServiceGuid, cEl.Description, cEl.Active, cEl.Public, isPlanDeprecated(cEl)}
+		res = append(res, elem)
+	}
+	log.WithFields(log.Fields{"plans": res}).
+		Debug("fetched service plans from CC api")
+	core.WriteJson(pRes, res)
+}
+
+func (s *ObjectHandler) getStacks(pRes http.ResponseWriter, pReq *http.Request) {
+	api := s.CCCreator(pReq)
+
+	log.Info("reading stacks from CC api")
+	stacks, err := api.ListStacks()
+	if err != nil {
+		uerr := errors.New("unable to read stacks from CC api")
+		log.WithError(err).Error(uerr.Error())
+		panic(core.NewHttpError(uerr, 500, 50))
+	}
+
+	res := []Stack{}
+	for _, cEl := range stacks {
+		elem := Stack{cEl.Name, cEl.Guid, cEl.Description}
+		res = append(res, elem)
+	}
+	log.WithFields(log.Fields{"stacks": res}).
+		Debug("fetched stacks from CC api")
+	core.WriteJson(pRes, res)
+}
+
 func (s *ObjectHandler) getBuildpackRegexp(pRes http.ResponseWriter, pReq *http.Request) {
 	vars := mux.Vars(pReq)
 	re, err := regexp.Compile(vars["regexp"])
@@ -2,6 +2,8 @@ package api_test
 
 
 import (
+	"io/ioutil"
+	"strings"
 	"net/url"
 	"errors"
 	"net/http"
@@ -49,10 +51,27 @@ func (self *FakeCli) ListServices() ([]cfclient.Service, error) {
 		cfclient.Service{
 			Label: "service-1",
 			Guid: "2790478e-f500-43dd-93cf-6fa3c97292b9",
+			ServiceBrokerGuid: "8e1f2a3b-5c6d-4e7f-8a9b-0c1d2e3f4a5b",
 		},
 		cfclient.Service{
 			Label: "service-2",
 			Guid: "e7289425-e9c6-42ab-a6fc-a1729d0849ca",
+			ServiceBrokerGuid: "9f2a3b4c-6d7e-4f80-9bac-1d2e3f4a5b6c",
+		},
+	}, self.Error
+}
+
+func (self *FakeCli) ListServiceBrokers() ([]cfclient.ServiceBroker, error) {
+	return []cfclient.ServiceBroker{
+		cfclient.ServiceBroker{
+			Name: "broker-1",
+			Guid: "8e1f2a3b-5c6d-4e7f-8a9b-0c1d2e3f4a5b",
+			Password: "secret",
+		},
+		cfclient.ServiceBroker{
+			Name: "broker-2",
+			Guid: "9f2a3b4c-6d7e-4f80-9bac-1d2e3f4a5b6c",
+			SpaceGUID: "fc95a4c6-b07f-4b9b-871e-1f5d67b06071",
 		},
 	}, self.Error
 }
@@ -78,22 +97,109 @@ func (self *FakeCli) ListOrgs() ([]cfclient.Org, error) {
 	}, self.Error
 }
 
+func (self *FakeCli) ListOrgsByQuery(url.Values) ([]cfclient.Org, error) {
+	return []cfclient.Org{}, self.Error
+}
+
 func (self *FakeCli) ListSpacesByQuery(url.Values) ([]cfclient.Space, error) {
 	return []cfclient.Space{}, self.Error
 }
 
 func (self *FakeCli) ListAppsByQuery(url.Values) ([]cfclient.App, error) {
-	return []cfclient.App{}, self.Error
+	return []cfclient.App{
+		cfclient.App{
+			Name: "app-1",
+			Guid: "0b7c3d2e-1f4a-4b5c-8d6e-7f8a9b0c1d2e",
+			SpaceGuid: "fc95a4c6-b07f-4b9b-871e-1f5d67b06071",
+			StackGuid: "7d2ef1a5-d5b2-4b8c-9d5d-4c5c3b2a7c11",
+		},
+		cfclient.App{
+			Name: "app-2",
+			Guid: "1c8d4e3f-2a5b-4c6d-9e7f-8a9b0c1d2e3f",
+			SpaceGuid: "4ca50e06-2a3c-49d5-a1e6-dffa3cf6a7b4",
+			StackGuid: "a2b6c0e4-3d46-4d1e-9d7e-5b6f0a9c1e22",
+		},
+	}, self.Error
 }
 
 func (self *FakeCli) ListServiceInstancesByQuery(query url.Values) ([]cfclient.ServiceInstance, error) {
-	return []cfclient.ServiceInstance{}, self.Error
+	return []cfclient.ServiceInstance{
+		cfclient.ServiceInstance{
+			Name: "db-small",
+			Guid: "3e4f5a6b-7c8d-4e9f-a0b1-c2d3e4f5a6b7",
+			SpaceGuid: "ed6b2ad1-e7ca-4f94-8f12-46d5857aa571",
+			ServiceGuid: "2790478e-f500-43dd-93cf-6fa3c97292b9",
+			ServicePlanGuid: "5b8e7f0a-3c1d-4e2f-9a6b-7c8d9e0f1a2b",
+		},
+		cfclient.ServiceInstance{
+			Name: "db-large",
+			Guid: "4f5a6b7c-8d9e-4fa0-b1c2-d3e4f5a6b7c8",
+			SpaceGuid: "fc95a4c6-b07f-4b9b-871e-1f5d67b06071",
+			ServiceGuid: "2790478e-f500-43dd-93cf-6fa3c97292b9",
+			ServicePlanGuid: "6c9f8a1b-4d2e-4f30-8b7c-8d9e0f1a2b3c",
+		},
+		cfclient.ServiceInstance{
+			Name: "queue",
+			Guid: "5a6b7c8d-9e0f-4a1b-8c2d-e3f4a5b6c7d8",
+			SpaceGuid: "4ca50e06-2a3c-49d5-a1e6-dffa3cf6a7b4",
+			ServiceGuid: "e7289425-e9c6-42ab-a6fc-a1729d0849ca",
+			ServicePlanGuid: "7d0a9b2c-5e3f-4a41-9c8d-9e0f1a2b3c4d",
+		},
+	}, self.Error
 }
 
 func (self *FakeCli) ListServiceBindingsByQuery(query url.Values) ([]cfclient.ServiceBinding, error) {
 	return []cfclient.ServiceBinding{}, self.Error
 }
 
+func (self *FakeCli) ListServicePlansByQuery(query url.Values) ([]cfclient.ServicePlan, error) {
+	return []cfclient.ServicePlan{
+		cfclient.ServicePlan{
+			Name: "small",
+			Guid: "5b8e7f0a-3c1d-4e2f-9a6b-7c8d9e0f1a2b",
+			ServiceGuid: "2790478e-f500-43dd-93cf-6fa3c97292b9",
+			Active: false,
+			Public: true,
+		},
+		cfclient.ServicePlan{
+			Name: "large",
+			Guid: "6c9f8a1b-4d2e-4f30-8b7c-8d9e0f1a2b3c",
+			ServiceGuid: "2790478e-f500-43dd-93cf-6fa3c97292b9",
+			Active: true,
+			Public: true,
+		},
+	}, self.Error
+}
+
+func (self *FakeCli) ListStacks() ([]cfclient.Stack, error) {
+	return []cfclient.Stack{
+		cfclient.Stack{
+			Name: "cflinuxfs3",
+			Guid: "7d2ef1a5-d5b2-4b8c-9d5d-4c5c3b2a7c11",
+			Description: "Ubuntu 18.04",
+		},
+		cfclient.Stack{
+			Name: "cflinuxfs4",
+			Guid: "a2b6c0e4-3d46-4d1e-9d7e-5b6f0a9c1e22",
+			Description: "Ubuntu 22.04",
+		},
+	}, self.Error
+}
+
+func (self *FakeCli) NewRequest(method, path string) *cfclient.Request {
+	return &cfclient.Request{}
+}
+
+func (self *FakeCli) DoRequest(r *cfclient.Request) (*http.Response, error) {
+	if self.Error != nil {
+		return nil, self.Error
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+	}, nil
+}
+
 func assertJson(pRes *http.Response, pStruct interface{}) {
 	lVal := pRes.Header.Get("Content-Type")
 	Expect(lVal).To(Equal("application/json"), "with application/json")
@@ -215,6 +321,39 @@ var _ = Describe("Objects", func() {
 				Expect(lDescr.Code).To(Equal(50), "user code 10")
 			})
 
+			It("get service plans", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/services/2790478e-f500-43dd-93cf-6fa3c97292b9/plans", true)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 500)
+				assertJson(lRes, &lDescr)
+				Expect(lDescr.Code).To(Equal(50), "user code 10")
+			})
+
+			It("get service brokers", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/service_brokers", true)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 500)
+				assertJson(lRes, &lDescr)
+				Expect(lDescr.Code).To(Equal(50), "user code 10")
+			})
+
+			It("get stacks", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/stacks", true)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 500)
+				assertJson(lRes, &lDescr)
+				Expect(lDescr.Code).To(Equal(50), "user code 10")
+			})
+
 			It("get org spaces", func() {
 				lRes, lErr := getRequest(lApiMock.URL, "/v1/orgs/ddddb760-ef75-40f4-9d52-1bb557b61af8/spaces", true)
 				lDescr := struct {
@@ -279,6 +418,33 @@ var _ = Describe("Objects", func() {
 				assertStatusKo(lRes, lErr, 400)
 				assertJson(lRes, &lDescr)
 			})
+			It("get service plans", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/services/2790478e-f500-43dd-93cf-6fa3c97292b9/plans", false)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 400)
+				assertJson(lRes, &lDescr)
+			})
+			It("get service brokers", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/service_brokers", false)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 400)
+				assertJson(lRes, &lDescr)
+			})
+			It("get stacks", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/stacks", false)
+				lDescr := struct {
+					Code  int    `json:"code"`
+					Error string `json:"error"`
+				}{}
+				assertStatusKo(lRes, lErr, 400)
+				assertJson(lRes, &lDescr)
+			})
 			It("get org spaces", func() {
 				lRes, lErr := getRequest(lApiMock.URL, "/v1/orgs/ddddb760-ef75-40f4-9d52-1bb557b61af8/spaces", false)
 				lDescr := struct {
@@ -298,6 +464,35 @@ var _ = Describe("Objects", func() {
 				assertJson(lRes, &lData)
 				Expect(lData).Should(HaveLen(3))
 			})
+
+			It("get service plans", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/services/2790478e-f500-43dd-93cf-6fa3c97292b9/plans", true)
+				var lData []ServicePlan
+				assertStatusOk(lRes, lErr)
+				assertJson(lRes, &lData)
+				Expect(lData).Should(HaveLen(2))
+				Expect(lData[0].Deprecated).To(BeTrue(), "inactive plan is deprecated")
+				Expect(lData[1].Deprecated).To(BeFalse(), "active public plan is not deprecated")
+			})
+
+			It("get service brokers", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/service_brokers", true)
+				var lData []map[string]string
+				assertStatusOk(lRes, lErr)
+				assertJson(lRes, &lData)
+				Expect(lData).Should(HaveLen(2))
+				Expect(lData[0]).NotTo(HaveKey("auth_password"), "without broker credentials")
+				Expect(lData[1]["space_guid"]).To(Equal("fc95a4c6-b07f-4b9b-871e-1f5d67b06071"))
+			})
+
+			It("get stacks", func() {
+				lRes, lErr := getRequest(lApiMock.URL, "/v1/stacks", true)
+				var lData []Stack
+				assertStatusOk(lRes, lErr)
+				assertJson(lRes, &lData)
+				Expect(lData).Should(HaveLen(2))
+				Expect(lData[1].Name).To(Equal("cflinuxfs4"))
+			})
 		})
 	})
 
@@ -0,0 +1,162 @@
+package api
+
+import "fmt"
+import "regexp"
+import "strings"
+import "net/http"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+const prefCollection = "preferences"
+
+var langRegexp = regexp.MustCompile("^[a-z]{2,3}(-[a-z0-9]{2,8})*$")
+
+// Preference --
+type Preference struct {
+	Language   string              `json:"language"`
+	Categories map[string][]string `json:"categories,omitempty"`
+}
+
+// PreferenceHandler --
+type PreferenceHandler struct {
+	Config *core.AppConfig
+	UaaCli *core.UaaCli
+	Store  *core.Store
+}
+
+// NewPreferenceHandler --
+func NewPreferenceHandler(
+	pConf *core.AppConfig,
+	pRouter *mux.Router,
+	pStore *core.Store) (*PreferenceHandler, error) {
+
+	cli, err := core.NewUaaCli(pConf)
+	if err != nil {
+		log.WithError(err).Error("failed to create core UaaClient", err)
+		return nil, err
+	}
+
+	obj := PreferenceHandler{
+		Config: pConf,
+		UaaCli: cli,
+		Store:  pStore,
+	}
+
+	pRouter.Path("/v1/preferences").
+		HandlerFunc(core.DecorateHandler(obj.handleGet)).
+		Methods("GET")
+
+	pRouter.Path("/v1/preferences").
+		HandlerFunc(core.DecorateHandler(obj.handlePut)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("PUT")
+
+	pRouter.Path("/v1/categories").
+		HandlerFunc(core.DecorateHandler(obj.handleCategories)).
+		Methods("GET")
+
+	return &obj, nil
+}
+
+// normalizeLanguage lower-cases given locale and converts '_' separators
+// so that "fr_FR" and "fr-fr" designate the same language
+func normalizeLanguage(pLang string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(pLang)), "_", "-", -1)
+}
+
+// getCaller returns UAA identity of the owner of request bearer token
+func getCaller(pCli *core.UaaCli, pReq *http.Request) *core.UaaUserInfo {
+	token, err := core.GetRequestToken(pReq)
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 10))
+	}
+
+	info, err := pCli.GetUserInfo(token)
+	if err != nil {
+		log.WithError(err).Error("unable to identify caller from UAA api")
+		panic(core.NewHttpError(err, 400, 10))
+	}
+	return info
+}
+
+// requireScope returns UAA identity of request caller, failing with 403
+// when its token doesn't grant given scope
+func requireScope(pCli *core.UaaCli, pReq *http.Request, pScope string, pAction string) *core.UaaUserInfo {
+	caller := getCaller(pCli, pReq)
+	if !hasScope(pCli, pReq, pScope) {
+		err := fmt.Errorf("scope '%s' is required to %s", pScope, pAction)
+		panic(core.NewHttpError(err, 403, 11))
+	}
+	return caller
+}
+
+// hasScope returns true when bearer token of request grants given scope
+func hasScope(pCli *core.UaaCli, pReq *http.Request, pScope string) bool {
+	token, err := core.GetRequestToken(pReq)
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 10))
+	}
+	return pCli.HasScope(token, pScope)
+}
+
+// getPreferences returns stored preferences indexed by user guid
+func getPreferences(pStore *core.Store) map[string]Preference {
+	res := make(map[string]Preference)
+	docs, err := pStore.List(prefCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	for cID, cDoc := range docs {
+		pref := Preference{}
+		if err := json.Unmarshal(cDoc, &pref); err == nil {
+			res[cID] = pref
+		}
+	}
+	return res
+}
+
+func (s *PreferenceHandler) handleGet(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := getCaller(s.UaaCli, pReq)
+
+	pref := Preference{}
+	_, err := s.Store.Get(prefCollection, caller.Id, &pref)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	core.WriteJson(pRes, pref)
+}
+
+func (s *PreferenceHandler) handlePut(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := getCaller(s.UaaCli, pReq)
+
+	pref := Preference{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&pref); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	pref.Language = normalizeLanguage(pref.Language)
+	if "" != pref.Language && !langRegexp.MatchString(pref.Language) {
+		err := fmt.Errorf("invalid language '%s'", pref.Language)
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	if err := checkCategories(s.Config, pref.Categories); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+
+	log.WithFields(log.Fields{
+		"user":       caller.Id,
+		"preference": pref,
+	}).Info("saving user preferences")
+
+	if err := s.Store.Put(prefCollection, caller.Id, pref); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	core.WriteJson(pRes, pref)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
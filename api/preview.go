@@ -0,0 +1,135 @@
+package api
+
+import "bytes"
+import "errors"
+import "io/ioutil"
+import "mime"
+import "net/http"
+import "net/mail"
+import "encoding/base64"
+import "encoding/json"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
+
+// PreviewResponse --
+type PreviewResponse struct {
+	Recipient string              `json:"recipient"`
+	Count     int                 `json:"count"`
+	Headers   map[string][]string `json:"headers"`
+	Html      string              `json:"html"`
+	Text      string              `json:"text"`
+	Eml       string              `json:"eml"`
+}
+
+// getSample returns recipient used to preview message: the requested sample,
+// the first resolved recipient, or the caller when no target is given
+func (m *MessageHandler) getSample(pSample string, pData *MessageResponse, pReq *http.Request) string {
+	if "" != pSample {
+		addr, err := cfmail.NormalizeAddress(pSample)
+		if err != nil {
+			panic(core.NewHttpError(err, 400, 40))
+		}
+		return addr
+	}
+	if 0 != len(pData.Recipients) {
+		return pData.Recipients[0]
+	}
+
+	caller := getCaller(m.UaaCli, pReq)
+	addr, err := cfmail.NormalizeAddress(caller.Email)
+	if err != nil {
+		err := errors.New("no recipient to preview message for")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	return addr
+}
+
+// handlePreview runs the full mail pipeline for a sample recipient without
+// sending anything. Raw message is returned instead of json when format
+// query parameter is "eml"
+func (m *MessageHandler) handlePreview(pRes http.ResponseWriter, pReq *http.Request) {
+	content, err := ioutil.ReadAll(pReq.Body)
+	if err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	sample := struct {
+		Sample string `json:"sample"`
+	}{}
+	if err := json.Unmarshal(content, &sample); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	pReq.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	data, err := m.getRecipients(pReq)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 51))
+	}
+
+	m.writePreview(pRes, pReq, data, m.getSample(sample.Sample, data, pReq))
+}
+
+// writePreview writes mail sent to given recipient, either as raw eml or as
+// json preview depending on requested format
+func (m *MessageHandler) writePreview(pRes http.ResponseWriter, pReq *http.Request, pData *MessageResponse, pDest string) {
+	parts, err := m.renderMessage(pData, pDest)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 55))
+	}
+	if "eml" == pReq.URL.Query().Get("format") {
+		writeEml(pRes, buildRaw(pData, pDest, parts))
+		return
+	}
+	core.WriteJson(pRes, buildPreview(pData, pDest, parts))
+}
+
+// buildRaw returns raw mail sent to given recipient
+func buildRaw(pData *MessageResponse, pDest string, pParts mailParts) []byte {
+	msg := buildMessage(pData, pDest, pParts)
+	raw := bytes.Buffer{}
+	if _, err := msg.WriteTo(&raw); err != nil {
+		log.WithError(err).Error("unable to write preview message")
+		panic(core.NewHttpError(err, 500, 55))
+	}
+	return raw.Bytes()
+}
+
+// buildPreview returns parts and decoded headers of mail sent to given
+// recipient
+func buildPreview(pData *MessageResponse, pDest string, pParts mailParts) *PreviewResponse {
+	raw := buildRaw(pData, pDest, pParts)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 55))
+	}
+	decoder := mime.WordDecoder{}
+	headers := make(map[string][]string)
+	for cKey, cValues := range parsed.Header {
+		for _, cVal := range cValues {
+			if val, err := decoder.DecodeHeader(cVal); err == nil {
+				cVal = val
+			}
+			headers[cKey] = append(headers[cKey], cVal)
+		}
+	}
+
+	return &PreviewResponse{
+		Recipient: pDest,
+		Count:     len(pData.Recipients),
+		Headers:   headers,
+		Html:      pParts.Html,
+		Text:      pParts.Text,
+		Eml:       base64.StdEncoding.EncodeToString(raw),
+	}
+}
+
+func writeEml(pRes http.ResponseWriter, pRaw []byte) {
+	pRes.Header().Set("Content-Type", "message/rfc822")
+	pRes.Header().Set("Content-Disposition", `attachment; filename="preview.eml"`)
+	pRes.Write(pRaw)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,109 @@
+package api
+
+import "fmt"
+import "sort"
+import "errors"
+import "strings"
+import "net/url"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// OrgRoles maps organization role filters to CC role types
+var OrgRoles = map[string]string{
+	"OrgManager":     "organization_manager",
+	"BillingManager": "organization_billing_manager",
+	"OrgAuditor":     "organization_auditor",
+}
+
+// SpaceRoles maps space role filters to CC role types
+var SpaceRoles = map[string]string{
+	"SpaceManager":   "space_manager",
+	"SpaceDeveloper": "space_developer",
+	"SpaceAuditor":   "space_auditor",
+	"SpaceSupporter": "space_supporter",
+}
+
+// roleTypes returns CC role types of given role filters, failing on unknown
+// roles
+func roleTypes(pRoles []string, pKnown map[string]string) []string {
+	res := []string{}
+	for _, cRole := range pRoles {
+		val, ok := pKnown[cRole]
+		if !ok {
+			names := []string{}
+			for cName := range pKnown {
+				names = append(names, cName)
+			}
+			sort.Strings(names)
+			err := fmt.Errorf("invalid role '%s', must be one of %s", cRole, strings.Join(names, ", "))
+			panic(core.NewHttpError(err, 400, 40))
+		}
+		if !contains(res, val) {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
+// setRoles validates role filters of targeted organizations and spaces
+func (m *MessageReqCtx) setRoles(pOrgRoles []string, pSpaceRoles []string) {
+	m.orgRoles = roleTypes(pOrgRoles, OrgRoles)
+	m.spaceRoles = roleTypes(pSpaceRoles, SpaceRoles)
+}
+
+// spaceUserRoles are the space roles granting access to space resources
+var spaceUserRoles = []string{"space_manager", "space_developer", "space_auditor"}
+
+// getRolesUsers returns guids of users having one of given role types in
+// given resources, pKind being either "organization" or "space"
+func (m *MessageReqCtx) getRolesUsers(pKind string, pList []string, pTypes []string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, cRole := range m.listRoles(pKind, pList, pTypes) {
+		if !seen[cRole.User] {
+			seen[cRole.User] = true
+			res = append(res, cRole.User)
+		}
+	}
+	return res
+}
+
+// getSpacesRolesUsers returns guids of users having a role in given spaces,
+// indexed by space guid
+func (m *MessageReqCtx) getSpacesRolesUsers(pList []string) map[string][]string {
+	res := make(map[string][]string)
+	for _, cRole := range m.listRoles("space", pList, spaceUserRoles) {
+		if !contains(res[cRole.Space], cRole.User) {
+			res[cRole.Space] = append(res[cRole.Space], cRole.User)
+		}
+	}
+	return res
+}
+
+// listRoles returns roles of given types in given resources, resources being
+// queried by chunks of NbMaxGetParams
+func (m *MessageReqCtx) listRoles(pKind string, pList []string, pTypes []string) []core.V3Role {
+	res := []core.V3Role{}
+	for _, cChunk := range splitParams(pList, m.NbMaxGetParams) {
+		query := url.Values{}
+		query.Add("types", strings.Join(pTypes, ","))
+		query.Add(fmt.Sprintf("%s_guids", pKind), strings.Join(cChunk, ","))
+		query.Add("per_page", "5000")
+
+		log.WithFields(log.Fields{"kind": pKind, "guids": cChunk, "types": pTypes}).
+			Debug("reading roles")
+
+		roles, err := core.ListV3Roles(m.CCCli, query)
+		if err != nil {
+			uerr := errors.New("unable to fetch roles from CC api")
+			log.WithError(err).Error(uerr.Error())
+			panic(core.NewHttpError(err, 500, 50))
+		}
+		res = append(res, roles...)
+	}
+	return res
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,187 @@
+package api_test
+
+import (
+	"fmt"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"encoding/json"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/cloudfoundry-community/go-cfclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	roleOrg    = "ddddb760-ef75-40f4-9d52-1bb557b61af8"
+	roleSpace1 = "fc95a4c6-b07f-4b9b-871e-1f5d67b06071"
+	roleSpace2 = "4ca50e06-2a3c-49d5-a1e6-dffa3cf6a7b4"
+)
+
+// roleFixture is a CC role of a user in an organization or a space
+type roleFixture struct {
+	Type  string
+	User  string
+	Org   string
+	Space string
+}
+
+// roleCli answers /v3/roles requests with fixtures matching their query
+type roleCli struct {
+	FakeCli
+	roles []roleFixture
+	path  string
+}
+
+func (self *roleCli) NewRequest(method, path string) *cfclient.Request {
+	self.path = path
+	return &cfclient.Request{}
+}
+
+func (self *roleCli) DoRequest(r *cfclient.Request) (*http.Response, error) {
+	lUrl, lErr := url.Parse(self.path)
+	Expect(lErr).To(BeNil())
+	Expect(lUrl.Path).To(Equal("/v3/roles"))
+
+	lQuery := lUrl.Query()
+	lTypes := strings.Split(lQuery.Get("types"), ",")
+	lOrgs := strings.Split(lQuery.Get("organization_guids"), ",")
+	lSpaces := strings.Split(lQuery.Get("space_guids"), ",")
+
+	lItems := []interface{}{}
+	for _, cRole := range self.roles {
+		if !contains(lTypes, cRole.Type) {
+			continue
+		}
+		if "" != lQuery.Get("organization_guids") && !contains(lOrgs, cRole.Org) {
+			continue
+		}
+		if "" != lQuery.Get("space_guids") && !contains(lSpaces, cRole.Space) {
+			continue
+		}
+		lRel := map[string]interface{}{
+			"user": map[string]interface{}{"data": map[string]string{"guid": cRole.User}},
+		}
+		if "" != cRole.Space {
+			lRel["space"] = map[string]interface{}{"data": map[string]string{"guid": cRole.Space}}
+		} else {
+			lRel["organization"] = map[string]interface{}{"data": map[string]string{"guid": cRole.Org}}
+		}
+		lItems = append(lItems, map[string]interface{}{"type": cRole.Type, "relationships": lRel})
+	}
+
+	lBody, lErr := json.Marshal(map[string]interface{}{
+		"pagination": map[string]interface{}{"next": nil},
+		"resources":  lItems,
+	})
+	Expect(lErr).To(BeNil())
+	return &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(string(lBody))),
+	}, nil
+}
+
+func contains(pList []string, pVal string) bool {
+	for _, cVal := range pList {
+		if cVal == pVal {
+			return true
+		}
+	}
+	return false
+}
+
+var _ = Describe("Roles", func() {
+	lRoles := []roleFixture{
+		{"organization_user", "org-user", roleOrg, ""},
+		{"organization_manager", "org-manager", roleOrg, ""},
+		{"organization_billing_manager", "billing-manager", roleOrg, ""},
+		{"organization_auditor", "org-auditor", roleOrg, ""},
+		{"space_manager", "space-manager", "", roleSpace1},
+		{"space_developer", "space-developer", "", roleSpace1},
+		{"space_auditor", "space-auditor", "", roleSpace1},
+		{"space_supporter", "space-supporter", "", roleSpace1},
+		{"space_developer", "other-developer", "", roleSpace2},
+	}
+
+	lNewCtx := func() *MessageReqCtx {
+		lCtx := NewTargetCtx(&roleCli{roles: lRoles})
+		lCtx.UserMails = map[string]string{}
+		for _, cRole := range lRoles {
+			lCtx.UserMails[cRole.User] = fmt.Sprintf("%s@example.com", cRole.User)
+		}
+		return lCtx
+	}
+
+	lOrgCases := []struct {
+		Roles    []string
+		Expected []string
+	}{
+		{[]string{"OrgManager"}, []string{"org-manager@example.com"}},
+		{[]string{"BillingManager"}, []string{"billing-manager@example.com"}},
+		{[]string{"OrgAuditor"}, []string{"org-auditor@example.com"}},
+		{[]string{"OrgManager", "OrgAuditor"}, []string{"org-manager@example.com", "org-auditor@example.com"}},
+	}
+
+	for _, cCase := range lOrgCases {
+		lCase := cCase
+		It("targets organization users with roles "+strings.Join(lCase.Roles, ", "), func() {
+			lCtx := lNewCtx()
+			lCtx.SetRoles(lCase.Roles, []string{})
+			lCtx.AddOrgs([]string{roleOrg})
+			Expect(lCtx.ResData.Recipients).To(ConsistOf(lCase.Expected))
+		})
+	}
+
+	lSpaceCases := []struct {
+		Roles    []string
+		Expected []string
+	}{
+		{[]string{"SpaceManager"}, []string{"space-manager@example.com"}},
+		{[]string{"SpaceDeveloper"}, []string{"space-developer@example.com"}},
+		{[]string{"SpaceAuditor"}, []string{"space-auditor@example.com"}},
+		{[]string{"SpaceSupporter"}, []string{"space-supporter@example.com"}},
+		{[]string{"SpaceManager", "SpaceDeveloper"}, []string{"space-manager@example.com", "space-developer@example.com"}},
+	}
+
+	for _, cCase := range lSpaceCases {
+		lCase := cCase
+		It("targets space users with roles "+strings.Join(lCase.Roles, ", "), func() {
+			lCtx := lNewCtx()
+			lCtx.SetRoles([]string{}, lCase.Roles)
+			lCtx.AddSpaces([]string{roleSpace1})
+			lCtx.ReadSpaces()
+			Expect(lCtx.ResData.Recipients).To(ConsistOf(lCase.Expected))
+		})
+	}
+
+	It("queries spaces by chunks", func() {
+		lCtx := lNewCtx()
+		lCtx.NbMaxGetParams = 1
+		lCtx.SetRoles([]string{}, []string{"SpaceDeveloper"})
+		lCtx.AddSpaces([]string{roleSpace1, roleSpace2})
+		lCtx.ReadSpaces()
+		Expect(lCtx.ResData.Recipients).To(ConsistOf(
+			"space-developer@example.com",
+			"other-developer@example.com",
+		))
+	})
+
+	lInvalid := []struct {
+		Name  string
+		Org   []string
+		Space []string
+	}{
+		{"unknown organization roles", []string{"OrgUser"}, []string{}},
+		{"space roles as organization roles", []string{"SpaceManager"}, []string{}},
+		{"organization roles as space roles", []string{}, []string{"OrgManager"}},
+	}
+
+	for _, cCase := range lInvalid {
+		lCase := cCase
+		It("rejects "+lCase.Name, func() {
+			lCtx := lNewCtx()
+			Expect(func() { lCtx.SetRoles(lCase.Org, lCase.Space) }).To(Panic())
+		})
+	}
+})
@@ -0,0 +1,57 @@
+package api
+
+import "errors"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import "github.com/orange-cloudfoundry/cf-wall/sms"
+
+// readPhones resolves phone numbers of recipients who opted in for sms
+// messages of the message category
+func (m *MessageReqCtx) readPhones(pPrefs map[string]Preference) {
+	if !m.ResData.sendsOn("sms") {
+		return
+	}
+
+	ids := make(map[string]string, len(m.UserMails))
+	for cID, cMail := range m.UserMails {
+		ids[cMail] = cID
+	}
+
+	seen := make(map[string]bool)
+	for _, cAddr := range m.ResData.Recipients {
+		id, ok := ids[cAddr]
+		if !ok {
+			continue
+		}
+		pref, ok := pPrefs[id]
+		if !ok || !pref.wants(m.ResData.Category, "sms") {
+			continue
+		}
+		phone := m.UserPhones[id]
+		if "" == phone || seen[phone] {
+			continue
+		}
+		seen[phone] = true
+		m.ResData.Phones = append(m.ResData.Phones, phone)
+	}
+}
+
+// checkSms fails when message is sent on sms and no gateway is configured,
+// recipients previews remaining available
+func (m *MessageReqCtx) checkSms() {
+	if m.ResData.sendsOn("sms") && "" == m.Config.SmsGatewayUrl {
+		err := errors.New("sms gateway is not configured")
+		panic(core.NewHttpError(err, 400, 40))
+	}
+}
+
+// sendSms enqueues short text version of given message to its phones
+func (m *MessageHandler) sendSms(pData *MessageResponse) {
+	text := sms.ShortText(pData.Subject, pData.Summary, pData.Severity, m.Config.SmsMaxLength)
+	for _, cPhone := range pData.Phones {
+		m.sms <- &sms.Message{To: cPhone, Text: text}
+	}
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sms", func() {
+	var lCtx *MessageReqCtx
+	lPrefs := map[string]Preference{
+		"user-sms":   Preference{Categories: map[string][]string{"incident": {"sms"}}},
+		"user-twin":  Preference{Categories: map[string][]string{"incident": {"sms"}}},
+		"user-email": Preference{Categories: map[string][]string{"incident": {"email"}}},
+	}
+
+	BeforeEach(func() {
+		lCtx = NewTargetCtx(&FakeCli{})
+		lCtx.UserMails = map[string]string{
+			"user-sms":   "sms@example.com",
+			"user-twin":  "twin@example.com",
+			"user-email": "email@example.com",
+		}
+		lCtx.UserPhones = map[string]string{
+			"user-sms":   "+33600000000",
+			"user-twin":  "+33600000000",
+			"user-email": "+33611111111",
+		}
+		lCtx.ResData.Recipients = []string{"sms@example.com", "twin@example.com", "email@example.com"}
+		lCtx.ResData.Category = "incident"
+		lCtx.ResData.Channels = []string{"email", "sms"}
+	})
+
+	It("resolves phones of recipients who opted in once", func() {
+		lCtx.ReadPhones(lPrefs)
+		Expect(lCtx.ResData.Phones).To(Equal([]string{"+33600000000"}))
+	})
+
+	It("resolves no phones when not sent on sms", func() {
+		lCtx.ResData.Channels = []string{"email"}
+		lCtx.ReadPhones(lPrefs)
+		Expect(lCtx.ResData.Phones).To(BeEmpty())
+	})
+
+	It("resolves phones without gateway", func() {
+		Expect(func() { lCtx.ReadPhones(lPrefs) }).NotTo(Panic())
+	})
+
+	It("rejects sending on sms without gateway", func() {
+		Expect(func() { lCtx.CheckSms() }).To(Panic())
+	})
+
+	It("accepts sending on sms with gateway", func() {
+		lCtx.Config = &core.AppConfig{SmsGatewayUrl: "https://sms.example.com"}
+		Expect(func() { lCtx.CheckSms() }).NotTo(Panic())
+	})
+
+	It("accepts sending without sms", func() {
+		lCtx.ResData.Channels = []string{"email"}
+		Expect(func() { lCtx.CheckSms() }).NotTo(Panic())
+	})
+})
@@ -0,0 +1,278 @@
+package api
+
+import "fmt"
+import "sort"
+import "time"
+import "regexp"
+import "strings"
+import "net/http"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import cfmail "github.com/orange-cloudfoundry/cf-wall/mail"
+
+const suppressionCollection = "suppressions"
+
+// Suppression kinds
+const (
+	SuppressAddress = "address"
+	SuppressDomain  = "domain"
+	SuppressRegex   = "regex"
+)
+
+// Suppression excludes matching addresses from all recipient lists
+type Suppression struct {
+	Id      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Value   string    `json:"value"`
+	Reason  string    `json:"reason"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+
+	regexp *regexp.Regexp
+}
+
+// SuppressionHandler --
+type SuppressionHandler struct {
+	Config *core.AppConfig
+	UaaCli *core.UaaCli
+	Store  *core.Store
+}
+
+// NewSuppressionHandler --
+func NewSuppressionHandler(
+	pConf *core.AppConfig,
+	pRouter *mux.Router,
+	pStore *core.Store) (*SuppressionHandler, error) {
+
+	cli, err := core.NewUaaCli(pConf)
+	if err != nil {
+		log.WithError(err).Error("failed to create core UaaClient", err)
+		return nil, err
+	}
+
+	obj := SuppressionHandler{
+		Config: pConf,
+		UaaCli: cli,
+		Store:  pStore,
+	}
+
+	pRouter.Path("/v1/suppressions").
+		HandlerFunc(core.DecorateHandler(obj.handleList)).
+		Methods("GET")
+
+	pRouter.Path("/v1/suppressions").
+		HandlerFunc(core.DecorateHandler(obj.handleCreate)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+
+	pRouter.Path("/v1/suppressions/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleGet)).
+		Methods("GET")
+
+	pRouter.Path("/v1/suppressions/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleUpdate)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("PUT")
+
+	pRouter.Path("/v1/suppressions/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleDelete)).
+		Methods("DELETE")
+
+	return &obj, nil
+}
+
+// compile validates and normalizes suppression value
+func (s *Suppression) compile() error {
+	switch s.Kind {
+	case SuppressAddress:
+		addr, err := cfmail.NormalizeAddress(s.Value)
+		if err != nil {
+			return fmt.Errorf("invalid address '%s'", s.Value)
+		}
+		s.Value = cfmail.AddressKey(addr)
+	case SuppressDomain:
+		s.Value = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s.Value)), "@")
+		if "" == s.Value || strings.ContainsAny(s.Value, "@ ") {
+			return fmt.Errorf("invalid domain '%s'", s.Value)
+		}
+	case SuppressRegex:
+		// addresses are matched lower cased
+		exp, err := regexp.Compile("(?i)" + s.Value)
+		if err != nil {
+			return fmt.Errorf("invalid regex '%s': %s", s.Value, err.Error())
+		}
+		s.regexp = exp
+	default:
+		return fmt.Errorf("invalid kind '%s', must be one of address, domain, regex", s.Kind)
+	}
+	return nil
+}
+
+// match returns true when given address key is suppressed, domain
+// suppressions also matching sub-domains
+func (s *Suppression) match(pAddr string) bool {
+	switch s.Kind {
+	case SuppressAddress:
+		return s.Value == pAddr
+	case SuppressDomain:
+		domain := pAddr[strings.LastIndex(pAddr, "@")+1:]
+		return domain == s.Value || strings.HasSuffix(domain, "."+s.Value)
+	case SuppressRegex:
+		return s.regexp != nil && s.regexp.MatchString(pAddr)
+	}
+	return false
+}
+
+// getSuppressions returns stored suppressions, ready to be matched
+func getSuppressions(pStore *core.Store) []Suppression {
+	docs, err := pStore.List(suppressionCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	res := []Suppression{}
+	for _, cDoc := range docs {
+		item := Suppression{}
+		if err := json.Unmarshal(cDoc, &item); err != nil {
+			continue
+		}
+		if err := item.compile(); err != nil {
+			log.WithError(err).WithFields(log.Fields{"suppression": item.Id}).
+				Warn("ignoring invalid suppression")
+			continue
+		}
+		res = append(res, item)
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		return res[pI].Created.Before(res[pJ].Created)
+	})
+	return res
+}
+
+// applySuppressions removes suppressed addresses from resolved recipients,
+// recording the reason of each removal
+func (m *MessageReqCtx) applySuppressions(pList []Suppression) {
+	if 0 == len(pList) {
+		return
+	}
+
+	kept := []string{}
+	for _, cAddr := range m.ResData.Recipients {
+		suppressed := false
+		key := cfmail.AddressKey(cAddr)
+		for _, cItem := range pList {
+			if !cItem.match(key) {
+				continue
+			}
+			if m.ResData.Suppressed == nil {
+				m.ResData.Suppressed = make(map[string]string)
+			}
+			m.ResData.Suppressed[cAddr] = fmt.Sprintf("%s %s: %s", cItem.Kind, cItem.Value, cItem.Reason)
+			suppressed = true
+			break
+		}
+		if !suppressed {
+			kept = append(kept, cAddr)
+		}
+	}
+	m.ResData.Recipients = kept
+}
+
+func (s *SuppressionHandler) get(pID string) *Suppression {
+	item := Suppression{}
+	found, err := s.Store.Get(suppressionCollection, pID, &item)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	if !found {
+		err := fmt.Errorf("unknown suppression '%s'", pID)
+		panic(core.NewHttpError(err, 404, 41))
+	}
+	return &item
+}
+
+func (s *SuppressionHandler) save(pItem *Suppression) {
+	if err := pItem.compile(); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	if err := s.Store.Put(suppressionCollection, pItem.Id, pItem); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+}
+
+func decodeSuppression(pReq *http.Request) Suppression {
+	item := Suppression{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&item); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	return item
+}
+
+// requireAdmin returns identity of request caller, suppressions listing user
+// addresses being restricted to owners of the admin scope
+func (s *SuppressionHandler) requireAdmin(pReq *http.Request) *core.UaaUserInfo {
+	return requireScope(s.UaaCli, pReq, s.Config.AdminScope, "manage suppressions")
+}
+
+func (s *SuppressionHandler) handleList(pRes http.ResponseWriter, pReq *http.Request) {
+	s.requireAdmin(pReq)
+	core.WriteJson(pRes, getSuppressions(s.Store))
+}
+
+func (s *SuppressionHandler) handleGet(pRes http.ResponseWriter, pReq *http.Request) {
+	s.requireAdmin(pReq)
+	core.WriteJson(pRes, s.get(mux.Vars(pReq)["id"]))
+}
+
+func (s *SuppressionHandler) handleCreate(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+
+	item := decodeSuppression(pReq)
+	item.Id = core.NewId()
+	item.Author = caller.UserName
+	item.Created = time.Now()
+	s.save(&item)
+
+	log.WithFields(log.Fields{
+		"suppression": item,
+	}).Info("created suppression")
+	core.WriteJsonStatus(pRes, 201, item)
+}
+
+func (s *SuppressionHandler) handleUpdate(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+	current := s.get(mux.Vars(pReq)["id"])
+
+	item := decodeSuppression(pReq)
+	item.Id = current.Id
+	item.Author = caller.UserName
+	item.Created = current.Created
+	s.save(&item)
+
+	log.WithFields(log.Fields{
+		"suppression": item,
+	}).Info("updated suppression")
+	core.WriteJson(pRes, item)
+}
+
+func (s *SuppressionHandler) handleDelete(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+	item := s.get(mux.Vars(pReq)["id"])
+
+	if err := s.Store.Delete(suppressionCollection, item.Id); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	log.WithFields(log.Fields{
+		"suppression": item,
+		"user":        caller.UserName,
+	}).Info("deleted suppression")
+	pRes.WriteHeader(204)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suppression", func() {
+	lInvalid := []struct {
+		Name string
+		Item Suppression
+	}{
+		{"with invalid address", Suppression{Kind: SuppressAddress, Value: "not an address"}},
+		{"with empty domain", Suppression{Kind: SuppressDomain, Value: " "}},
+		{"with address as domain", Suppression{Kind: SuppressDomain, Value: "jdoe@example.com"}},
+		{"with invalid regex", Suppression{Kind: SuppressRegex, Value: "noreply@("}},
+		{"with unknown kind", Suppression{Kind: "phone", Value: "+33612345678"}},
+	}
+
+	for _, cCase := range lInvalid {
+		lCase := cCase
+		It("rejects suppressions "+lCase.Name, func() {
+			Expect(lCase.Item.Compile()).NotTo(BeNil())
+		})
+	}
+
+	It("normalizes addresses", func() {
+		lItem := Suppression{Kind: SuppressAddress, Value: " John Doe <John.Doe@Example.COM> "}
+		Expect(lItem.Compile()).To(BeNil())
+		Expect(lItem.Value).To(Equal("john.doe@example.com"))
+	})
+
+	It("normalizes domains", func() {
+		lItem := Suppression{Kind: SuppressDomain, Value: " @Example.COM "}
+		Expect(lItem.Compile()).To(BeNil())
+		Expect(lItem.Value).To(Equal("example.com"))
+	})
+
+	lCases := []struct {
+		Kind  string
+		Value string
+		Addr  string
+		Match bool
+	}{
+		{SuppressAddress, "jdoe@example.com", "jdoe@example.com", true},
+		{SuppressAddress, "jdoe@example.com", "JDoe@Example.com", true},
+		{SuppressAddress, "JDoe@Example.com", "jdoe@example.com", true},
+		{SuppressAddress, "jdoe@example.com", "John Doe <jdoe@example.com>", true},
+		{SuppressAddress, "jdoe@example.com", "jane@example.com", false},
+		{SuppressDomain, "example.com", "jdoe@example.com", true},
+		{SuppressDomain, "example.com", "jdoe@EXAMPLE.com", true},
+		{SuppressDomain, "example.com", "jdoe@mail.example.com", true},
+		{SuppressDomain, "example.com", "jdoe@a.mail.example.com", true},
+		{SuppressDomain, "example.com", "jdoe@badexample.com", false},
+		{SuppressDomain, "example.com", "jdoe@example.com.other.org", false},
+		{SuppressDomain, "mail.example.com", "jdoe@example.com", false},
+		{SuppressRegex, "^noreply@", "noreply@example.com", true},
+		{SuppressRegex, "^noreply@", "NoReply@example.com", true},
+		{SuppressRegex, "^NoReply@", "noreply@example.com", true},
+		{SuppressRegex, "^noreply@", "reply@example.com", false},
+		{SuppressRegex, "^noreply@", "Service <noreply@example.com>", true},
+	}
+
+	for _, cCase := range lCases {
+		lCase := cCase
+		lDesc := "does not match"
+		if lCase.Match {
+			lDesc = "matches"
+		}
+		It(lCase.Kind+" '"+lCase.Value+"' "+lDesc+" '"+lCase.Addr+"'", func() {
+			lItem := Suppression{Kind: lCase.Kind, Value: lCase.Value}
+			Expect(lItem.Compile()).To(BeNil())
+			Expect(lItem.Match(lCase.Addr)).To(Equal(lCase.Match))
+		})
+	}
+
+	Context("Applied to recipients", func() {
+		var lCtx *MessageReqCtx
+		var lItems []Suppression
+
+		BeforeEach(func() {
+			lCtx = NewTargetCtx(&FakeCli{})
+			lCtx.ResData.Recipients = []string{
+				"jdoe@example.com",
+				"Jane Doe <Jane@Mail.Example.com>",
+				"bob@other.org",
+				"noreply@other.org",
+			}
+			lItems = []Suppression{
+				Suppression{Kind: SuppressDomain, Value: "example.com", Reason: "domain closed"},
+				Suppression{Kind: SuppressRegex, Value: "^noreply@", Reason: "robot"},
+			}
+			for cIdx := range lItems {
+				Expect(lItems[cIdx].Compile()).To(BeNil())
+			}
+		})
+
+		It("removes suppressed recipients with their reason", func() {
+			lCtx.ApplySuppressions(lItems)
+			Expect(lCtx.ResData.Recipients).To(Equal([]string{"bob@other.org"}))
+			Expect(lCtx.ResData.Suppressed).To(Equal(map[string]string{
+				"jdoe@example.com":                 "domain example.com: domain closed",
+				"Jane Doe <Jane@Mail.Example.com>": "domain example.com: domain closed",
+				"noreply@other.org":                "regex ^noreply@: robot",
+			}))
+		})
+
+		It("keeps recipients without suppressions", func() {
+			lCtx.ApplySuppressions([]Suppression{})
+			Expect(lCtx.ResData.Recipients).To(HaveLen(4))
+			Expect(lCtx.ResData.Suppressed).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Targets", func() {
+	var lCtx *MessageReqCtx
+
+	BeforeEach(func() {
+		lCtx = NewTargetCtx(&FakeCli{})
+	})
+
+	Context("With stacks", func() {
+		It("targets spaces of applications running on given stacks", func() {
+			lCtx.AddStacks([]string{"7d2ef1a5-d5b2-4b8c-9d5d-4c5c3b2a7c11"})
+			Expect(lCtx.Spaces()).To(Equal([]string{"fc95a4c6-b07f-4b9b-871e-1f5d67b06071"}))
+			Expect(lCtx.Impacts()).To(Equal(map[string][]Impact{
+				"fc95a4c6-b07f-4b9b-871e-1f5d67b06071": []Impact{
+					Impact{Kind: "application", Name: "app-1"},
+				},
+			}))
+		})
+
+		It("ignores unknown stacks", func() {
+			lCtx.AddStacks([]string{"unknown-stack"})
+			Expect(lCtx.Spaces()).To(BeEmpty())
+		})
+	})
+
+	Context("With service plans", func() {
+		It("targets spaces of instances of given plans", func() {
+			lCtx.AddServicePlans([]string{"6c9f8a1b-4d2e-4f30-8b7c-8d9e0f1a2b3c"}, false)
+			Expect(lCtx.Spaces()).To(Equal([]string{"fc95a4c6-b07f-4b9b-871e-1f5d67b06071"}))
+			Expect(lCtx.Impacts()).To(Equal(map[string][]Impact{
+				"fc95a4c6-b07f-4b9b-871e-1f5d67b06071": []Impact{
+					Impact{Kind: "service instance", Name: "db-large"},
+				},
+			}))
+		})
+
+		It("targets spaces of instances of deprecated plans", func() {
+			lCtx.AddServicePlans([]string{}, true)
+			Expect(lCtx.Spaces()).To(Equal([]string{"ed6b2ad1-e7ca-4f94-8f12-46d5857aa571"}))
+			Expect(lCtx.Impacts()).To(Equal(map[string][]Impact{
+				"ed6b2ad1-e7ca-4f94-8f12-46d5857aa571": []Impact{
+					Impact{Kind: "service instance", Name: "db-small"},
+				},
+			}))
+		})
+
+		It("targets nothing without plans", func() {
+			lCtx.AddServicePlans([]string{}, false)
+			Expect(lCtx.Spaces()).To(BeEmpty())
+		})
+	})
+
+	Context("With brokers", func() {
+		It("targets spaces of instances of services offered by given brokers", func() {
+			lCtx.AddBrokers([]string{"9f2a3b4c-6d7e-4f80-9bac-1d2e3f4a5b6c"})
+			Expect(lCtx.Spaces()).To(Equal([]string{"4ca50e06-2a3c-49d5-a1e6-dffa3cf6a7b4"}))
+			Expect(lCtx.Impacts()).To(Equal(map[string][]Impact{
+				"4ca50e06-2a3c-49d5-a1e6-dffa3cf6a7b4": []Impact{
+					Impact{Kind: "service instance", Name: "queue"},
+				},
+			}))
+		})
+
+		It("targets all instances of services of a broker", func() {
+			lCtx.AddBrokers([]string{"8e1f2a3b-5c6d-4e7f-8a9b-0c1d2e3f4a5b"})
+			Expect(lCtx.Spaces()).To(ConsistOf(
+				"ed6b2ad1-e7ca-4f94-8f12-46d5857aa571",
+				"fc95a4c6-b07f-4b9b-871e-1f5d67b06071",
+			))
+		})
+
+		It("ignores unknown brokers", func() {
+			lCtx.AddBrokers([]string{"unknown-broker"})
+			Expect(lCtx.Spaces()).To(BeEmpty())
+		})
+	})
+})
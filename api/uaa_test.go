@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"strings"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	uaaclient "code.cloudfoundry.org/uaa-go-client"
+)
+
+// fakeUser is a UAA user authenticated by its token
+type fakeUser struct {
+	Info   core.UaaUserInfo
+	Scopes []string
+}
+
+// fakeUaa grants scopes of users found by token, other client methods
+// being left unimplemented
+type fakeUaa struct {
+	uaaclient.Client
+	users map[string]fakeUser
+}
+
+func (self *fakeUaa) DecodeToken(pToken string, pScopes ...string) error {
+	lUser, lOk := self.users[strings.TrimPrefix(pToken, "bearer ")]
+	if !lOk {
+		return errors.New("invalid token")
+	}
+	for _, cScope := range pScopes {
+		lFound := false
+		for _, cHas := range lUser.Scopes {
+			lFound = lFound || (cHas == cScope)
+		}
+		if !lFound {
+			return errors.New("missing scope")
+		}
+	}
+	return nil
+}
+
+// newFakeUaa returns an UAA client identifying given users by token, along
+// with the server answering its user info requests
+func newFakeUaa(pUsers map[string]fakeUser) (*core.UaaCli, *httptest.Server) {
+	lServer := httptest.NewServer(http.HandlerFunc(func(pRes http.ResponseWriter, pReq *http.Request) {
+		lToken, _ := core.GetRequestToken(pReq)
+		lUser, lOk := pUsers[lToken]
+		if !lOk || pReq.URL.Path != "/userinfo" {
+			pRes.WriteHeader(401)
+			return
+		}
+		json.NewEncoder(pRes).Encode(lUser.Info)
+	}))
+	return &core.UaaCli{
+		Client:   &fakeUaa{users: pUsers},
+		Endpoint: lServer.URL,
+	}, lServer
+}
+
+// authRequest returns a request authenticated with given token, with given
+// json body when not empty
+func authRequest(pMethod string, pUrl string, pToken string, pBody string) *http.Request {
+	lReq := httptest.NewRequest(pMethod, pUrl, strings.NewReader(pBody))
+	lReq.Header.Set("Authorization", "bearer "+pToken)
+	if "" != pBody {
+		lReq.Header.Set("Content-Type", "application/json")
+	}
+	return lReq
+}
@@ -0,0 +1,466 @@
+package api
+
+import "fmt"
+import "sort"
+import "time"
+import "errors"
+import "net/url"
+import "net/http"
+import "encoding/json"
+import "github.com/gorilla/mux"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+import "github.com/orange-cloudfoundry/cf-wall/hook"
+
+const webhookCollection = "webhooks"
+const webhookDeliveryCollection = "webhook_deliveries"
+
+// Webhook events
+const (
+	EventMessageSent = "message.sent"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// Webhook is a subscription receiving a signed json payload for each sent
+// message
+type Webhook struct {
+	Id          string    `json:"id"`
+	Url         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Description string    `json:"description"`
+	Author      string    `json:"author"`
+	Created     time.Time `json:"created"`
+}
+
+// WebhookDelivery records attempts to deliver an event to a webhook
+type WebhookDelivery struct {
+	Id        string         `json:"id"`
+	WebhookId string         `json:"webhook_id"`
+	AuditId   string         `json:"audit_id"`
+	Event     string         `json:"event"`
+	Status    string         `json:"status"`
+	Created   time.Time      `json:"created"`
+	Attempts  []hook.Attempt `json:"attempts"`
+}
+
+// WebhookCounts --
+type WebhookCounts struct {
+	Recipients int `json:"recipients"`
+	Duplicates int `json:"duplicates"`
+	Suppressed int `json:"suppressed"`
+	OptedOut   int `json:"opted_out"`
+	Chats      int `json:"chats"`
+	Sms        int `json:"sms"`
+}
+
+// WebhookPayload is the json body posted to webhooks when a message is sent
+type WebhookPayload struct {
+	Event      string             `json:"event"`
+	Id         string             `json:"id"`
+	Kind       string             `json:"kind"`
+	User       string             `json:"user"`
+	Subject    string             `json:"subject"`
+	Message    string             `json:"message"`
+	Category   string             `json:"category,omitempty"`
+	Severity   string             `json:"severity,omitempty"`
+	Channels   []string           `json:"channels"`
+	Orgs       []string           `json:"orgs"`
+	Spaces     []string           `json:"spaces"`
+	Services   []string           `json:"services"`
+	Plans      []string           `json:"service_plans"`
+	Brokers    []string           `json:"service_brokers"`
+	BuildPacks []string           `json:"buildpacks"`
+	Versions   []BuildpackVersion `json:"buildpack_versions,omitempty"`
+	Stacks     []string           `json:"stacks"`
+	Apps       *AppFilter         `json:"apps,omitempty"`
+	Counts     WebhookCounts      `json:"counts"`
+	Sent       time.Time          `json:"sent"`
+}
+
+// WebhookHandler --
+type WebhookHandler struct {
+	Config *core.AppConfig
+	UaaCli *core.UaaCli
+	Store  *core.Store
+	queue  chan *hook.Request
+}
+
+// NewWebhookHandler --
+func NewWebhookHandler(
+	pConf *core.AppConfig,
+	pRouter *mux.Router,
+	pStore *core.Store,
+	pSender *hook.Sender) (*WebhookHandler, error) {
+
+	cli, err := core.NewUaaCli(pConf)
+	if err != nil {
+		log.WithError(err).Error("failed to create core UaaClient", err)
+		return nil, err
+	}
+
+	obj := WebhookHandler{
+		Config: pConf,
+		UaaCli: cli,
+		Store:  pStore,
+		queue:  pSender.Queue,
+	}
+
+	pRouter.Path("/v1/webhooks").
+		HandlerFunc(core.DecorateHandler(obj.handleList)).
+		Methods("GET")
+
+	pRouter.Path("/v1/webhooks").
+		HandlerFunc(core.DecorateHandler(obj.handleCreate)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("POST")
+
+	pRouter.Path("/v1/webhooks/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleGet)).
+		Methods("GET")
+
+	pRouter.Path("/v1/webhooks/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleUpdate)).
+		HeadersRegexp("Content-Type", "application/json.*").
+		Methods("PUT")
+
+	pRouter.Path("/v1/webhooks/{id}").
+		HandlerFunc(core.DecorateHandler(obj.handleDelete)).
+		Methods("DELETE")
+
+	pRouter.Path("/v1/webhooks/{id}/deliveries").
+		HandlerFunc(core.DecorateHandler(obj.handleDeliveries)).
+		Methods("GET")
+
+	pSender.OnResult = obj.onResult
+	obj.failPendingDeliveries()
+	schedulePruning(obj.pruneDeliveries)
+	return &obj, nil
+}
+
+// newWebhookPayload describes given sent message
+func newWebhookPayload(pEntry *AuditEntry, pData *MessageResponse) WebhookPayload {
+	channels := pData.Channels
+	if 0 == len(channels) {
+		channels = []string{"email"}
+	}
+	return WebhookPayload{
+		Event:      EventMessageSent,
+		Id:         pEntry.Id,
+		Kind:       pEntry.Kind,
+		User:       pEntry.User,
+		Subject:    pData.Subject,
+		Message:    pData.Markdown,
+		Category:   pData.Category,
+		Severity:   pData.Severity,
+		Channels:   channels,
+		Orgs:       pEntry.Request.Orgs,
+		Spaces:     pEntry.Request.Spaces,
+		Services:   pEntry.Request.Services,
+		Plans:      pEntry.Request.Plans,
+		Brokers:    pEntry.Request.Brokers,
+		BuildPacks: pEntry.Request.BuildPacks,
+		Versions:   pEntry.Request.BuildPackVersions,
+		Stacks:     pEntry.Request.Stacks,
+		Apps:       pEntry.Request.Apps,
+		Counts: WebhookCounts{
+			Recipients: len(pData.Recipients),
+			Duplicates: pData.Duplicates,
+			Suppressed: len(pData.Suppressed),
+			OptedOut:   pData.OptedOut,
+			Chats:      len(pData.Chats),
+			Sms:        len(pData.Phones),
+		},
+		Sent: *pEntry.Sent,
+	}
+}
+
+// Notify enqueues given payload to all webhooks, recording a pending
+// delivery for each of them. Errors are only logged since the notified
+// message is already sent
+func (s *WebhookHandler) Notify(pAuditID string, pPayload WebhookPayload) {
+	docs, err := s.Store.List(webhookCollection)
+	if err != nil {
+		log.WithError(err).Error("unable to read webhooks")
+		return
+	}
+	body, err := json.Marshal(pPayload)
+	if err != nil {
+		log.WithError(err).Error("unable to encode webhook payload")
+		return
+	}
+
+	for _, cDoc := range docs {
+		item := Webhook{}
+		if err := json.Unmarshal(cDoc, &item); err != nil {
+			continue
+		}
+
+		record := WebhookDelivery{
+			Id:        core.NewId(),
+			WebhookId: item.Id,
+			AuditId:   pAuditID,
+			Event:     pPayload.Event,
+			Status:    WebhookPending,
+			Created:   time.Now(),
+			Attempts:  []hook.Attempt{},
+		}
+		if err := s.Store.Put(webhookDeliveryCollection, record.Id, record); err != nil {
+			log.WithError(err).WithFields(log.Fields{"webhook": item.Id}).
+				Error("unable to save webhook delivery")
+			continue
+		}
+		s.queue <- &hook.Request{
+			Id:     record.Id,
+			Url:    item.Url,
+			Secret: item.Secret,
+			Event:  pPayload.Event,
+			Body:   body,
+		}
+	}
+}
+
+// onResult records attempts of a finished delivery
+func (s *WebhookHandler) onResult(pReq *hook.Request, pAttempts []hook.Attempt, pSuccess bool) {
+	record := WebhookDelivery{}
+	found, err := s.Store.Get(webhookDeliveryCollection, pReq.Id, &record)
+	if err != nil || !found {
+		log.WithError(err).WithFields(log.Fields{"delivery": pReq.Id}).
+			Error("unable to read webhook delivery")
+		return
+	}
+
+	record.Attempts = pAttempts
+	record.Status = WebhookFailed
+	if pSuccess {
+		record.Status = WebhookDelivered
+	}
+	if err := s.Store.Put(webhookDeliveryCollection, record.Id, record); err != nil {
+		log.WithError(err).WithFields(log.Fields{"delivery": pReq.Id}).
+			Error("unable to save webhook delivery")
+	}
+}
+
+// failPendingDeliveries marks as failed deliveries left pending by a previous
+// run, their requests being lost with the sender queue
+func (s *WebhookHandler) failPendingDeliveries() {
+	docs, err := s.Store.List(webhookDeliveryCollection)
+	if err != nil {
+		log.WithError(err).Error("unable to read webhook deliveries")
+		return
+	}
+
+	count := 0
+	for _, cDoc := range docs {
+		record := WebhookDelivery{}
+		if err := json.Unmarshal(cDoc, &record); err != nil || WebhookPending != record.Status {
+			continue
+		}
+		record.Status = WebhookFailed
+		if err := s.Store.Put(webhookDeliveryCollection, record.Id, record); err != nil {
+			log.WithError(err).WithFields(log.Fields{"delivery": record.Id}).
+				Error("unable to save webhook delivery")
+			continue
+		}
+		count++
+	}
+	if 0 != count {
+		log.WithFields(log.Fields{"count": count}).Warn("failed webhook deliveries interrupted by restart")
+	}
+}
+
+// pruneDeliveries removes deliveries older than configured retention
+func (s *WebhookHandler) pruneDeliveries() {
+	if 0 == s.Config.RetentionDays {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -s.Config.RetentionDays)
+	count, err := s.Store.Prune(webhookDeliveryCollection, func(pDoc json.RawMessage) bool {
+		record := WebhookDelivery{}
+		if err := json.Unmarshal(pDoc, &record); err != nil {
+			return false
+		}
+		return record.Created.Before(limit)
+	})
+	if err != nil {
+		log.WithError(err).Error("unable to prune webhook deliveries")
+		return
+	}
+	log.WithFields(log.Fields{"count": count}).Debug("pruned webhook deliveries")
+}
+
+// check validates webhook url and secret, url host having to match one of
+// given allowed hosts
+func (s *Webhook) check(pHosts []string) error {
+	addr, err := url.Parse(s.Url)
+	if err != nil || "" == addr.Host || ("http" != addr.Scheme && "https" != addr.Scheme) {
+		return fmt.Errorf("invalid webhook url '%s'", s.Url)
+	}
+	if !core.HostAllowed(pHosts, addr.Hostname()) {
+		return fmt.Errorf("webhook host '%s' is not allowed", addr.Hostname())
+	}
+	if "" == s.Secret {
+		return errors.New("missing webhook secret")
+	}
+	return nil
+}
+
+// public returns webhook without its secret
+func (s Webhook) public() Webhook {
+	s.Secret = ""
+	return s
+}
+
+func (s *WebhookHandler) get(pID string) *Webhook {
+	item := Webhook{}
+	found, err := s.Store.Get(webhookCollection, pID, &item)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	if !found {
+		err := fmt.Errorf("unknown webhook '%s'", pID)
+		panic(core.NewHttpError(err, 404, 41))
+	}
+	return &item
+}
+
+func (s *WebhookHandler) save(pItem *Webhook) {
+	if err := pItem.check(s.Config.WebhookHosts); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	if err := s.Store.Put(webhookCollection, pItem.Id, pItem); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+}
+
+func decodeWebhook(pReq *http.Request) Webhook {
+	item := Webhook{}
+	decoder := json.NewDecoder(pReq.Body)
+	if err := decoder.Decode(&item); err != nil {
+		panic(core.NewHttpError(err, 400, 40))
+	}
+	return item
+}
+
+// requireAdmin returns identity of request caller, webhooks being restricted
+// to owners of the admin scope
+func (s *WebhookHandler) requireAdmin(pReq *http.Request) *core.UaaUserInfo {
+	return requireScope(s.UaaCli, pReq, s.Config.AdminScope, "manage webhooks")
+}
+
+func (s *WebhookHandler) handleList(pRes http.ResponseWriter, pReq *http.Request) {
+	s.requireAdmin(pReq)
+
+	docs, err := s.Store.List(webhookCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	res := []Webhook{}
+	for _, cDoc := range docs {
+		item := Webhook{}
+		if err := json.Unmarshal(cDoc, &item); err != nil {
+			continue
+		}
+		res = append(res, item.public())
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		return res[pI].Created.Before(res[pJ].Created)
+	})
+	core.WriteJson(pRes, res)
+}
+
+func (s *WebhookHandler) handleGet(pRes http.ResponseWriter, pReq *http.Request) {
+	s.requireAdmin(pReq)
+	core.WriteJson(pRes, s.get(mux.Vars(pReq)["id"]).public())
+}
+
+func (s *WebhookHandler) handleCreate(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+
+	item := decodeWebhook(pReq)
+	item.Id = core.NewId()
+	item.Author = caller.UserName
+	item.Created = time.Now()
+	s.save(&item)
+
+	log.WithFields(log.Fields{
+		"webhook": item.public(),
+	}).Info("created webhook")
+	core.WriteJsonStatus(pRes, 201, item.public())
+}
+
+func (s *WebhookHandler) handleUpdate(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+	current := s.get(mux.Vars(pReq)["id"])
+
+	item := decodeWebhook(pReq)
+	item.Id = current.Id
+	item.Author = caller.UserName
+	item.Created = current.Created
+	// secret is kept unless a new one is given
+	if "" == item.Secret {
+		item.Secret = current.Secret
+	}
+	s.save(&item)
+
+	log.WithFields(log.Fields{
+		"webhook": item.public(),
+	}).Info("updated webhook")
+	core.WriteJson(pRes, item.public())
+}
+
+func (s *WebhookHandler) handleDelete(pRes http.ResponseWriter, pReq *http.Request) {
+	caller := s.requireAdmin(pReq)
+	item := s.get(mux.Vars(pReq)["id"])
+
+	if err := s.Store.Delete(webhookCollection, item.Id); err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+	for _, cRecord := range s.listDeliveries(item.Id) {
+		s.Store.Delete(webhookDeliveryCollection, cRecord.Id)
+	}
+
+	log.WithFields(log.Fields{
+		"webhook": item.public(),
+		"user":    caller.UserName,
+	}).Info("deleted webhook")
+	pRes.WriteHeader(204)
+}
+
+// listDeliveries returns deliveries of given webhook, most recent first
+func (s *WebhookHandler) listDeliveries(pID string) []WebhookDelivery {
+	docs, err := s.Store.List(webhookDeliveryCollection)
+	if err != nil {
+		panic(core.NewHttpError(err, 500, 54))
+	}
+
+	res := []WebhookDelivery{}
+	for _, cDoc := range docs {
+		record := WebhookDelivery{}
+		if err := json.Unmarshal(cDoc, &record); err != nil {
+			continue
+		}
+		if record.WebhookId == pID {
+			res = append(res, record)
+		}
+	}
+	sort.Slice(res, func(pI, pJ int) bool {
+		return res[pI].Created.After(res[pJ].Created)
+	})
+	return res
+}
+
+func (s *WebhookHandler) handleDeliveries(pRes http.ResponseWriter, pReq *http.Request) {
+	s.requireAdmin(pReq)
+	item := s.get(mux.Vars(pReq)["id"])
+	core.WriteJson(pRes, s.listDeliveries(item.Id))
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
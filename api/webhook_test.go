@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"os"
+	"time"
+	"io/ioutil"
+	. "github.com/orange-cloudfoundry/cf-wall/api"
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhook", func() {
+	lHosts := []string{"hooks.example.com", ".internal.example.com"}
+
+	lCases := []struct {
+		Name  string
+		Hook  Webhook
+		Hosts []string
+		Valid bool
+	}{
+		{"of allowed host", Webhook{Url: "https://hooks.example.com/a", Secret: "s"}, lHosts, true},
+		{"of allowed sub-domain", Webhook{Url: "https://a.internal.example.com/a", Secret: "s"}, lHosts, true},
+		{"of other host", Webhook{Url: "https://other.example.com/a", Secret: "s"}, lHosts, false},
+		{"without allowed hosts", Webhook{Url: "https://hooks.example.com/a", Secret: "s"}, nil, false},
+		{"without secret", Webhook{Url: "https://hooks.example.com/a"}, lHosts, false},
+		{"of other scheme", Webhook{Url: "ftp://hooks.example.com/a", Secret: "s"}, lHosts, false},
+	}
+
+	for _, cCase := range lCases {
+		lCase := cCase
+		It("checks webhook "+lCase.Name, func() {
+			lErr := lCase.Hook.Check(lCase.Hosts)
+			Expect(lErr == nil).To(Equal(lCase.Valid))
+		})
+	}
+
+	Context("Deliveries", func() {
+		var lDir string
+		var lHandler *WebhookHandler
+
+		BeforeEach(func() {
+			var lErr error
+			lDir, lErr = ioutil.TempDir("", "cf-wall-webhook")
+			Expect(lErr).To(BeNil())
+			lStore, lErr := core.NewStore(lDir)
+			Expect(lErr).To(BeNil())
+			lHandler = NewTestWebhookHandler(lStore, &core.AppConfig{RetentionDays: 30})
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(lDir)
+		})
+
+		lSave := func(pID string, pStatus string, pAge int) {
+			lRecord := WebhookDelivery{
+				Id:      pID,
+				Status:  pStatus,
+				Created: time.Now().AddDate(0, 0, -pAge),
+			}
+			Expect(lHandler.Store.Put("webhook_deliveries", pID, lRecord)).To(BeNil())
+		}
+
+		lGet := func(pID string) (WebhookDelivery, bool) {
+			lRecord := WebhookDelivery{}
+			lFound, lErr := lHandler.Store.Get("webhook_deliveries", pID, &lRecord)
+			Expect(lErr).To(BeNil())
+			return lRecord, lFound
+		}
+
+		It("fails deliveries left pending by a previous run", func() {
+			lSave("pending", WebhookPending, 0)
+			lSave("delivered", WebhookDelivered, 0)
+			lHandler.FailPendingDeliveries()
+			lRecord, _ := lGet("pending")
+			Expect(lRecord.Status).To(Equal(WebhookFailed))
+			lRecord, _ = lGet("delivered")
+			Expect(lRecord.Status).To(Equal(WebhookDelivered))
+		})
+
+		It("removes deliveries older than retention", func() {
+			lSave("recent", WebhookDelivered, 1)
+			lSave("expired", WebhookDelivered, 31)
+			lSave("stale", WebhookPending, 31)
+			lHandler.PruneDeliveries()
+			_, lFound := lGet("recent")
+			Expect(lFound).To(BeTrue())
+			_, lFound = lGet("expired")
+			Expect(lFound).To(BeFalse())
+			_, lFound = lGet("stale")
+			Expect(lFound).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,123 @@
+package chat
+
+import "fmt"
+import "time"
+import "bytes"
+import "errors"
+import "strings"
+import "net/url"
+import "net/http"
+import "encoding/json"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Target is a chat channel reached through an incoming webhook
+type Target struct {
+	Kind    string `json:"kind"`
+	Url     string `json:"url,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Post is an announcement posted to a chat target
+type Post struct {
+	Target   Target
+	Title    string
+	Text     string
+	Severity string
+}
+
+type Notifier struct {
+	config *core.AppConfig
+	Queue  chan *Post
+	client *http.Client
+}
+
+func NewNotifier(pConf *core.AppConfig) *Notifier {
+	return &Notifier{
+		config: pConf,
+		Queue:  make(chan *Post, 500),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Check validates kind and webhook url of target
+func (self *Target) Check() error {
+	if !IsKind(self.Kind) {
+		return fmt.Errorf("invalid chat kind '%s', must be one of %s", self.Kind, strings.Join(Kinds, ", "))
+	}
+	lUrl, lErr := url.Parse(self.Url)
+	if lErr != nil || "" == lUrl.Host || ("http" != lUrl.Scheme && "https" != lUrl.Scheme) {
+		return fmt.Errorf("invalid chat webhook url '%s'", self.Url)
+	}
+	return nil
+}
+
+// Payload returns webhook json payload of post, markdown text being
+// converted to the syntax of target kind
+func (self *Post) Payload() map[string]string {
+	lPrefix := ""
+	if "" != self.Severity {
+		lPrefix = fmt.Sprintf("[%s] ", strings.ToUpper(self.Severity))
+	}
+
+	lRes := map[string]string{
+		"username": "cf-wall",
+	}
+	if Slack == self.Target.Kind {
+		lRes["text"] = fmt.Sprintf("*%s%s*\n\n%s", lPrefix, ToSlack(self.Title), ToSlack(self.Text))
+	} else {
+		lRes["text"] = fmt.Sprintf("#### %s%s\n\n%s", lPrefix, self.Title, self.Text)
+	}
+	if "" != self.Target.Channel {
+		lRes["channel"] = self.Target.Channel
+	}
+	return lRes
+}
+
+func (self *Notifier) send(pPost *Post) error {
+	lBody, lErr := json.Marshal(pPost.Payload())
+	if lErr != nil {
+		return lErr
+	}
+
+	log.WithFields(log.Fields{
+		"kind":    pPost.Target.Kind,
+		"channel": pPost.Target.Channel,
+		"source":  pPost.Target.Source,
+	}).Debug("posting chat message")
+	if self.config.MailDry {
+		return nil
+	}
+
+	lRes, lErr := self.client.Post(pPost.Target.Url, "application/json", bytes.NewReader(lBody))
+	if lErr != nil {
+		lUerr := errors.New("could not reach chat webhook")
+		log.WithError(lErr).Error(lUerr.Error())
+		return lUerr
+	}
+	defer lRes.Body.Close()
+
+	if lRes.StatusCode < 200 || lRes.StatusCode >= 300 {
+		lUerr := fmt.Errorf("chat webhook answered with status %d", lRes.StatusCode)
+		log.WithFields(log.Fields{
+			"source": pPost.Target.Source,
+		}).Error(lUerr.Error())
+		return lUerr
+	}
+	return nil
+}
+
+func (self *Notifier) run() {
+	for {
+		self.send(<-self.Queue)
+	}
+}
+
+func (self *Notifier) Run() {
+	go self.run()
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
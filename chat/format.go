@@ -0,0 +1,92 @@
+package chat
+
+import "fmt"
+import "regexp"
+import "strings"
+
+// Chat kinds
+const (
+	Slack      = "slack"
+	Mattermost = "mattermost"
+)
+
+// Kinds of supported chat webhooks
+var Kinds = []string{Slack, Mattermost}
+
+var headingRegexp = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+var bulletRegexp = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+var boldRegexp = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+var italicRegexp = regexp.MustCompile(`\*([^*\s][^*]*?)\*`)
+var strikeRegexp = regexp.MustCompile(`~~(.+?)~~`)
+var linkRegexp = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+
+const boldMark = "\x00"
+
+// IsKind returns true when given string is a supported chat kind
+func IsKind(pKind string) bool {
+	for _, cKind := range Kinds {
+		if cKind == pKind {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTarget reads chat target from annotation value formatted as
+// "<kind>:<webhook url>"
+func ParseTarget(pVal string) (Target, error) {
+	lIdx := strings.Index(pVal, ":")
+	if lIdx <= 0 {
+		return Target{}, fmt.Errorf("invalid chat target '%s', must be <kind>:<webhook url>", pVal)
+	}
+
+	lRes := Target{
+		Kind: strings.ToLower(strings.TrimSpace(pVal[0:lIdx])),
+		Url:  strings.TrimSpace(pVal[lIdx+1:]),
+	}
+	if lErr := lRes.Check(); lErr != nil {
+		return Target{}, lErr
+	}
+	return lRes, nil
+}
+
+// ToSlack converts given markdown to slack mrkdwn syntax, fenced code blocks
+// being kept unchanged
+func ToSlack(pMarkdown string) string {
+	lLines := strings.Split(pMarkdown, "\n")
+	lFenced := false
+	for cIdx, cLine := range lLines {
+		if strings.HasPrefix(strings.TrimSpace(cLine), "```") {
+			lFenced = !lFenced
+			continue
+		}
+		if lFenced {
+			continue
+		}
+		lLines[cIdx] = slackLine(cLine)
+	}
+	return strings.Join(lLines, "\n")
+}
+
+func slackLine(pLine string) string {
+	lRes := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(pLine)
+
+	// quotes were escaped with other brackets
+	if strings.HasPrefix(lRes, "&gt;") {
+		lRes = ">" + lRes[4:]
+	}
+
+	lRes = linkRegexp.ReplaceAllString(lRes, "<$2|$1>")
+	if lMatch := headingRegexp.FindStringSubmatch(lRes); lMatch != nil {
+		lRes = boldMark + lMatch[1] + boldMark
+	}
+	lRes = bulletRegexp.ReplaceAllString(lRes, "$1• ")
+	lRes = boldRegexp.ReplaceAllString(lRes, boldMark+"$1$2"+boldMark)
+	lRes = italicRegexp.ReplaceAllString(lRes, "_${1}_")
+	lRes = strikeRegexp.ReplaceAllString(lRes, "~$1~")
+	return strings.Replace(lRes, boldMark, "*", -1)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
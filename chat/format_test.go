@@ -0,0 +1,73 @@
+package chat_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/chat"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ToSlack", func() {
+	It("converts emphasis", func() {
+		Expect(ToSlack("**bold** and *italic* and ~~old~~")).
+			To(Equal("*bold* and _italic_ and ~old~"))
+	})
+
+	It("converts headings and bullets", func() {
+		Expect(ToSlack("# Title\n- one\n* two")).
+			To(Equal("*Title*\n• one\n• two"))
+	})
+
+	It("converts links and escapes brackets", func() {
+		Expect(ToSlack("see [doc](https://x.org/a) <now> & > quote")).
+			To(Equal("see <https://x.org/a|doc> &lt;now&gt; &amp; &gt; quote"))
+		Expect(ToSlack("> quote")).To(Equal("> quote"))
+	})
+
+	It("keeps fenced code unchanged", func() {
+		Expect(ToSlack("```\n**a** <b>\n```")).To(Equal("```\n**a** <b>\n```"))
+	})
+})
+
+var _ = Describe("ParseTarget", func() {
+	It("reads kind and url", func() {
+		lRes, lErr := ParseTarget("Slack:https://hooks.slack.com/services/T/B/X")
+		Expect(lErr).To(BeNil())
+		Expect(lRes.Kind).To(Equal(Slack))
+		Expect(lRes.Url).To(Equal("https://hooks.slack.com/services/T/B/X"))
+	})
+
+	It("rejects invalid values", func() {
+		_, lErr := ParseTarget("https://hooks.slack.com/services/T/B/X")
+		Expect(lErr).NotTo(BeNil())
+		_, lErr = ParseTarget("irc:https://irc.example.org")
+		Expect(lErr).NotTo(BeNil())
+		_, lErr = ParseTarget("mattermost:not-an-url")
+		Expect(lErr).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Post", func() {
+	It("builds slack payload", func() {
+		lPost := Post{
+			Target:   Target{Kind: Slack, Url: "https://h", Channel: "#ops"},
+			Title:    "Outage",
+			Text:     "**down**",
+			Severity: "warning",
+		}
+		lRes := lPost.Payload()
+		Expect(lRes["text"]).To(Equal("*[WARNING] Outage*\n\n*down*"))
+		Expect(lRes["channel"]).To(Equal("#ops"))
+	})
+
+	It("keeps markdown for mattermost", func() {
+		lPost := Post{
+			Target: Target{Kind: Mattermost, Url: "https://h"},
+			Title:  "Outage",
+			Text:   "**down**",
+		}
+		lRes := lPost.Payload()
+		Expect(lRes["text"]).To(Equal("#### Outage\n\n**down**"))
+		Expect(lRes).NotTo(HaveKey("channel"))
+	})
+})
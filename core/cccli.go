@@ -1,9 +1,11 @@
 package core
 
+import "fmt"
 import "net/http"
 import "strings"
 import "errors"
 import "net/url"
+import "encoding/json"
 import "github.com/cloudfoundry-community/go-cfclient"
 import log "github.com/sirupsen/logrus"
 
@@ -12,31 +14,43 @@ type CFClient interface {
 	ListSpaces() ([]cfclient.Space, error)
 	ListUsersByQuery(url.Values) (cfclient.Users, error)
 	ListServices() ([]cfclient.Service, error)
+	ListServiceBrokers() ([]cfclient.ServiceBroker, error)
 	ListBuildpacks() ([]cfclient.Buildpack, error)
+	ListStacks() ([]cfclient.Stack, error)
 	ListOrgs() ([]cfclient.Org, error)
+	ListOrgsByQuery(url.Values) ([]cfclient.Org, error)
 	ListSpacesByQuery(url.Values) ([]cfclient.Space, error)
 	ListAppsByQuery(query url.Values) ([]cfclient.App, error)
 	// ListServicesByQuery(query url.Values) ([]cfclient.Service, error)
 	ListServiceInstancesByQuery(query url.Values) ([]cfclient.ServiceInstance, error)
 	ListServiceBindingsByQuery(query url.Values) ([]cfclient.ServiceBinding, error)
+	ListServicePlansByQuery(query url.Values) ([]cfclient.ServicePlan, error)
+	NewRequest(method, path string) *cfclient.Request
+	DoRequest(r *cfclient.Request) (*http.Response, error)
 }
 
-func NewCCCliFromRequest(pUrl string, pReq *http.Request, pSkipVerify bool) (CFClient, error) {
+// GetRequestToken extracts bearer token from request Authorization header
+func GetRequestToken(pReq *http.Request) (string, error) {
 	lAuth, lOk := pReq.Header["Authorization"]
 	if (lOk == false) || (len(lAuth) == 0) {
-		lErr := errors.New("Authorization header is mandatory")
-		log.WithError(lErr).Error("unable to create CC client")
-		return nil, lErr
+		return "", errors.New("Authorization header is mandatory")
 	}
 
 	lParts := strings.Fields(lAuth[0])
 	if len(lParts) < 2 {
-		lErr := errors.New("malformated Authorization header")
+		return "", errors.New("malformated Authorization header")
+	}
+	return lParts[1], nil
+}
+
+func NewCCCliFromRequest(pUrl string, pReq *http.Request, pSkipVerify bool) (CFClient, error) {
+	lToken, lErr := GetRequestToken(pReq)
+	if lErr != nil {
 		log.WithError(lErr).Error("unable to create CC client")
 		return nil, lErr
 	}
 
-	lCli, lErr := NewCCCli(pUrl, lParts[1], pSkipVerify)
+	lCli, lErr := NewCCCli(pUrl, lToken, pSkipVerify)
 	if lErr != nil {
 		log.WithError(lErr).Error("unable to create CC client")
 		return nil, lErr
@@ -58,3 +72,218 @@ func NewCCCli(pUrl string, pToken string, pSkipVerify bool) (*cfclient.Client, e
 
 	return cfclient.NewClient(&lConf)
 }
+
+// GetV3Metadata fetches labels and annotations of given v3 resource, pKind being
+// the resource path such as "organizations" or "spaces"
+func GetV3Metadata(pCli CFClient, pKind string, pGuid string) (*cfclient.V3Metadata, error) {
+	lReq := pCli.NewRequest("GET", fmt.Sprintf("/v3/%s/%s", pKind, pGuid))
+	lRes, lErr := pCli.DoRequest(lReq)
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"kind": pKind,
+			"guid": pGuid,
+		}).Error("unable to fetch resource metadata from CC api")
+		return nil, lErr
+	}
+	defer lRes.Body.Close()
+
+	if lRes.StatusCode != http.StatusOK {
+		lErr := fmt.Errorf("CC api answered with status %d", lRes.StatusCode)
+		log.WithError(lErr).WithFields(log.Fields{
+			"kind": pKind,
+			"guid": pGuid,
+		}).Error("unable to fetch resource metadata from CC api")
+		return nil, lErr
+	}
+
+	lData := struct {
+		Metadata cfclient.V3Metadata `json:"metadata"`
+	}{}
+	lDecoder := json.NewDecoder(lRes.Body)
+	if lErr = lDecoder.Decode(&lData); lErr != nil {
+		log.WithError(lErr).Error("unexpected CC api metadata response format")
+		return nil, lErr
+	}
+	return &lData.Metadata, nil
+}
+
+// ListV3Metadata fetches labels and annotations of given v3 resources in a
+// single listing, indexed by resource guid
+func ListV3Metadata(pCli CFClient, pKind string, pGuids []string) (map[string]cfclient.V3Metadata, error) {
+	lQuery := url.Values{}
+	lQuery.Set("guids", strings.Join(pGuids, ","))
+	lQuery.Set("per_page", "5000")
+	lItems, lErr := listV3Resources(pCli, pKind, lQuery)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	lRes := make(map[string]cfclient.V3Metadata, len(lItems))
+	for _, cItem := range lItems {
+		lData := struct {
+			Guid     string              `json:"guid"`
+			Metadata cfclient.V3Metadata `json:"metadata"`
+		}{}
+		if lErr := json.Unmarshal(cItem, &lData); lErr != nil {
+			return nil, lErr
+		}
+		lRes[lData.Guid] = lData.Metadata
+	}
+	return lRes, nil
+}
+
+// listV3Resources fetches all resources matching given query from given v3
+// endpoint, following result pages
+func listV3Resources(pCli CFClient, pResource string, pQuery url.Values) ([]json.RawMessage, error) {
+	lRes := []json.RawMessage{}
+	lPath := fmt.Sprintf("/v3/%s?%s", pResource, pQuery.Encode())
+
+	for "" != lPath {
+		lReq := pCli.NewRequest("GET", lPath)
+		lResp, lErr := pCli.DoRequest(lReq)
+		if lErr != nil {
+			log.WithError(lErr).WithFields(log.Fields{
+				"resource": pResource,
+				"query":    pQuery.Encode(),
+			}).Error("unable to fetch resources from CC api")
+			return nil, lErr
+		}
+		if lResp.StatusCode != http.StatusOK {
+			lResp.Body.Close()
+			lErr := fmt.Errorf("CC api answered with status %d", lResp.StatusCode)
+			log.WithError(lErr).WithFields(log.Fields{"resource": pResource}).
+				Error("unable to fetch resources from CC api")
+			return nil, lErr
+		}
+
+		lData := struct {
+			Pagination struct {
+				Next *struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"pagination"`
+			Resources []json.RawMessage `json:"resources"`
+		}{}
+		lErr = json.NewDecoder(lResp.Body).Decode(&lData)
+		lResp.Body.Close()
+		if lErr != nil {
+			log.WithError(lErr).WithFields(log.Fields{"resource": pResource}).
+				Error("unexpected CC api response format")
+			return nil, lErr
+		}
+		lRes = append(lRes, lData.Resources...)
+
+		lPath = ""
+		if lData.Pagination.Next != nil && "" != lData.Pagination.Next.Href {
+			lNext, lErr := url.Parse(lData.Pagination.Next.Href)
+			if lErr != nil {
+				return nil, lErr
+			}
+			lPath = lNext.RequestURI()
+		}
+	}
+	return lRes, nil
+}
+
+// V3Role is a role binding a user to an organization or a space
+type V3Role struct {
+	Type  string
+	User  string
+	Org   string
+	Space string
+}
+
+// ListV3Roles fetches all roles matching given query from the v3 roles
+// endpoint
+func ListV3Roles(pCli CFClient, pQuery url.Values) ([]V3Role, error) {
+	lItems, lErr := listV3Resources(pCli, "roles", pQuery)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	lRes := []V3Role{}
+	for _, cItem := range lItems {
+		lRole := struct {
+			Type          string `json:"type"`
+			Relationships struct {
+				User struct {
+					Data struct {
+						Guid string `json:"guid"`
+					} `json:"data"`
+				} `json:"user"`
+				Organization struct {
+					Data *struct {
+						Guid string `json:"guid"`
+					} `json:"data"`
+				} `json:"organization"`
+				Space struct {
+					Data *struct {
+						Guid string `json:"guid"`
+					} `json:"data"`
+				} `json:"space"`
+			} `json:"relationships"`
+		}{}
+		if lErr := json.Unmarshal(cItem, &lRole); lErr != nil {
+			return nil, lErr
+		}
+		lItem := V3Role{
+			Type: lRole.Type,
+			User: lRole.Relationships.User.Data.Guid,
+		}
+		if lRole.Relationships.Organization.Data != nil {
+			lItem.Org = lRole.Relationships.Organization.Data.Guid
+		}
+		if lRole.Relationships.Space.Data != nil {
+			lItem.Space = lRole.Relationships.Space.Data.Guid
+		}
+		lRes = append(lRes, lItem)
+	}
+	return lRes, nil
+}
+
+// V3DropletBuildpack is a buildpack used to stage a droplet
+type V3DropletBuildpack struct {
+	Name          string `json:"name"`
+	BuildpackName string `json:"buildpack_name"`
+	DetectOutput  string `json:"detect_output"`
+	Version       string `json:"version"`
+}
+
+// V3Droplet is the staged result of an application
+type V3Droplet struct {
+	Guid       string               `json:"guid"`
+	App        string               `json:"-"`
+	CreatedAt  string               `json:"created_at"`
+	Buildpacks []V3DropletBuildpack `json:"buildpacks"`
+}
+
+// GetV3CurrentDroplet fetches the droplet currently used by given
+// application, returns nil when application has no current droplet
+func GetV3CurrentDroplet(pCli CFClient, pApp string) (*V3Droplet, error) {
+	lReq := pCli.NewRequest("GET", fmt.Sprintf("/v3/apps/%s/droplets/current", pApp))
+	lRes, lErr := pCli.DoRequest(lReq)
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{"app": pApp}).
+			Error("unable to fetch current droplet from CC api")
+		return nil, lErr
+	}
+	defer lRes.Body.Close()
+
+	if lRes.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if lRes.StatusCode != http.StatusOK {
+		lErr := fmt.Errorf("CC api answered with status %d", lRes.StatusCode)
+		log.WithError(lErr).WithFields(log.Fields{"app": pApp}).
+			Error("unable to fetch current droplet from CC api")
+		return nil, lErr
+	}
+
+	lDroplet := V3Droplet{}
+	if lErr := json.NewDecoder(lRes.Body).Decode(&lDroplet); lErr != nil {
+		log.WithError(lErr).Error("unexpected CC api droplet response format")
+		return nil, lErr
+	}
+	lDroplet.App = pApp
+	return &lDroplet, nil
+}
@@ -15,6 +15,27 @@ import (
 
 type MailCC []string
 
+// StringList is a string list flag, given multiple times on command line
+type StringList []string
+
+// MailSender is a sender identity messages can be sent on behalf of
+type MailSender struct {
+	Id      string `json:"id"       cloud:"id"`
+	Name    string `json:"name"     cloud:"name"`
+	Address string `json:"address"  cloud:"address"`
+	ReplyTo string `json:"reply-to" cloud:"reply-to"`
+}
+
+// ChatChannel maps an organization, or one of its spaces, to the chat
+// webhook announcements are posted to
+type ChatChannel struct {
+	Org     string `json:"org"      cloud:"org"`
+	Space   string `json:"space"    cloud:"space"`
+	Kind    string `json:"kind"     cloud:"kind"`
+	Url     string `json:"url"      cloud:"url"`
+	Channel string `json:"channel"  cloud:"channel"`
+}
+
 type AppConfig struct {
 	ConfigFile       string
 	UaaClientName    string `json:"uaa-client"         cloud:"uaa-client"`
@@ -28,6 +49,8 @@ type AppConfig struct {
 	HttpPort         int    `json:"http-port"          cloud:"http-port"`
 	LogLevel         string `json:"log-level"          cloud:"log-level"`
 	MailFrom         string `json:"mail-from"          cloud:"mail-from"`
+	MailReplyTo      string `json:"mail-reply-to"      cloud:"mail-reply-to"`
+	MailSenders      []MailSender `json:"mail-senders" cloud:"mail-senders"`
 	MailDry          bool   `json:"mail-dry"           cloud:"mail-dry"`
 	MailCc           MailCC `json:"mail-cc"            cloud:"mail-cc"`
 	MailTag          string `json:"mail-tag"           cloud:"mail-tag"`
@@ -35,6 +58,32 @@ type AppConfig struct {
 	MailRateDuration int    `json:"mail-rate-duration" cloud:"mail-rate-duration"`
 	ReloadTemplates  bool   `json:"reload-templates"   cloud:"reload-templates"`
 	NbMaxGetParams   int    `json:"nb-max-get-params"  cloud:"nb-max-get-params"`
+	DataDir          string `json:"data-dir"           cloud:"data-dir"`
+	DefaultLanguage  string `json:"default-language"   cloud:"default-language"`
+	LangAnnotation   string `json:"language-annotation" cloud:"language-annotation"`
+	MailLayout       string `json:"mail-layout"        cloud:"mail-layout"`
+	MailLogoUrl      string `json:"mail-logo-url"      cloud:"mail-logo-url"`
+	MailFooter       string `json:"mail-footer"        cloud:"mail-footer"`
+	ApprovalRequired bool   `json:"approval-required"  cloud:"approval-required"`
+	ApproverScope    string `json:"approver-scope"     cloud:"approver-scope"`
+	AdminScope       string `json:"admin-scope"        cloud:"admin-scope"`
+	MandatoryCategories []string `json:"mandatory-categories" cloud:"mandatory-categories"`
+	ChatChannels     []ChatChannel `json:"chat-channels" cloud:"chat-channels"`
+	ChatAnnotation   string `json:"chat-annotation"    cloud:"chat-annotation"`
+	ChatHosts        StringList `json:"chat-hosts"     cloud:"chat-hosts"`
+	WebhookRetries   int    `json:"webhook-retries"    cloud:"webhook-retries"`
+	WebhookBackoff   int    `json:"webhook-backoff"    cloud:"webhook-backoff"`
+	WebhookHosts     StringList `json:"webhook-hosts"  cloud:"webhook-hosts"`
+	FeedKey          string `json:"feed-key"           cloud:"feed-key"`
+	RetentionDays    int    `json:"retention-days"     cloud:"retention-days"`
+	CorsOrigins      StringList `json:"cors-origins"   cloud:"cors-origins"`
+	SmsGatewayUrl    string `json:"sms-gateway-url"    cloud:"sms-gateway-url"`
+	SmsGatewayMethod string `json:"sms-gateway-method" cloud:"sms-gateway-method"`
+	SmsGatewayBody   string `json:"sms-gateway-body"   cloud:"sms-gateway-body"`
+	SmsGatewayHeaders StringList `json:"sms-gateway-headers" cloud:"sms-gateway-headers"`
+	SmsMaxLength     int    `json:"sms-max-length"     cloud:"sms-max-length"`
+	SmsRateCount     int    `json:"sms-rate-count"     cloud:"sms-rate-count"`
+	SmsRateDuration  int    `json:"sms-rate-duration"  cloud:"sms-rate-duration"`
 	Version          bool
 }
 
@@ -47,6 +96,31 @@ func (self *MailCC) Set(pVal string) error {
 	return nil
 }
 
+func (self *StringList) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *StringList) Set(pVal string) error {
+	*self = append(*self, pVal)
+	return nil
+}
+
+// HostAllowed returns true when given host matches one of given allowed
+// hosts, entries starting with a dot matching all sub-domains
+func HostAllowed(pAllowed []string, pHost string) bool {
+	lHost := strings.ToLower(pHost)
+	for _, cAllowed := range pAllowed {
+		lAllowed := strings.ToLower(cAllowed)
+		if lHost == lAllowed {
+			return true
+		}
+		if strings.HasPrefix(lAllowed, ".") && strings.HasSuffix(lHost, lAllowed) {
+			return true
+		}
+	}
+	return false
+}
+
 func InitLogger(pLevel string) {
 	log.SetFormatter(&log.TextFormatter{
 		ForceColors: true,
@@ -60,7 +134,22 @@ func InitLogger(pLevel string) {
 }
 
 func NewAppConfig() AppConfig {
-	lConf := AppConfig{}
+	lConf := AppConfig{
+		DataDir:         "data",
+		DefaultLanguage: "en",
+		LangAnnotation:  "cf-wall/language",
+		MailLayout:      "mail/templates/layout.tpl",
+		ApproverScope:   "cf-wall.approver",
+		AdminScope:      "cf-wall.admin",
+		MandatoryCategories: []string{"incident", "security"},
+		ChatAnnotation:  "cf-wall/chat",
+		WebhookRetries:  5,
+		WebhookBackoff:  10,
+		RetentionDays:   365,
+		SmsGatewayMethod: "POST",
+		SmsGatewayBody:  `{"to": {{json .To}}, "text": {{json .Text}}}`,
+		SmsMaxLength:    160,
+	}
 
 	InitLogger("error")
 	lConf.parseArgs()
@@ -96,15 +185,40 @@ func (self *AppConfig) parseCmdLine() {
 	flag.IntVar(&self.HttpPort, "http-port", self.HttpPort, "Web server port")
 	flag.StringVar(&self.LogLevel, "log-level", self.LogLevel, "Logger verbosity level")
 	flag.StringVar(&self.MailFrom, "mail-from", self.MailFrom, "Mail From: address")
-	flag.BoolVar(&self.MailDry, "mail-dry", self.MailDry, "Disable actual mail sending (dev)")
+	flag.StringVar(&self.MailReplyTo, "mail-reply-to", self.MailReplyTo, "Mail Reply-To: address")
+	flag.BoolVar(&self.MailDry, "mail-dry", self.MailDry, "Disable actual mail, chat, sms and webhook sending (dev)")
 	flag.StringVar(&self.MailTag, "mail-tag", self.MailTag, "Additional tag prefix for sent mails")
 	flag.IntVar(&self.MailRateCount, "mail-rate-count", self.MailRateCount, "Limit number of mail sent per timed window")
 	flag.IntVar(&self.MailRateDuration, "mail-rate-duration", self.MailRateDuration, "Duration (in seconds) of timed window")
 	flag.BoolVar(&self.ReloadTemplates, "reload-templates", self.ReloadTemplates, "Reload ui template on each request (dev)")
 	flag.IntVar(&self.NbMaxGetParams, "nb-max-get-params", self.NbMaxGetParams, "Maximum number of get parameters for http requests")
+	flag.StringVar(&self.DataDir, "data-dir", self.DataDir, "Directory where persistent data is stored")
+	flag.StringVar(&self.DefaultLanguage, "default-language", self.DefaultLanguage, "Language of messages sent to users without preference")
+	flag.StringVar(&self.LangAnnotation, "language-annotation", self.LangAnnotation, "Organization annotation giving the language of its users")
+	flag.StringVar(&self.MailLayout, "mail-layout", self.MailLayout, "Path to html template wrapping mail bodies")
+	flag.StringVar(&self.MailLogoUrl, "mail-logo-url", self.MailLogoUrl, "Url of logo displayed in mail header")
+	flag.StringVar(&self.MailFooter, "mail-footer", self.MailFooter, "Text displayed in mail footer")
+	flag.BoolVar(&self.ApprovalRequired, "approval-required", self.ApprovalRequired, "Messages must be approved by a second user before being sent")
+	flag.StringVar(&self.ApproverScope, "approver-scope", self.ApproverScope, "UAA scope required to approve messages")
+	flag.StringVar(&self.AdminScope, "admin-scope", self.AdminScope, "UAA scope required to manage suppressions and webhooks")
+	flag.StringVar(&self.ChatAnnotation, "chat-annotation", self.ChatAnnotation, "Organization and space annotation giving their chat webhook")
+	flag.IntVar(&self.WebhookRetries, "webhook-retries", self.WebhookRetries, "Number of retries of failed webhook deliveries")
+	flag.IntVar(&self.WebhookBackoff, "webhook-backoff", self.WebhookBackoff, "Delay (in seconds) before first webhook retry, doubled on each retry")
+	flag.IntVar(&self.RetentionDays, "retention-days", self.RetentionDays, "Number of days audit entries and webhook deliveries are kept (0 keeps them forever)")
+	flag.StringVar(&self.FeedKey, "feed-key", self.FeedKey, "Key deriving feed secrets (leave empty to disable secret feed access)")
+	flag.StringVar(&self.SmsGatewayUrl, "sms-gateway-url", self.SmsGatewayUrl, "Url template of the sms gateway api (leave empty to disable sms)")
+	flag.StringVar(&self.SmsGatewayMethod, "sms-gateway-method", self.SmsGatewayMethod, "Http method of sms gateway requests")
+	flag.StringVar(&self.SmsGatewayBody, "sms-gateway-body", self.SmsGatewayBody, "Body template of sms gateway requests")
+	flag.IntVar(&self.SmsMaxLength, "sms-max-length", self.SmsMaxLength, "Maximum length of sms texts")
+	flag.IntVar(&self.SmsRateCount, "sms-rate-count", self.SmsRateCount, "Limit number of sms sent per timed window")
+	flag.IntVar(&self.SmsRateDuration, "sms-rate-duration", self.SmsRateDuration, "Duration (in seconds) of sms timed window")
 	flag.BoolVar(&self.Version, "version", self.Version, "Show version")
 
 	flag.Var(&self.MailCc, "mail-cc", "List of additional recipients to all mails (can give multiple times)")
+	flag.Var(&self.ChatHosts, "chat-hosts", "Hosts chat annotations may post to, '.domain' allowing sub-domains (can give multiple times, empty ignores annotations)")
+	flag.Var(&self.CorsOrigins, "cors-origins", "Origin allowed to embed active announcements, '*' allowing any origin (can give multiple times)")
+	flag.Var(&self.SmsGatewayHeaders, "sms-gateway-headers", "Header of sms gateway requests as 'Name: value' (can give multiple times)")
+	flag.Var(&self.WebhookHosts, "webhook-hosts", "Hosts webhooks may be registered on, '.domain' allowing sub-domains (can give multiple times, empty rejects webhooks)")
 	flag.Parse()
 }
 
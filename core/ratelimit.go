@@ -0,0 +1,59 @@
+package core
+
+import "time"
+import log "github.com/sirupsen/logrus"
+
+// RateLimiter limits the number of events within a timed window
+type RateLimiter struct {
+	count int
+	size  time.Duration
+	start time.Time
+	done  int
+}
+
+// NewRateLimiter allows pCount events every pDuration seconds
+func NewRateLimiter(pCount int, pDuration int) *RateLimiter {
+	return &RateLimiter{
+		count: pCount,
+		size:  time.Duration(pDuration) * time.Second,
+		start: time.Now(),
+	}
+}
+
+// Wait blocks until a new event is allowed, and counts it
+func (self *RateLimiter) Wait() {
+	lElapsed := time.Now().Sub(self.start)
+
+	// no event on last interval
+	if lElapsed > self.size {
+		log.WithFields(log.Fields{
+			"elapsed(s)": lElapsed.Seconds(),
+			"size(s)":    self.size.Seconds(),
+			"count":      self.done,
+		}).Debug("last interval too old, reset")
+		self.start = time.Now()
+		self.done = 0
+	} else if self.done < self.count {
+		log.WithFields(log.Fields{
+			"elapsed(s)": lElapsed.Seconds(),
+			"size(s)":    self.size.Seconds(),
+			"count":      self.done,
+		}).Debug("request within rate limit")
+	} else {
+		lDelay := self.size - lElapsed
+		log.WithFields(log.Fields{
+			"elapsed(s)": lElapsed.Seconds(),
+			"size(s)":    self.size.Seconds(),
+			"count":      self.done,
+			"delay":      lDelay.Seconds(),
+		}).Debug("reached rate limit, sleeping")
+		time.Sleep(lDelay)
+		self.start = time.Now()
+		self.done = 0
+	}
+	self.done += 1
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,249 @@
+package core
+
+import "os"
+import "fmt"
+import "strings"
+import "crypto/rand"
+import "encoding/hex"
+import "sync"
+import "io/ioutil"
+import "path/filepath"
+import "encoding/json"
+import log "github.com/sirupsen/logrus"
+
+// Store persists json documents into collections, each collection being a
+// directory holding one file per document so that saving a document never
+// rewrites the others
+type Store struct {
+	Dir   string
+	lock  sync.Mutex
+	ready map[string]bool
+}
+
+func NewStore(pDir string) (*Store, error) {
+	if lErr := os.MkdirAll(pDir, 0700); lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"dir": pDir,
+		}).Error("unable to create data directory")
+		return nil, lErr
+	}
+	return &Store{Dir: pDir}, nil
+}
+
+func (self *Store) dir(pColl string) string {
+	return filepath.Join(self.Dir, pColl)
+}
+
+func (self *Store) path(pColl string, pKey string) string {
+	return filepath.Join(self.dir(pColl), pKey+".json")
+}
+
+func checkKey(pKey string) error {
+	if "" == pKey || strings.HasPrefix(pKey, ".") || strings.ContainsAny(pKey, `/\`) {
+		return fmt.Errorf("invalid document key '%s'", pKey)
+	}
+	return nil
+}
+
+// prepare creates directory of given collection, documents of collections
+// stored in a single file by former versions being moved to their own file
+func (self *Store) prepare(pColl string) error {
+	if self.ready[pColl] {
+		return nil
+	}
+	if lErr := os.MkdirAll(self.dir(pColl), 0700); lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"collection": pColl,
+		}).Error("unable to create store collection")
+		return lErr
+	}
+
+	lLegacy := filepath.Join(self.Dir, pColl+".json")
+	lData, lErr := ioutil.ReadFile(lLegacy)
+	if lErr != nil && !os.IsNotExist(lErr) {
+		return lErr
+	}
+	if lErr == nil {
+		lDocs := make(map[string]json.RawMessage)
+		if lErr = json.Unmarshal(lData, &lDocs); lErr != nil {
+			log.WithError(lErr).WithFields(log.Fields{
+				"collection": pColl,
+			}).Error("unable to parse store collection")
+			return lErr
+		}
+		for cKey, cVal := range lDocs {
+			if lErr = self.write(pColl, cKey, cVal); lErr != nil {
+				return lErr
+			}
+		}
+		if lErr = os.Remove(lLegacy); lErr != nil {
+			return lErr
+		}
+		log.WithFields(log.Fields{
+			"collection": pColl,
+			"count":      len(lDocs),
+		}).Info("migrated store collection to one file per document")
+	}
+
+	if self.ready == nil {
+		self.ready = make(map[string]bool)
+	}
+	self.ready[pColl] = true
+	return nil
+}
+
+func (self *Store) read(pColl string, pKey string) (json.RawMessage, bool, error) {
+	if lErr := self.prepare(pColl); lErr != nil {
+		return nil, false, lErr
+	}
+	lData, lErr := ioutil.ReadFile(self.path(pColl, pKey))
+	if os.IsNotExist(lErr) {
+		return nil, false, nil
+	}
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"collection": pColl,
+			"key":        pKey,
+		}).Error("unable to read store document")
+		return nil, false, lErr
+	}
+	return lData, true, nil
+}
+
+func (self *Store) write(pColl string, pKey string, pData []byte) error {
+	if lErr := checkKey(pKey); lErr != nil {
+		return lErr
+	}
+
+	// write then rename so that a crash never leaves a truncated document
+	lTmp := self.path(pColl, pKey) + ".tmp"
+	if lErr := ioutil.WriteFile(lTmp, pData, 0600); lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"collection": pColl,
+			"key":        pKey,
+		}).Error("unable to write store document")
+		return lErr
+	}
+	return os.Rename(lTmp, self.path(pColl, pKey))
+}
+
+func (self *Store) load(pColl string) (map[string]json.RawMessage, error) {
+	if lErr := self.prepare(pColl); lErr != nil {
+		return nil, lErr
+	}
+	lFiles, lErr := ioutil.ReadDir(self.dir(pColl))
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"collection": pColl,
+		}).Error("unable to read store collection")
+		return nil, lErr
+	}
+
+	lRes := make(map[string]json.RawMessage)
+	for _, cFile := range lFiles {
+		lKey := strings.TrimSuffix(cFile.Name(), ".json")
+		if cFile.IsDir() || lKey == cFile.Name() {
+			continue
+		}
+		lVal, lOk, lErr := self.read(pColl, lKey)
+		if lErr != nil {
+			return nil, lErr
+		}
+		if lOk {
+			lRes[lKey] = lVal
+		}
+	}
+	return lRes, nil
+}
+
+// Get decodes document pKey of collection pColl into pObj, returns false
+// when document does not exist
+func (self *Store) Get(pColl string, pKey string, pObj interface{}) (bool, error) {
+	if lErr := checkKey(pKey); lErr != nil {
+		return false, nil
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	lVal, lOk, lErr := self.read(pColl, pKey)
+	if lErr != nil || !lOk {
+		return false, lErr
+	}
+	return true, json.Unmarshal(lVal, pObj)
+}
+
+func (self *Store) Put(pColl string, pKey string, pObj interface{}) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if lErr := self.prepare(pColl); lErr != nil {
+		return lErr
+	}
+	lVal, lErr := json.Marshal(pObj)
+	if lErr != nil {
+		return lErr
+	}
+	return self.write(pColl, pKey, lVal)
+}
+
+func (self *Store) Delete(pColl string, pKey string) error {
+	if lErr := checkKey(pKey); lErr != nil {
+		return lErr
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if lErr := self.prepare(pColl); lErr != nil {
+		return lErr
+	}
+	lErr := os.Remove(self.path(pColl, pKey))
+	if lErr != nil && !os.IsNotExist(lErr) {
+		return lErr
+	}
+	return nil
+}
+
+// Prune removes documents of collection pColl for which pDrop returns true,
+// returns number of removed documents
+func (self *Store) Prune(pColl string, pDrop func(json.RawMessage) bool) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	lData, lErr := self.load(pColl)
+	if lErr != nil {
+		return 0, lErr
+	}
+	lCount := 0
+	for cKey, cVal := range lData {
+		if !pDrop(cVal) {
+			continue
+		}
+		if lErr := os.Remove(self.path(pColl, cKey)); lErr != nil && !os.IsNotExist(lErr) {
+			return lCount, lErr
+		}
+		lCount++
+	}
+	return lCount, nil
+}
+
+// List returns all raw documents of given collection indexed by key
+func (self *Store) List(pColl string) (map[string]json.RawMessage, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.load(pColl)
+}
+
+// NewId returns a random identifier for stored documents
+func NewId() string {
+	lBuf := make([]byte, 16)
+	if _, lErr := rand.Read(lBuf); lErr != nil {
+		log.WithError(lErr).Panic("unable to generate random identifier")
+	}
+	return hex.EncodeToString(lBuf)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -22,6 +22,7 @@ type UaaUser struct {
 	FirstName string `json:"firstname"`
 	LastName  string `json:"lastname"`
 	Email     string `json:"email"`
+	Phone     string `json:"phone"`
 }
 
 func NewUaaCli(pConf *AppConfig) (*UaaCli, error) {
@@ -60,11 +61,14 @@ func (self *UaaCli) sendRequest(pUrl *url.URL) (*http.Response, error) {
 	if lErr := self.ensureToken(); lErr != nil {
 		return nil, lErr
 	}
+	return self.sendTokenRequest(pUrl, self.Token)
+}
 
+func (self *UaaCli) sendTokenRequest(pUrl *url.URL, pToken string) (*http.Response, error) {
 	lHttpCli := http.Client{}
 	lHeaders := http.Header{}
 
-	lHeaders.Add("Authorization", fmt.Sprintf("bearer %s", self.Token))
+	lHeaders.Add("Authorization", fmt.Sprintf("bearer %s", pToken))
 	lHeaders.Add("Accept", "application/json")
 
 	lReq := &http.Request{
@@ -100,6 +104,53 @@ func (self *UaaCli) sendRequest(pUrl *url.URL) (*http.Response, error) {
 	return lRes, nil
 }
 
+// UaaUserInfo --
+type UaaUserInfo struct {
+	Id       string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Email    string `json:"email"`
+}
+
+// GetUserInfo returns identity of the owner of given user token
+func (self *UaaCli) GetUserInfo(pToken string) (*UaaUserInfo, error) {
+	log.Info("requesting user info on UAA api")
+
+	lUrl, _ := url.Parse(fmt.Sprintf("%s/userinfo", self.Endpoint))
+	lRes, lErr := self.sendTokenRequest(lUrl, pToken)
+	if lErr != nil {
+		return nil, lErr
+	}
+	defer lRes.Body.Close()
+
+	lDecoder := json.NewDecoder(lRes.Body)
+	lData := UaaUserInfo{}
+	lErr = lDecoder.Decode(&lData)
+	if lErr != nil {
+		log.WithError(lErr).Error("unexpected UAA api user info response format")
+		return nil, lErr
+	}
+	return &lData, nil
+}
+
+// HasScope returns true when given user token is valid and grants pScope
+func (self *UaaCli) HasScope(pToken string, pScope string) (lRes bool) {
+	// decoder panics on tokens without scope claim
+	defer func() {
+		if lErr := recover(); lErr != nil {
+			lRes = false
+		}
+	}()
+
+	lErr := self.Client.DecodeToken(fmt.Sprintf("bearer %s", pToken), pScope)
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"scope": pScope,
+		}).Info("token does not grant scope")
+		return false
+	}
+	return true
+}
+
 type userListUaaResponse struct {
 	StartIndex   int `json:"startIndex"`
 	ItemsPerPage int `json:"itemsPerPage"`
@@ -110,6 +161,9 @@ type userListUaaResponse struct {
 		Emails []struct {
 			Value string `json:"value"`
 		} `json:"emails"`
+		PhoneNumbers []struct {
+			Value string `json:"value"`
+		} `json:"phoneNumbers"`
 		Name struct {
 			LastName  string `json:"familyName"`
 			FirstName string `json:"givenName"`
@@ -120,10 +174,10 @@ type userListUaaResponse struct {
 func (self *UaaCli) getUserListIndex(pIdx int) (*userListUaaResponse, error) {
 	log.WithFields(log.Fields{
 		"index":  pIdx,
-		"fields": "id,emails,name,active",
+		"fields": "id,emails,phoneNumbers,name,active",
 	}).Debug("requesting UAA users index")
 
-	lUrlfmt := "%s/Users?startIndex=%d&count=%d&attributes=id,emails,name,active"
+	lUrlfmt := "%s/Users?startIndex=%d&count=%d&attributes=id,emails,phoneNumbers,name,active"
 	lUrlstr := fmt.Sprintf(lUrlfmt, self.Endpoint, pIdx, 500)
 	lUrl, _ := url.Parse(lUrlstr)
 
@@ -158,6 +212,9 @@ func append_users(pUsers *[]UaaUser, pUaaUsers *userListUaaResponse) {
 			if len(cEl.Emails) != 0 {
 				lUser.Email = cEl.Emails[0].Value
 			}
+			if len(cEl.PhoneNumbers) != 0 {
+				lUser.Phone = cEl.PhoneNumbers[0].Value
+			}
 			*pUsers = append(*pUsers, lUser)
 		}
 	}
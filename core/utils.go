@@ -22,6 +22,13 @@ func WriteJson(pWriter http.ResponseWriter, pObj interface{}) {
 	pWriter.Write(lVal)
 }
 
+func WriteJsonStatus(pWriter http.ResponseWriter, pStatus int, pObj interface{}) {
+	lVal, _ := json.Marshal(pObj)
+	pWriter.Header().Set("Content-Type", "application/json")
+	pWriter.WriteHeader(pStatus)
+	pWriter.Write(lVal)
+}
+
 func WriteJsonError(pWriter http.ResponseWriter, pStatus int, pCode int, pErr error) {
 	lErr := struct {
 		Code  int    `json:"code"`
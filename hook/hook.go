@@ -0,0 +1,135 @@
+package hook
+
+import "fmt"
+import "time"
+import "bytes"
+import "net/http"
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/hex"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Headers set on webhook requests
+const (
+	EventHeader     = "X-Cf-Wall-Event"
+	DeliveryHeader  = "X-Cf-Wall-Delivery"
+	SignatureHeader = "X-Cf-Wall-Signature"
+)
+
+// Request is a json payload posted to a subscribed url
+type Request struct {
+	Id     string
+	Url    string
+	Secret string
+	Event  string
+	Body   []byte
+}
+
+// Attempt is the result of a single post of a request
+type Attempt struct {
+	Date   time.Time `json:"date"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type Sender struct {
+	config *core.AppConfig
+	Queue  chan *Request
+	client *http.Client
+
+	// OnResult is called once request is delivered or all retries failed
+	OnResult func(*Request, []Attempt, bool)
+}
+
+func NewSender(pConf *core.AppConfig) *Sender {
+	return &Sender{
+		config: pConf,
+		Queue:  make(chan *Request, 500),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Sign returns the HMAC-SHA256 signature of given body, formatted as
+// "sha256=<hex digest>"
+func Sign(pSecret string, pBody []byte) string {
+	lMac := hmac.New(sha256.New, []byte(pSecret))
+	lMac.Write(pBody)
+	return "sha256=" + hex.EncodeToString(lMac.Sum(nil))
+}
+
+func (self *Sender) post(pReq *Request) Attempt {
+	lRes := Attempt{Date: time.Now()}
+	if self.config.MailDry {
+		lRes.Status = 200
+		return lRes
+	}
+
+	lHttpReq, lErr := http.NewRequest("POST", pReq.Url, bytes.NewReader(pReq.Body))
+	if lErr != nil {
+		lRes.Error = lErr.Error()
+		return lRes
+	}
+	lHttpReq.Header.Set("Content-Type", "application/json")
+	lHttpReq.Header.Set(EventHeader, pReq.Event)
+	lHttpReq.Header.Set(DeliveryHeader, pReq.Id)
+	lHttpReq.Header.Set(SignatureHeader, Sign(pReq.Secret, pReq.Body))
+
+	lHttpRes, lErr := self.client.Do(lHttpReq)
+	if lErr != nil {
+		lRes.Error = lErr.Error()
+		return lRes
+	}
+	defer lHttpRes.Body.Close()
+
+	lRes.Status = lHttpRes.StatusCode
+	if lRes.Status < 200 || lRes.Status >= 300 {
+		lRes.Error = fmt.Sprintf("unexpected status %d", lRes.Status)
+	}
+	return lRes
+}
+
+// Deliver posts given request until it succeeds, retrying with an
+// exponential backoff up to the configured number of retries
+func (self *Sender) Deliver(pReq *Request) {
+	lDelay := time.Duration(self.config.WebhookBackoff) * time.Second
+	lAttempts := []Attempt{}
+	lSuccess := false
+
+	for cIdx := 0; cIdx <= self.config.WebhookRetries; cIdx++ {
+		if 0 != cIdx {
+			time.Sleep(lDelay)
+			lDelay *= 2
+		}
+		lAttempt := self.post(pReq)
+		lAttempts = append(lAttempts, lAttempt)
+		if "" == lAttempt.Error {
+			lSuccess = true
+			break
+		}
+		log.WithFields(log.Fields{
+			"delivery": pReq.Id,
+			"attempt":  cIdx + 1,
+			"error":    lAttempt.Error,
+		}).Warn("webhook delivery failed")
+	}
+
+	if self.OnResult != nil {
+		self.OnResult(pReq, lAttempts, lSuccess)
+	}
+}
+
+func (self *Sender) run() {
+	for {
+		lReq := <-self.Queue
+		go self.Deliver(lReq)
+	}
+}
+
+func (self *Sender) Run() {
+	go self.run()
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,74 @@
+package hook_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/orange-cloudfoundry/cf-wall/hook"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sign", func() {
+	It("computes HMAC-SHA256 of body", func() {
+		Expect(Sign("key", []byte("The quick brown fox jumps over the lazy dog"))).
+			To(Equal("sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"))
+	})
+})
+
+var _ = Describe("Sender", func() {
+	var lCalls int
+	var lSignatures []string
+	var lServer *httptest.Server
+
+	BeforeEach(func() {
+		lCalls = 0
+		lSignatures = []string{}
+		lServer = httptest.NewServer(http.HandlerFunc(func(pRes http.ResponseWriter, pReq *http.Request) {
+			lBody, _ := ioutil.ReadAll(pReq.Body)
+			lCalls += 1
+			lSignatures = append(lSignatures, pReq.Header.Get(SignatureHeader))
+			Expect(pReq.Header.Get(SignatureHeader)).To(Equal(Sign("secret", lBody)))
+			Expect(pReq.Header.Get(EventHeader)).To(Equal("message.sent"))
+			if lCalls < 2 {
+				pRes.WriteHeader(503)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		lServer.Close()
+	})
+
+	It("retries failed deliveries", func() {
+		lSender := NewSender(&core.AppConfig{WebhookRetries: 3})
+		lDone := false
+		var lAttempts []Attempt
+		lSender.OnResult = func(pReq *Request, pAttempts []Attempt, pSuccess bool) {
+			lDone = pSuccess
+			lAttempts = pAttempts
+		}
+
+		lSender.Deliver(&Request{Id: "1", Url: lServer.URL, Secret: "secret", Event: "message.sent", Body: []byte(`{}`)})
+		Expect(lDone).To(BeTrue())
+		Expect(lAttempts).To(HaveLen(2))
+		Expect(lAttempts[0].Status).To(Equal(503))
+		Expect(lAttempts[0].Error).NotTo(BeEmpty())
+		Expect(lAttempts[1].Error).To(BeEmpty())
+	})
+
+	It("gives up after configured retries", func() {
+		lSender := NewSender(&core.AppConfig{WebhookRetries: 0})
+		lDone := true
+		lSender.OnResult = func(pReq *Request, pAttempts []Attempt, pSuccess bool) {
+			lDone = pSuccess
+			Expect(pAttempts).To(HaveLen(1))
+		}
+
+		lSender.Deliver(&Request{Id: "1", Url: lServer.URL, Secret: "secret", Event: "message.sent", Body: []byte(`{}`)})
+		Expect(lDone).To(BeFalse())
+	})
+})
@@ -0,0 +1,37 @@
+package mail
+
+import "strings"
+import "net/mail"
+
+// NormalizeAddress parses given address and formats it with its trimmed
+// display name. Address case is kept, local parts being case sensitive for
+// some mail servers
+func NormalizeAddress(pAddr string) (string, error) {
+	lAddr, lErr := mail.ParseAddress(strings.TrimSpace(pAddr))
+	if lErr != nil {
+		return "", lErr
+	}
+	lAddr.Name = strings.TrimSpace(lAddr.Name)
+	if "" == lAddr.Name {
+		return lAddr.Address, nil
+	}
+	return lAddr.String(), nil
+}
+
+// AddressKey returns given normalized address without display name and lower
+// cased, so that differently written addresses of a same mailbox compare
+// equal
+func AddressKey(pAddr string) string {
+	if !strings.Contains(pAddr, "<") {
+		return strings.ToLower(strings.TrimSpace(pAddr))
+	}
+	lAddr, lErr := mail.ParseAddress(pAddr)
+	if lErr != nil {
+		return strings.ToLower(strings.TrimSpace(pAddr))
+	}
+	return strings.ToLower(lAddr.Address)
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
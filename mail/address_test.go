@@ -0,0 +1,34 @@
+package mail_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/mail"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NormalizeAddress", func() {
+	It("keeps trimmed display names and address case", func() {
+		lRes, lErr := NormalizeAddress("  \"John Doe \" <John.Doe@Example.COM> ")
+		Expect(lErr).To(BeNil())
+		Expect(lRes).To(Equal("\"John Doe\" <John.Doe@Example.COM>"))
+	})
+
+	It("returns bare addresses without display name", func() {
+		lRes, lErr := NormalizeAddress(" <John.Doe@Example.COM>")
+		Expect(lErr).To(BeNil())
+		Expect(lRes).To(Equal("John.Doe@Example.COM"))
+	})
+
+	It("rejects invalid addresses", func() {
+		_, lErr := NormalizeAddress("not an address")
+		Expect(lErr).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("AddressKey", func() {
+	It("strips display names and lower cases addresses", func() {
+		Expect(AddressKey("\"John Doe\" <John.Doe@Example.COM>")).To(Equal("john.doe@example.com"))
+		Expect(AddressKey("John.Doe@Example.COM")).To(Equal("john.doe@example.com"))
+	})
+})
@@ -0,0 +1,251 @@
+package mail
+
+import "sort"
+import "bytes"
+import "regexp"
+import "strings"
+import "golang.org/x/net/html"
+
+// cssSelector is a compound selector such as "td.header" or "#footer"
+type cssSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// cssRule is a single selector with its declarations, selectors being
+// a chain of descendant compounds, the last one matching the styled element
+type cssRule struct {
+	selectors   []cssSelector
+	specificity int
+	order       int
+	decls       string
+}
+
+var cssComments = regexp.MustCompile(`(?s)/\*.*?\*/`)
+var cssCompound = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*|\*)?((?:[.#][-_a-zA-Z0-9]+)*)$`)
+var cssParts = regexp.MustCompile(`[.#][-_a-zA-Z0-9]+`)
+
+// InlineCss moves rules of <style> elements found in given html document
+// into the style attribute of matching elements. Only tag, class, id and
+// descendant selectors are supported, other rules and at-rules are dropped
+func InlineCss(pHtml string) (string, error) {
+	lDoc, lErr := html.Parse(strings.NewReader(pHtml))
+	if lErr != nil {
+		return "", lErr
+	}
+
+	lCss := ""
+	lStyles := []*html.Node{}
+	walkNodes(lDoc, func(pNode *html.Node) {
+		if pNode.Type == html.ElementNode && pNode.Data == "style" {
+			if pNode.FirstChild != nil {
+				lCss += pNode.FirstChild.Data + "\n"
+			}
+			lStyles = append(lStyles, pNode)
+		}
+	})
+	for _, cNode := range lStyles {
+		cNode.Parent.RemoveChild(cNode)
+	}
+
+	lRules := parseCss(lCss)
+	walkNodes(lDoc, func(pNode *html.Node) {
+		if pNode.Type == html.ElementNode {
+			applyRules(pNode, lRules)
+		}
+	})
+
+	lBuf := bytes.Buffer{}
+	if lErr = html.Render(&lBuf, lDoc); lErr != nil {
+		return "", lErr
+	}
+	return lBuf.String(), nil
+}
+
+func walkNodes(pNode *html.Node, pFunc func(*html.Node)) {
+	pFunc(pNode)
+	for cChild := pNode.FirstChild; cChild != nil; cChild = cChild.NextSibling {
+		walkNodes(cChild, pFunc)
+	}
+}
+
+func parseCss(pCss string) []cssRule {
+	lRes := []cssRule{}
+	lCss := cssComments.ReplaceAllString(pCss, "")
+
+	for {
+		lOpen := strings.Index(lCss, "{")
+		if lOpen < 0 {
+			break
+		}
+		lHead := strings.TrimSpace(lCss[0:lOpen])
+		lEnd := matchingBrace(lCss, lOpen)
+		if lEnd < 0 {
+			break
+		}
+		lBody := strings.TrimSpace(lCss[lOpen+1 : lEnd])
+		lCss = lCss[lEnd+1:]
+
+		// at-rules (@media, @font-face...) cannot be inlined
+		if strings.HasPrefix(lHead, "@") {
+			continue
+		}
+
+		for _, cSel := range strings.Split(lHead, ",") {
+			lRule, lOk := parseSelector(strings.TrimSpace(cSel))
+			if !lOk {
+				continue
+			}
+			lRule.decls = strings.Join(strings.Fields(strings.TrimSuffix(lBody, ";")), " ")
+			lRule.order = len(lRes)
+			lRes = append(lRes, lRule)
+		}
+	}
+	return lRes
+}
+
+func matchingBrace(pCss string, pOpen int) int {
+	lDepth := 0
+	for cIdx := pOpen; cIdx < len(pCss); cIdx++ {
+		switch pCss[cIdx] {
+		case '{':
+			lDepth++
+		case '}':
+			lDepth--
+			if lDepth == 0 {
+				return cIdx
+			}
+		}
+	}
+	return -1
+}
+
+func parseSelector(pSel string) (cssRule, bool) {
+	lRule := cssRule{}
+	if "" == pSel {
+		return lRule, false
+	}
+
+	for _, cPart := range strings.Fields(pSel) {
+		lMatch := cssCompound.FindStringSubmatch(cPart)
+		if lMatch == nil {
+			return lRule, false
+		}
+		lComp := cssSelector{tag: strings.ToLower(lMatch[1])}
+		if lComp.tag == "*" {
+			lComp.tag = ""
+		} else if lComp.tag != "" {
+			lRule.specificity += 1
+		}
+		for _, cItem := range cssParts.FindAllString(lMatch[2], -1) {
+			if cItem[0] == '#' {
+				lComp.id = cItem[1:]
+				lRule.specificity += 100
+			} else {
+				lComp.classes = append(lComp.classes, cItem[1:])
+				lRule.specificity += 10
+			}
+		}
+		lRule.selectors = append(lRule.selectors, lComp)
+	}
+	return lRule, true
+}
+
+func getAttr(pNode *html.Node, pName string) (string, int) {
+	for cIdx, cAttr := range pNode.Attr {
+		if cAttr.Key == pName {
+			return cAttr.Val, cIdx
+		}
+	}
+	return "", -1
+}
+
+func (self *cssSelector) match(pNode *html.Node) bool {
+	if pNode.Type != html.ElementNode {
+		return false
+	}
+	if self.tag != "" && self.tag != pNode.Data {
+		return false
+	}
+	if self.id != "" {
+		if lId, _ := getAttr(pNode, "id"); lId != self.id {
+			return false
+		}
+	}
+	if len(self.classes) != 0 {
+		lVal, _ := getAttr(pNode, "class")
+		lClasses := strings.Fields(lVal)
+		for _, cClass := range self.classes {
+			lFound := false
+			for _, cHas := range lClasses {
+				lFound = lFound || (cHas == cClass)
+			}
+			if !lFound {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (self *cssRule) match(pNode *html.Node) bool {
+	lLast := len(self.selectors) - 1
+	if !self.selectors[lLast].match(pNode) {
+		return false
+	}
+
+	lAncestor := pNode.Parent
+	for cIdx := lLast - 1; cIdx >= 0; cIdx-- {
+		for lAncestor != nil && !self.selectors[cIdx].match(lAncestor) {
+			lAncestor = lAncestor.Parent
+		}
+		if lAncestor == nil {
+			return false
+		}
+		lAncestor = lAncestor.Parent
+	}
+	return true
+}
+
+func applyRules(pNode *html.Node, pRules []cssRule) {
+	lMatched := []cssRule{}
+	for _, cRule := range pRules {
+		if cRule.match(pNode) {
+			lMatched = append(lMatched, cRule)
+		}
+	}
+	if len(lMatched) == 0 {
+		return
+	}
+
+	sort.SliceStable(lMatched, func(pI, pJ int) bool {
+		if lMatched[pI].specificity != lMatched[pJ].specificity {
+			return lMatched[pI].specificity < lMatched[pJ].specificity
+		}
+		return lMatched[pI].order < lMatched[pJ].order
+	})
+
+	lDecls := []string{}
+	for _, cRule := range lMatched {
+		if "" != cRule.decls {
+			lDecls = append(lDecls, cRule.decls)
+		}
+	}
+
+	// existing inline style has precedence over stylesheet rules
+	lStyle, lIdx := getAttr(pNode, "style")
+	if "" != strings.TrimSpace(lStyle) {
+		lDecls = append(lDecls, strings.TrimSuffix(strings.TrimSpace(lStyle), ";"))
+	}
+	lVal := strings.Join(lDecls, "; ")
+	if lIdx < 0 {
+		pNode.Attr = append(pNode.Attr, html.Attribute{Key: "style", Val: lVal})
+	} else {
+		pNode.Attr[lIdx].Val = lVal
+	}
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,30 @@
+package mail_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/mail"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InlineCss", func() {
+	It("inlines rules and drops style elements", func() {
+		lRes, lErr := InlineCss(`<html><head><style>p { color: red; }</style></head><body><p>text</p></body></html>`)
+		Expect(lErr).To(BeNil())
+		Expect(lRes).To(ContainSubstring(`<p style="color: red">text</p>`))
+		Expect(lRes).NotTo(ContainSubstring("<style>"))
+	})
+
+	It("applies rules by specificity then keeps existing inline style", func() {
+		lRes, lErr := InlineCss(`<style>td.body a { color: blue } a { color: red; } #main { margin: 0 }</style>` +
+			`<table><tr><td class="body"><a id="main" style="font-weight: bold">l</a></td></tr></table>`)
+		Expect(lErr).To(BeNil())
+		Expect(lRes).To(ContainSubstring(`style="color: red; color: blue; margin: 0; font-weight: bold"`))
+	})
+
+	It("ignores at-rules and unsupported selectors", func() {
+		lRes, lErr := InlineCss(`<style>@media (max-width: 600px) { p { color: red } } p:hover { color: blue } p > a { color: green }</style><p>text</p>`)
+		Expect(lErr).To(BeNil())
+		Expect(lRes).To(ContainSubstring(`<p>text</p>`))
+	})
+})
@@ -0,0 +1,118 @@
+package mail
+
+import "bytes"
+import "errors"
+import "fmt"
+import "strings"
+import "sync"
+import "html/template"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Severities --
+var Severities = []string{"info", "warning", "critical"}
+
+// LayoutData --
+type LayoutData struct {
+	Subject  string
+	Body     template.HTML
+	Severity string
+	LogoUrl  string
+	Footer   string
+}
+
+// Layout wraps rendered message bodies into the configured html layout
+type Layout struct {
+	config *core.AppConfig
+	tpl    *template.Template
+	lock   sync.Mutex
+}
+
+func NewLayout(pConf *core.AppConfig) (*Layout, error) {
+	lObj := Layout{
+		config: pConf,
+	}
+	if lErr := lObj.reloadTemplate(); lErr != nil {
+		return nil, lErr
+	}
+	return &lObj, nil
+}
+
+func createLayoutTemplate(pPath string) (*template.Template, error) {
+	lTpl, lErr := template.ParseFiles(pPath)
+	if lErr != nil {
+		log.WithError(lErr).WithFields(log.Fields{
+			"path": pPath,
+		}).Error("unable to parse mail layout template")
+		return nil, lErr
+	}
+	return lTpl, nil
+}
+
+func (self *Layout) reloadTemplate() error {
+	lTpl, lErr := createLayoutTemplate(self.config.MailLayout)
+	if lErr != nil {
+		return lErr
+	}
+	self.lock.Lock()
+	self.tpl = lTpl
+	self.lock.Unlock()
+	return nil
+}
+
+// IsSeverity --
+func IsSeverity(pVal string) bool {
+	for _, cVal := range Severities {
+		if cVal == pVal {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes layout template with given html body and returns the
+// resulting document, css rules being inlined into element styles
+func (self *Layout) Render(pSubject string, pBody string, pSeverity string) (string, error) {
+	if self.config.ReloadTemplates {
+		if lErr := self.reloadTemplate(); lErr != nil {
+			return "", lErr
+		}
+	}
+
+	lData := LayoutData{
+		Subject:  pSubject,
+		Body:     template.HTML(pBody),
+		Severity: pSeverity,
+		LogoUrl:  self.config.MailLogoUrl,
+		Footer:   self.config.MailFooter,
+	}
+
+	self.lock.Lock()
+	lTpl := self.tpl
+	self.lock.Unlock()
+
+	lBuf := bytes.Buffer{}
+	if lErr := lTpl.Execute(&lBuf, lData); lErr != nil {
+		lUerr := errors.New("unable to render mail layout")
+		log.WithError(lErr).Error(lUerr.Error())
+		return "", lUerr
+	}
+	return InlineCss(lBuf.String())
+}
+
+// RenderText returns plain text alternative of given html body, with
+// severity and configured footer
+func (self *Layout) RenderText(pBody string, pSeverity string) string {
+	lRes := HtmlToText(pBody)
+	if "" != pSeverity {
+		lRes = fmt.Sprintf("[%s]\n\n%s", strings.ToUpper(pSeverity), lRes)
+	}
+	if "" != self.config.MailFooter {
+		lRes = fmt.Sprintf("%s\n-- \n%s\n", lRes, self.config.MailFooter)
+	}
+	return lRes
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -7,15 +7,17 @@ import "github.com/cloudfoundry-community/gautocloud/connectors/smtp/smtptype"
 import "github.com/gorilla/mux"
 import "net/http"
 import "gopkg.in/gomail.v2"
-import "time"
 import "errors"
 import log "github.com/sirupsen/logrus"
-import "fmt"
 
 type MailHandler struct {
 	config *core.AppConfig
 	Queue  chan *gomail.Message
+	Layout *Layout
 	opts   smtptype.Smtp
+
+	// OnResult is called after each send attempt, with nil error on success
+	OnResult func(*gomail.Message, error)
 }
 
 type StatusResponse struct {
@@ -23,16 +25,22 @@ type StatusResponse struct {
 }
 
 func NewMailHandler(pConf *core.AppConfig, pRouter *mux.Router) (*MailHandler, error) {
+	lLayout, lErr := NewLayout(pConf)
+	if lErr != nil {
+		return nil, lErr
+	}
+
 	lObj := MailHandler{
 		config: pConf,
 		Queue:  make(chan *gomail.Message, 5000),
+		Layout: lLayout,
 	}
 
 	pRouter.Path("/v1/mail/status").
 		HandlerFunc(core.DecorateHandler(lObj.HandleMessage)).
 		Methods("GET")
 
-	lErr := gautocloud.Inject(&lObj.opts)
+	lErr = gautocloud.Inject(&lObj.opts)
 	if lErr != nil {
 		lUerr := errors.New("unable to get smtp settings")
 		log.WithError(lErr).Error(lUerr.Error())
@@ -44,7 +52,7 @@ func NewMailHandler(pConf *core.AppConfig, pRouter *mux.Router) (*MailHandler, e
 	return &lObj, nil
 }
 
-func (self *MailHandler) send(pMsg *gomail.Message) {
+func (self *MailHandler) send(pMsg *gomail.Message) error {
 	lDialer := gomail.NewPlainDialer(
 		self.opts.Host,
 		self.opts.Port,
@@ -54,7 +62,7 @@ func (self *MailHandler) send(pMsg *gomail.Message) {
 	if lErr != nil {
 		lUerr := errors.New("could not connect mail server")
 		log.WithError(lErr).Error(lUerr.Error())
-		return
+		return lUerr
 	}
 
 	defer lSender.Close()
@@ -64,52 +72,22 @@ func (self *MailHandler) send(pMsg *gomail.Message) {
 		if lErr != nil {
 			lUerr := errors.New("could not send mail")
 			log.WithError(lErr).Error(lUerr.Error())
+			return lUerr
 		}
 	}
-}
-
-func (self *MailHandler) checkInterval(pStart *time.Time, pCount *int) {
-	lElapsed := time.Now().Sub(*pStart)
-	lSize, _ := time.ParseDuration(fmt.Sprintf("%ds", self.config.MailRateDuration))
-
-	// no event on last interval
-	if lElapsed > lSize {
-		log.WithFields(log.Fields{
-			"elapsed(s)": lElapsed.Seconds(),
-			"size(s)":    lSize.Seconds(),
-			"count":      *pCount,
-		}).Debug("last interval too old, reset")
-		*pStart = time.Now()
-		*pCount = 0
-	} else if *pCount < self.config.MailRateCount {
-		log.WithFields(log.Fields{
-			"elapsed(s)": lElapsed.Seconds(),
-			"size(s)":    lSize.Seconds(),
-			"count":      *pCount,
-		}).Debug("request within rate limit")
-	} else {
-		lDelay := lSize - lElapsed
-		log.WithFields(log.Fields{
-			"elapsed(s)": lElapsed.Seconds(),
-			"size(s)":    lSize.Seconds(),
-			"count":      *pCount,
-			"delay":      lDelay.Seconds(),
-		}).Debug("reached rate limit, sleeping")
-		time.Sleep(lDelay)
-		*pStart = time.Now()
-		*pCount = 0
-	}
+	return nil
 }
 
 func (self *MailHandler) run() {
-	lStart := time.Now()
-	lCount := 0
+	lLimiter := core.NewRateLimiter(self.config.MailRateCount, self.config.MailRateDuration)
 
 	for {
 		lMsg := <-self.Queue
-		self.checkInterval(&lStart, &lCount)
-		self.send(lMsg)
-		lCount += 1
+		lLimiter.Wait()
+		lErr := self.send(lMsg)
+		if self.OnResult != nil {
+			self.OnResult(lMsg, lErr)
+		}
 	}
 }
 
@@ -0,0 +1,154 @@
+package mail
+
+import "fmt"
+import "regexp"
+import "strings"
+import "github.com/golang-commonmark/markdown"
+
+// admonition --
+type admonition struct {
+	Title      string
+	Color      string
+	Background string
+}
+
+var admonitions = map[string]admonition{
+	"NOTE":      {"Note", "#527edb", "#eef3fc"},
+	"TIP":       {"Tip", "#32c832", "#eefaee"},
+	"IMPORTANT": {"Important", "#a885d8", "#f5f0fb"},
+	"WARNING":   {"Warning", "#ff7900", "#fff3e8"},
+	"CAUTION":   {"Caution", "#cd3c14", "#fbece8"},
+}
+
+var admonitionRegexp = regexp.MustCompile(`^\[!([A-Za-z]+)\]\s*`)
+var taskRegexp = regexp.MustCompile(`^\[([ xX])\]\s+`)
+
+const tableOpen = `<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse;">`
+
+// RenderMarkdown converts given markdown to email-safe html, supporting github
+// flavored tables, strikethrough and task lists as well as "> [!WARNING]" style
+// admonition blocks
+func RenderMarkdown(pSrc string) string {
+	lMk := markdown.New(
+		markdown.XHTMLOutput(true),
+		markdown.Nofollow(true),
+		markdown.Tables(true))
+
+	lTokens := lMk.Parse([]byte(pSrc))
+	lTokens = renderAdmonitions(lTokens)
+	renderTasks(lTokens)
+	renderTables(lTokens)
+	return lMk.RenderTokensToString(lTokens)
+}
+
+// renderAdmonitions replaces blockquotes starting with a [!TYPE] marker
+// by a colored callout box
+func renderAdmonitions(pTokens []markdown.Token) []markdown.Token {
+	lRes := make([]markdown.Token, 0, len(pTokens))
+	lCloses := map[int]bool{}
+
+	for cIdx := 0; cIdx < len(pTokens); cIdx++ {
+		lTok := pTokens[cIdx]
+
+		if _, lOk := lTok.(*markdown.BlockquoteClose); lOk && lCloses[lTok.Level()] {
+			delete(lCloses, lTok.Level())
+			lRes = append(lRes, &markdown.HTMLBlock{Content: "</td></tr></table>\n", Lvl: lTok.Level()})
+			continue
+		}
+
+		lOpen, lOk := lTok.(*markdown.BlockquoteOpen)
+		if !lOk || cIdx+3 >= len(pTokens) {
+			lRes = append(lRes, lTok)
+			continue
+		}
+		lInline, lOk := pTokens[cIdx+2].(*markdown.Inline)
+		if !lOk || len(lInline.Children) == 0 {
+			lRes = append(lRes, lTok)
+			continue
+		}
+		lText, lOk := lInline.Children[0].(*markdown.Text)
+		if !lOk {
+			lRes = append(lRes, lTok)
+			continue
+		}
+		lMatch := admonitionRegexp.FindStringSubmatch(lText.Content)
+		lKind, lFound := admonition{}, false
+		if lMatch != nil {
+			lKind, lFound = admonitions[strings.ToUpper(lMatch[1])]
+		}
+		if !lFound {
+			lRes = append(lRes, lTok)
+			continue
+		}
+
+		// strip marker and the line break that follows it
+		lText.Content = lText.Content[len(lMatch[0]):]
+		if lText.Content == "" {
+			lInline.Children = lInline.Children[1:]
+			if len(lInline.Children) != 0 {
+				if _, lBreak := lInline.Children[0].(*markdown.Softbreak); lBreak {
+					lInline.Children = lInline.Children[1:]
+				}
+			}
+		}
+
+		lCloses[lOpen.Lvl] = true
+		lRes = append(lRes, &markdown.HTMLBlock{
+			Lvl: lOpen.Lvl,
+			Content: fmt.Sprintf(
+				`<table role="presentation" width="100%%" cellpadding="0" cellspacing="0" style="margin: 8px 0; border-collapse: collapse;">`+
+					`<tr><td style="padding: 8px 12px; border-left: 4px solid %s; background-color: %s;">`+
+					`<p style="margin: 0 0 4px 0; font-weight: bold; color: %s;">%s</p>`+"\n",
+				lKind.Color, lKind.Background, lKind.Color, lKind.Title),
+		})
+
+		// marker was alone in its paragraph, drop the empty paragraph
+		if len(lInline.Children) == 0 {
+			cIdx += 3
+		}
+	}
+	return lRes
+}
+
+// renderTasks replaces "[ ]" and "[x]" list item prefixes by ballot boxes,
+// form inputs being stripped by most mail clients
+func renderTasks(pTokens []markdown.Token) {
+	for cIdx := 0; cIdx+3 < len(pTokens); cIdx++ {
+		if _, lOk := pTokens[cIdx].(*markdown.ListItemOpen); !lOk {
+			continue
+		}
+		lInline, lOk := pTokens[cIdx+2].(*markdown.Inline)
+		if !lOk || len(lInline.Children) == 0 {
+			continue
+		}
+		lText, lOk := lInline.Children[0].(*markdown.Text)
+		if !lOk {
+			continue
+		}
+		lMatch := taskRegexp.FindStringSubmatch(lText.Content)
+		if lMatch == nil {
+			continue
+		}
+		lBox := "&#9744; "
+		if lMatch[1] != " " {
+			lBox = "&#9745; "
+		}
+		lText.Content = lText.Content[len(lMatch[0]):]
+		lInline.Children = append(
+			[]markdown.Token{&markdown.HTMLInline{Content: lBox}},
+			lInline.Children...)
+	}
+}
+
+// renderTables adds borders to tables for mail clients ignoring css
+func renderTables(pTokens []markdown.Token) {
+	for cIdx, cTok := range pTokens {
+		if lOpen, lOk := cTok.(*markdown.TableOpen); lOk {
+			pTokens[cIdx] = &markdown.HTMLBlock{Content: tableOpen, Lvl: lOpen.Lvl}
+		}
+	}
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	. "github.com/orange-cloudfoundry/cf-wall/mail"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RenderMarkdown", func() {
+	It("renders bordered tables", func() {
+		lRes := RenderMarkdown("|a|b|\n|-|-|\n|1|2|\n")
+		Expect(lRes).To(ContainSubstring(`<table border="1"`))
+		Expect(lRes).To(ContainSubstring(`<td>2</td>`))
+	})
+
+	It("renders strikethrough", func() {
+		Expect(RenderMarkdown("~~old~~")).To(ContainSubstring("<s>old</s>"))
+	})
+
+	It("renders task lists as ballot boxes", func() {
+		lRes := RenderMarkdown("- [ ] todo\n- [x] done\n")
+		Expect(lRes).To(ContainSubstring("<li>&#9744; todo</li>"))
+		Expect(lRes).To(ContainSubstring("<li>&#9745; done</li>"))
+	})
+
+	It("renders admonitions as callouts", func() {
+		lRes := RenderMarkdown("> [!WARNING]\n> take care\n")
+		Expect(lRes).NotTo(ContainSubstring("blockquote"))
+		Expect(lRes).NotTo(ContainSubstring("[!WARNING]"))
+		Expect(lRes).To(ContainSubstring(">Warning</p>"))
+		Expect(lRes).To(ContainSubstring("<p>take care</p>"))
+		Expect(lRes).To(ContainSubstring("</td></tr></table>"))
+	})
+
+	It("keeps regular blockquotes", func() {
+		lRes := RenderMarkdown("> [!UNKNOWN] quote\n")
+		Expect(lRes).To(ContainSubstring("<blockquote>"))
+	})
+})
+
+var _ = Describe("HtmlToText", func() {
+	It("converts rendered markdown to plain text", func() {
+		lRes := HtmlToText(RenderMarkdown("# Title\n\nSome [link](https://example.com).\n\n- a\n- b\n\n|x|y|\n|-|-|\n|1|2|\n"))
+		Expect(lRes).To(Equal("Title\n\nSome link (https://example.com).\n\n- a\n- b\n\nx | y\n1 | 2\n"))
+	})
+
+	It("keeps indentation of code blocks", func() {
+		lRes := HtmlToText(RenderMarkdown("Run:\n\n```\nif true {\n    exit 1\n}\n```\n\n    indented\n      code\n"))
+		Expect(lRes).To(Equal("Run:\n\nif true {\n    exit 1\n}\n\nindented\n  code\n"))
+	})
+
+	It("keeps indentation of leading code blocks", func() {
+		lRes := HtmlToText("<pre>  first\n  second</pre><p>  after  </p>")
+		Expect(lRes).To(Equal("  first\n  second\n\nafter\n"))
+	})
+})
@@ -0,0 +1,55 @@
+<!DOCTYPE html>
+<html>
+  <head>
+    <meta http-equiv="Content-Type" content="text/html; charset=UTF-8" />
+    <title>{{ .Subject }}</title>
+    <style>
+     body          { margin: 0; padding: 0; background-color: #f2f2f2; font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #333333; }
+     table.layout  { width: 100%; border-collapse: collapse; background-color: #f2f2f2; }
+     table.content { width: 640px; border-collapse: collapse; background-color: #ffffff; }
+     td.header     { padding: 16px 24px; background-color: #000000; color: #ffffff; font-size: 18px; }
+     td.header img { height: 32px; border: 0; }
+     td.banner     { padding: 8px 24px; color: #ffffff; font-weight: bold; text-transform: uppercase; }
+     td.info       { background-color: #527edb; }
+     td.warning    { background-color: #ff7900; }
+     td.critical   { background-color: #cd3c14; }
+     td.body       { padding: 24px; line-height: 1.5; }
+     td.footer     { padding: 16px 24px; font-size: 11px; color: #8f8f8f; }
+     td.body table { border-collapse: collapse; }
+     td.body th    { padding: 4px 8px; border: 1px solid #cccccc; background-color: #eeeeee; }
+     td.body td    { padding: 4px 8px; border: 1px solid #cccccc; }
+     td.body pre   { padding: 8px; background-color: #f6f6f6; }
+     h1            { font-size: 22px; }
+     h2            { font-size: 18px; }
+     a             { color: #f16e00; }
+    </style>
+  </head>
+  <body>
+    <table class="layout" role="presentation">
+      <tr>
+        <td align="center">
+          <table class="content" role="presentation">
+            <tr>
+              <td class="header">
+                {{ if .LogoUrl }}<img src="{{ .LogoUrl }}" alt="cf-wall" />{{ else }}cf-wall{{ end }}
+              </td>
+            </tr>
+            {{ if .Severity }}
+            <tr>
+              <td class="banner {{ .Severity }}">{{ .Severity }}</td>
+            </tr>
+            {{ end }}
+            <tr>
+              <td class="body">{{ .Body }}</td>
+            </tr>
+            {{ if .Footer }}
+            <tr>
+              <td class="footer">{{ .Footer }}</td>
+            </tr>
+            {{ end }}
+          </table>
+        </td>
+      </tr>
+    </table>
+  </body>
+</html>
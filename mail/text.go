@@ -0,0 +1,123 @@
+package mail
+
+import "fmt"
+import "regexp"
+import "strings"
+import "golang.org/x/net/html"
+import "golang.org/x/net/html/atom"
+
+var textBlankLines = regexp.MustCompile(`\n{3,}`)
+var textSpaces = regexp.MustCompile(`[ \t\r\n]+`)
+
+// textPreMark marks lines of preformatted blocks whose indentation is kept,
+// html parser replacing NUL characters of documents
+const textPreMark = "\x00"
+
+// textBlocks are elements rendered on their own lines
+var textBlocks = map[string]bool{
+	"p": true, "div": true, "table": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true, "hr": true,
+}
+
+// textContainers are elements whose direct text children are meaningless
+var textContainers = map[string]bool{
+	"table": true, "thead": true, "tbody": true, "tr": true, "ul": true, "ol": true,
+}
+
+// HtmlToText converts rendered mail body to its plain text alternative
+func HtmlToText(pHtml string) string {
+	lNodes, lErr := html.ParseFragment(strings.NewReader(pHtml), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if lErr != nil {
+		return pHtml
+	}
+
+	lBuf := strings.Builder{}
+	for _, cNode := range lNodes {
+		writeText(&lBuf, cNode, false)
+	}
+
+	lLines := strings.Split(lBuf.String(), "\n")
+	for cIdx, cLine := range lLines {
+		if strings.Contains(cLine, textPreMark) {
+			lLines[cIdx] = strings.TrimRight(strings.Replace(cLine, textPreMark, "", -1), " \t\r")
+		} else {
+			lLines[cIdx] = strings.TrimSpace(cLine)
+		}
+	}
+	lRes := textBlankLines.ReplaceAllString(strings.Join(lLines, "\n"), "\n\n")
+	return strings.Trim(lRes, "\n") + "\n"
+}
+
+func prevElement(pNode *html.Node) *html.Node {
+	for cNode := pNode.PrevSibling; cNode != nil; cNode = cNode.PrevSibling {
+		if cNode.Type == html.ElementNode {
+			return cNode
+		}
+	}
+	return nil
+}
+
+func writeText(pBuf *strings.Builder, pNode *html.Node, pPre bool) {
+	switch pNode.Type {
+	case html.TextNode:
+		// skip indentation between table rows or list items
+		if pNode.Parent != nil && textContainers[pNode.Parent.Data] && "" == strings.TrimSpace(pNode.Data) {
+			return
+		}
+		if pPre {
+			pBuf.WriteString(textPreMark + strings.Replace(pNode.Data, "\n", "\n"+textPreMark, -1))
+		} else {
+			pBuf.WriteString(textSpaces.ReplaceAllString(pNode.Data, " "))
+		}
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch pNode.Data {
+	case "br":
+		pBuf.WriteString("\n")
+		return
+	case "hr":
+		pBuf.WriteString("\n----------\n")
+		return
+	case "li":
+		pBuf.WriteString("\n- ")
+	case "td", "th":
+		if prevElement(pNode) != nil {
+			pBuf.WriteString(" | ")
+		}
+	}
+
+	if textBlocks[pNode.Data] {
+		pBuf.WriteString("\n")
+	}
+	for cChild := pNode.FirstChild; cChild != nil; cChild = cChild.NextSibling {
+		writeText(pBuf, cChild, pPre || pNode.Data == "pre")
+	}
+	if textBlocks[pNode.Data] {
+		pBuf.WriteString("\n")
+	}
+
+	// rows are kept together, without blank lines in between
+	if pNode.Data == "tr" {
+		pBuf.WriteString("\n")
+	}
+
+	if pNode.Data == "a" {
+		lHref, _ := getAttr(pNode, "href")
+		if "" != lHref && !strings.HasPrefix(lHref, "mailto:") {
+			pBuf.WriteString(fmt.Sprintf(" (%s)", lHref))
+		}
+	}
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
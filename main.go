@@ -9,6 +9,9 @@ import "github.com/orange-cloudfoundry/cf-wall/core"
 import "github.com/orange-cloudfoundry/cf-wall/api"
 import "github.com/orange-cloudfoundry/cf-wall/ui"
 import "github.com/orange-cloudfoundry/cf-wall/mail"
+import "github.com/orange-cloudfoundry/cf-wall/chat"
+import "github.com/orange-cloudfoundry/cf-wall/hook"
+import "github.com/orange-cloudfoundry/cf-wall/sms"
 import "path/filepath"
 
 var GApp App
@@ -18,27 +21,76 @@ type App struct {
 	UiHandler      *ui.UiHandler
 	ObjectHandler  *api.ObjectHandler
 	MessageHandler *api.MessageHandler
+	PrefHandler    *api.PreferenceHandler
+	SuppHandler    *api.SuppressionHandler
+	HookHandler    *api.WebhookHandler
 	MailHandler    *mail.MailHandler
+	Notifier       *chat.Notifier
+	HookSender     *hook.Sender
+	SmsGateway     *sms.Gateway
 }
 
 func NewApp(pRouter *mux.Router) *App {
 	conf := core.NewAppConfig()
+	store, err := core.NewStore(conf.DataDir)
+	if err != nil {
+		log.WithError(err).Error("failed to create data store", err)
+		os.Exit(1)
+	}
+
 	objH := api.NewObjectHandler(&conf, pRouter)
 	uiH := ui.NewUiHandler(&conf, pRouter)
 	mailer, err := mail.NewMailHandler(&conf, pRouter)
-	msgH, err := api.NewMessageHandler(&conf, pRouter, mailer.Queue)
+	if err != nil {
+		log.WithError(err).Error("failed to create MailHandler", err)
+		os.Exit(1)
+	}
+
+	sender := hook.NewSender(&conf)
+	hookH, err := api.NewWebhookHandler(&conf, pRouter, store, sender)
+	if err != nil {
+		log.WithError(err).Error("failed to create api WebhookHandler", err)
+		os.Exit(1)
+	}
+
+	gateway, err := sms.NewGateway(&conf)
+	if err != nil {
+		log.WithError(err).Error("failed to create sms Gateway", err)
+		os.Exit(1)
+	}
+
+	notifier := chat.NewNotifier(&conf)
+	msgH, err := api.NewMessageHandler(&conf, pRouter, store, mailer, notifier, gateway, hookH)
 
 	if err != nil {
 		log.WithError(err).Error("failed to create api MessageHandler", err)
 		os.Exit(1)
 	}
 
+	prefH, err := api.NewPreferenceHandler(&conf, pRouter, store)
+	if err != nil {
+		log.WithError(err).Error("failed to create api PreferenceHandler", err)
+		os.Exit(1)
+	}
+
+	suppH, err := api.NewSuppressionHandler(&conf, pRouter, store)
+	if err != nil {
+		log.WithError(err).Error("failed to create api SuppressionHandler", err)
+		os.Exit(1)
+	}
+
 	return &App{
 		Config:         conf,
 		ObjectHandler:  objH,
 		UiHandler:      uiH,
 		MessageHandler: msgH,
+		PrefHandler:    prefH,
+		SuppHandler:    suppH,
+		HookHandler:    hookH,
 		MailHandler:    mailer,
+		Notifier:       notifier,
+		HookSender:     sender,
+		SmsGateway:     gateway,
 	}
 }
 
@@ -77,6 +129,9 @@ func main() {
 	app := NewApp(router)
 
 	app.MailHandler.Run()
+	app.Notifier.Run()
+	app.HookSender.Run()
+	app.SmsGateway.Run()
 	app.ListenAndServe(router)
 }
 
@@ -0,0 +1,186 @@
+package sms
+
+import "fmt"
+import "time"
+import "bytes"
+import "errors"
+import "strings"
+import "net/url"
+import "net/http"
+import "text/template"
+import "encoding/json"
+import log "github.com/sirupsen/logrus"
+import "github.com/orange-cloudfoundry/cf-wall/core"
+
+// Message is a text sent to a phone number
+type Message struct {
+	To   string
+	Text string
+}
+
+type Gateway struct {
+	config *core.AppConfig
+	Queue  chan *Message
+	client *http.Client
+	url    *template.Template
+	body   *template.Template
+}
+
+var funcs = template.FuncMap{
+	"json": func(pVal string) string {
+		lRes, _ := json.Marshal(pVal)
+		return string(lRes)
+	},
+	"urlquery": url.QueryEscape,
+}
+
+// NewGateway parses configured gateway templates, gateway being disabled
+// when no url is configured
+func NewGateway(pConf *core.AppConfig) (*Gateway, error) {
+	lObj := Gateway{
+		config: pConf,
+		Queue:  make(chan *Message, 5000),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if "" == pConf.SmsGatewayUrl {
+		return &lObj, nil
+	}
+
+	lUrl, lErr := template.New("url").Funcs(funcs).Parse(pConf.SmsGatewayUrl)
+	if lErr != nil {
+		return nil, fmt.Errorf("invalid sms-gateway-url template: %s", lErr.Error())
+	}
+	lBody, lErr := template.New("body").Funcs(funcs).Parse(pConf.SmsGatewayBody)
+	if lErr != nil {
+		return nil, fmt.Errorf("invalid sms-gateway-body template: %s", lErr.Error())
+	}
+	for _, cHeader := range pConf.SmsGatewayHeaders {
+		if !strings.Contains(cHeader, ":") {
+			return nil, fmt.Errorf("invalid sms-gateway-headers entry '%s', must be 'Name: value'", cHeader)
+		}
+	}
+
+	lObj.url = lUrl
+	lObj.body = lBody
+	return &lObj, nil
+}
+
+// Enabled returns true when a gateway is configured
+func (self *Gateway) Enabled() bool {
+	return self.url != nil
+}
+
+// ShortText returns sms text of given subject and optional summary, truncated
+// to pMax characters
+func ShortText(pSubject string, pSummary string, pSeverity string, pMax int) string {
+	lRes := pSubject
+	if "" != pSeverity {
+		lRes = fmt.Sprintf("[%s] %s", strings.ToUpper(pSeverity), lRes)
+	}
+	if "" != pSummary {
+		lRes = fmt.Sprintf("%s: %s", lRes, pSummary)
+	}
+
+	lRunes := []rune(lRes)
+	if pMax > 3 && len(lRunes) > pMax {
+		lRes = string(lRunes[0:pMax-3]) + "..."
+	}
+	return lRes
+}
+
+// contentType infers content type of given gateway request body, json
+// bodies being recognized by their first character
+func contentType(pBody string) string {
+	lBody := strings.TrimSpace(pBody)
+	if "" == lBody {
+		return ""
+	}
+	if strings.HasPrefix(lBody, "{") || strings.HasPrefix(lBody, "[") {
+		return "application/json"
+	}
+	return "application/x-www-form-urlencoded"
+}
+
+func render(pTpl *template.Template, pMsg *Message) (string, error) {
+	lBuf := bytes.Buffer{}
+	if lErr := pTpl.Execute(&lBuf, pMsg); lErr != nil {
+		return "", lErr
+	}
+	return lBuf.String(), nil
+}
+
+// Request builds gateway request sending given message, content type being
+// inferred from body unless given by configured headers
+func (self *Gateway) Request(pMsg *Message) (*http.Request, error) {
+	if !self.Enabled() {
+		return nil, errors.New("sms gateway is not configured")
+	}
+
+	lUrl, lErr := render(self.url, pMsg)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lBody, lErr := render(self.body, pMsg)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	lReq, lErr := http.NewRequest(self.config.SmsGatewayMethod, lUrl, strings.NewReader(lBody))
+	if lErr != nil {
+		return nil, lErr
+	}
+	if lType := contentType(lBody); "" != lType {
+		lReq.Header.Set("Content-Type", lType)
+	}
+	for _, cHeader := range self.config.SmsGatewayHeaders {
+		lParts := strings.SplitN(cHeader, ":", 2)
+		lReq.Header.Set(strings.TrimSpace(lParts[0]), strings.TrimSpace(lParts[1]))
+	}
+	return lReq, nil
+}
+
+func (self *Gateway) send(pMsg *Message) error {
+	lReq, lErr := self.Request(pMsg)
+	if lErr != nil {
+		log.WithError(lErr).Error("unable to build sms gateway request")
+		return lErr
+	}
+
+	log.WithFields(log.Fields{"to": pMsg.To}).Debug("sending sms")
+	if self.config.MailDry {
+		return nil
+	}
+
+	lRes, lErr := self.client.Do(lReq)
+	if lErr != nil {
+		lUerr := errors.New("could not reach sms gateway")
+		log.WithError(lErr).Error(lUerr.Error())
+		return lUerr
+	}
+	defer lRes.Body.Close()
+
+	if lRes.StatusCode < 200 || lRes.StatusCode >= 300 {
+		lUerr := fmt.Errorf("sms gateway answered with status %d", lRes.StatusCode)
+		log.WithFields(log.Fields{"to": pMsg.To}).Error(lUerr.Error())
+		return lUerr
+	}
+	return nil
+}
+
+func (self *Gateway) run() {
+	lLimiter := core.NewRateLimiter(self.config.SmsRateCount, self.config.SmsRateDuration)
+
+	for {
+		lMsg := <-self.Queue
+		lLimiter.Wait()
+		self.send(lMsg)
+	}
+}
+
+func (self *Gateway) Run() {
+	go self.run()
+}
+
+// Local Variables:
+// ispell-local-dictionary: "american"
+// End:
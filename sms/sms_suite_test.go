@@ -0,0 +1,13 @@
+package sms_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSms(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sms Suite")
+}
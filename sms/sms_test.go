@@ -0,0 +1,108 @@
+package sms_test
+
+import (
+	"io/ioutil"
+
+	"github.com/orange-cloudfoundry/cf-wall/core"
+	. "github.com/orange-cloudfoundry/cf-wall/sms"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShortText", func() {
+	It("prefixes severity and appends summary", func() {
+		Expect(ShortText("Outage", "router down", "critical", 160)).
+			To(Equal("[CRITICAL] Outage: router down"))
+	})
+
+	It("truncates long texts", func() {
+		Expect(ShortText("0123456789", "", "", 8)).To(Equal("01234..."))
+	})
+})
+
+var _ = Describe("Gateway", func() {
+	It("is disabled without url", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{})
+		Expect(lErr).To(BeNil())
+		Expect(lGw.Enabled()).To(BeFalse())
+	})
+
+	It("renders configured templates", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:     "https://sms.example.com/send?from={{urlquery \"cf wall\"}}",
+			SmsGatewayMethod:  "POST",
+			SmsGatewayBody:    `{"to": {{json .To}}, "text": {{json .Text}}}`,
+			SmsGatewayHeaders: []string{"Authorization: Basic abc"},
+		})
+		Expect(lErr).To(BeNil())
+
+		lReq, lErr := lGw.Request(&Message{To: "+33600000000", Text: `say "hi"`})
+		Expect(lErr).To(BeNil())
+		Expect(lReq.URL.String()).To(Equal("https://sms.example.com/send?from=cf+wall"))
+		Expect(lReq.Header.Get("Authorization")).To(Equal("Basic abc"))
+		Expect(lReq.Header.Get("Content-Type")).To(Equal("application/json"))
+		lBody, _ := ioutil.ReadAll(lReq.Body)
+		Expect(string(lBody)).To(Equal(`{"to": "+33600000000", "text": "say \"hi\""}`))
+	})
+
+	It("infers content type of form bodies", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:    "https://sms.example.com/send",
+			SmsGatewayMethod: "POST",
+			SmsGatewayBody:   "to={{urlquery .To}}&text={{urlquery .Text}}",
+		})
+		Expect(lErr).To(BeNil())
+
+		lReq, lErr := lGw.Request(&Message{To: "+33600000000", Text: "hi"})
+		Expect(lErr).To(BeNil())
+		Expect(lReq.Header.Get("Content-Type")).To(Equal("application/x-www-form-urlencoded"))
+	})
+
+	It("lets configured headers override content type", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:     "https://sms.example.com/send",
+			SmsGatewayMethod:  "POST",
+			SmsGatewayBody:    "<sms to={{printf \"%q\" .To}}/>",
+			SmsGatewayHeaders: []string{"Content-Type: text/xml"},
+		})
+		Expect(lErr).To(BeNil())
+
+		lReq, lErr := lGw.Request(&Message{To: "+33600000000", Text: "hi"})
+		Expect(lErr).To(BeNil())
+		Expect(lReq.Header.Get("Content-Type")).To(Equal("text/xml"))
+	})
+
+	It("sends no content type without body", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:    "https://sms.example.com/send?to={{urlquery .To}}",
+			SmsGatewayMethod: "GET",
+		})
+		Expect(lErr).To(BeNil())
+
+		lReq, lErr := lGw.Request(&Message{To: "+33600000000", Text: "hi"})
+		Expect(lErr).To(BeNil())
+		Expect(lReq.Header.Get("Content-Type")).To(Equal(""))
+	})
+
+	It("escapes values of query strings", func() {
+		lGw, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:    "https://sms.example.com/send?to={{urlquery .To}}&text={{urlquery .Text}}",
+			SmsGatewayMethod: "GET",
+		})
+		Expect(lErr).To(BeNil())
+
+		lReq, lErr := lGw.Request(&Message{To: "+33600000000", Text: "up & running"})
+		Expect(lErr).To(BeNil())
+		Expect(lReq.URL.Query().Get("to")).To(Equal("+33600000000"))
+		Expect(lReq.URL.Query().Get("text")).To(Equal("up & running"))
+	})
+
+	It("rejects invalid headers", func() {
+		_, lErr := NewGateway(&core.AppConfig{
+			SmsGatewayUrl:     "https://sms.example.com",
+			SmsGatewayHeaders: []string{"invalid"},
+		})
+		Expect(lErr).NotTo(BeNil())
+	})
+})
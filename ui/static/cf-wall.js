@@ -116,6 +116,18 @@ function Api(p_app) {
     });
   };
 
+  self.postRender = function(p_data, p_callback) {
+    Pace.track(function() {
+      self.postJson("/v1/render", p_data, p_callback);
+    });
+  };
+
+  self.postPreview = function(p_data, p_callback) {
+    Pace.track(function() {
+      self.postJson("/v1/preview", p_data, p_callback);
+    });
+  };
+
   self.getOrgs = function(p_callback) {
     Pace.ignore(function() {
       self.get("/v1/orgs", p_callback);
@@ -146,6 +158,65 @@ function Api(p_app) {
     });
   };
 
+  self.getServicePlans = function(p_service, p_callback) {
+    Pace.ignore(function() {
+      self.get("/v1/services/" + p_service + "/plans", p_callback);
+    });
+  };
+
+  self.getServiceBrokers = function(p_callback) {
+    Pace.ignore(function() {
+      self.get("/v1/service_brokers", p_callback);
+    });
+  };
+
+  self.getStacks = function(p_callback) {
+    Pace.ignore(function() {
+      self.get("/v1/stacks", p_callback);
+    });
+  };
+
+  self.getSenders = function(p_callback) {
+    Pace.ignore(function() {
+      self.get("/v1/senders", p_callback);
+    });
+  };
+
+  self.getCategories = function(p_callback) {
+    Pace.ignore(function() {
+      self.get("/v1/categories", p_callback);
+    });
+  };
+
+  self.getPreferences = function(p_callback) {
+    Pace.track(function() {
+      self.get("/v1/preferences", p_callback);
+    });
+  };
+
+  self.putPreferences = function(p_data, p_callback) {
+    Pace.track(function() {
+      $.ajax({
+        url:         "/v1/preferences",
+        data:        JSON.stringify(p_data),
+        type:        "PUT",
+        contentType: "application/json; charset=utf-8",
+        dataType:    "json",
+        headers:     self.createHeaders()
+      }).
+        done(function(p_data) { p_callback(p_data); }).
+        fail(function(p_data) {
+          self.apiError("/v1/preferences", p_data);
+        });
+    });
+  };
+
+  self.getAudit = function(p_callback) {
+    Pace.track(function() {
+      self.get("/v1/audit", p_callback);
+    });
+  };
+
   self.getMailCount = function(p_callback) {
     Pace.ignore(function() {
       self.get("/v1/mail/status", p_callback, false);
@@ -157,26 +228,46 @@ function Api(p_app) {
 function Message(p_app) {
   var self = this;
 
-  self.md = window.markdownit();
-
   self.ui = {
     send: $("#msg_send"),
+    test: $("#msg_test"),
     confirm: $("#msg_confirm"),
     confirm_ok: $("#msg_confirm button.btn-success"),
     msg:  {
       form:    $("#msg_form"),
       subject: $("#msg_subject"),
-      content: $("#msg_content")
+      content:  $("#msg_content"),
+      sender:   $("#msg_sender"),
+      category: $("#msg_category"),
+      channels: $("#msg_form input[name=channels]"),
+      summary:  $("#msg_summary"),
+      display_start: $("#msg_display_start"),
+      display_end:   $("#msg_display_end")
     },
     preview: {
-      content: $("#msg_preview"),
-      tab:     $('a[href="#preview"]')
+      content:   $("#msg_preview"),
+      headers:   $("#msg_preview_headers"),
+      text:      $("#msg_preview_text"),
+      recipient: $("#msg_preview_recipient"),
+      download:  $("#msg_preview_download"),
+      tab:       $('a[href="#preview"]')
     }
   };
 
-  self.setPreviewContent = function(p_str) {
-    var l_content = self.md.render(p_str);
-    self.ui.preview.content.html(l_content);
+  self.setPreviewContent = function(p_data) {
+    p_app.api.postPreview(p_data, function(p_res) {
+      var l_headers = [];
+      $.each(["From", "To", "Subject", "Date"], function(c_idx, c_key) {
+        if (p_res["headers"][c_key] != undefined) {
+          l_headers.push(c_key + ": " + p_res["headers"][c_key].join(", "));
+        }
+      });
+      self.ui.preview.recipient.text(p_res["recipient"] + " (" + p_res["count"] + " recipients)");
+      self.ui.preview.headers.text(l_headers.join("\n"));
+      self.ui.preview.content.attr("srcdoc", p_res["html"]);
+      self.ui.preview.text.text(p_res["text"]);
+      self.ui.preview.download.attr("href", "data:message/rfc822;base64," + p_res["eml"]);
+    });
   };
 
   self.getMsgContent = function() {
@@ -184,8 +275,7 @@ function Message(p_app) {
   };
 
   self.onPreviewClick = function() {
-    var l_val = self.getMsgContent();
-    self.setPreviewContent(l_val);
+    self.setPreviewContent(self.getMessageData());
   };
 
   self.onSendClick = function() {
@@ -197,6 +287,27 @@ function Message(p_app) {
     }
   };
 
+  self.onTestClick = function() {
+    var l_data;
+
+    if (false == self.ui.msg.form.valid())
+      return false;
+
+    l_data         = self.getMessageData();
+    l_data["test"] = true;
+    self.saveMessage();
+    if (p_app.targets.targetAll()) {
+      p_app.api.postMessageAll(l_data, self.onTestSent);
+    } else {
+      p_app.api.postMessage(l_data, self.onTestSent);
+    }
+    return false;
+  };
+
+  self.onTestSent = function(p_data) {
+    p_app.addMessage("Test mail successfully enqueued to your own address.");
+  };
+
   self.onConfirmClick = function() {
     self.ui.confirm.modal("hide");
     self.ui.msg.form.submit();
@@ -218,6 +329,10 @@ function Message(p_app) {
 
   self.onMailSent = function(p_data) {
     self.enableSend();
+    if (p_data != undefined && p_data["status"] == "pending") {
+      p_app.addMessage("Message submitted for approval (draft " + p_data["id"] + ", " + p_data["count"] + " recipients).");
+      return;
+    }
     p_app.addMessage("Mails successfully enqueued.");
     // p_app.addMessage("from: "    + p_data["from"]);
     // p_app.addMessage("subject: " + p_data["subject"]);
@@ -248,28 +363,89 @@ function Message(p_app) {
     if (l_msg != null) {
       self.ui.msg.content.val(l_msg);
     }
+    self.restoreRequest();
   };
 
-  self.send = function() {
-    if (false == p_app.targets.validate())
-      return false;
+  // restores options and targets of a message reused from history, kept
+  // once only. Severity and translations have no field and are sent as is
+  self.restoreRequest = function() {
+    var l_saved = window.localStorage.getItem("request");
+    if (l_saved == null) {
+      return;
+    }
+    window.localStorage.removeItem("request");
+
+    var l_data = JSON.parse(l_saved);
+    var l_req  = l_data["request"];
+    self.reused = {
+      "severity" : l_req["severity"] || "",
+      "subjects" : l_req["subjects"],
+      "messages" : l_req["messages"],
+      "sender"   : l_req["sender"] || "",
+      "category" : l_req["category"] || ""
+    };
+    self.ui.msg.summary.val(l_req["summary"] || "");
+    if (l_req["channels"] && 0 != l_req["channels"].length) {
+      self.ui.msg.channels.each(function() {
+        $(this).prop("checked", -1 != $.inArray($(this).val(), l_req["channels"]));
+      });
+    }
+    p_app.targets.restore(l_req, l_data["all"]);
+  };
 
+  self.getMessageData = function() {
     var l_data;
-    self.disableSend();
 
     l_data               = p_app.targets.getTargetData();
     l_data["subject"]    = self.ui.msg.subject.val();
-    l_data["message"]    = self.ui.msg.content.val();
+    l_data["message"]    = self.getMsgContent();
+    l_data["sender"]     = self.ui.msg.sender.val() || "";
+    l_data["category"]   = self.ui.msg.category.val() || "";
+    l_data["summary"]    = self.ui.msg.summary.val() || "";
+    l_data["channels"]   = self.ui.msg.channels.filter(":checked").map(function() {
+      return $(this).val();
+    }).get();
+    if (self.reused != undefined) {
+      l_data["severity"] = self.reused["severity"];
+      l_data["subjects"] = self.reused["subjects"];
+      l_data["messages"] = self.reused["messages"];
+    }
+    if (self.ui.msg.display_end.val()) {
+      l_data["display_end"] = new Date(self.ui.msg.display_end.val()).toISOString();
+      if (self.ui.msg.display_start.val()) {
+        l_data["display_start"] = new Date(self.ui.msg.display_start.val()).toISOString();
+      }
+    }
     l_data["recipients"] = l_data["externals"];
     delete l_data["externals"];
 
-    self.saveMessage();
     if (p_app.targets.targetAll()) {
       delete l_data["orgs"];
       delete l_data["spaces"];
       delete l_data["services"];
+      delete l_data["service_plans"];
+      delete l_data["service_brokers"];
+      delete l_data["deprecated_plans"];
+      delete l_data["apps"];
       delete l_data["buildpacks"];
+      delete l_data["buildpack_versions"];
+      delete l_data["stacks"];
       delete l_data["users"];
+      delete l_data["org_roles"];
+      delete l_data["space_roles"];
+    }
+    return l_data;
+  };
+
+  self.send = function() {
+    if (false == p_app.targets.validate())
+      return false;
+
+    var l_data = self.getMessageData();
+    self.disableSend();
+
+    self.saveMessage();
+    if (p_app.targets.targetAll()) {
       p_app.api.postMessageAll(l_data, self.onMailSent);
     } else {
       p_app.api.postMessage(l_data, self.onMailSent);
@@ -279,6 +455,7 @@ function Message(p_app) {
 
   self.bind = function() {
     self.ui.send.click(self.onSendClick);
+    self.ui.test.click(self.onTestClick);
     self.ui.preview.tab.click(self.onPreviewClick);
     self.ui.confirm.modal({
       show: false
@@ -299,6 +476,32 @@ function Message(p_app) {
     self.restoreMessage();
   };
 
+  self.loadCategories = function() {
+    p_app.api.getCategories(function(p_data) {
+      $.each(p_data["categories"], function(c_idx, c_cat) {
+        self.ui.msg.category.append($("<option/>").val(c_cat["name"]).text(c_cat["name"]));
+      });
+      if (self.reused != undefined) {
+        self.ui.msg.category.val(self.reused["category"]);
+      }
+    });
+  };
+
+  self.loadSenders = function() {
+    p_app.api.getSenders(function(p_data) {
+      if (0 == p_data.length)
+        return;
+      $.each(p_data, function(c_idx, c_sender) {
+        var l_label = c_sender["name"] + " <" + c_sender["address"] + ">";
+        self.ui.msg.sender.append($("<option/>").val(c_sender["id"]).text(l_label));
+      });
+      self.ui.msg.sender.closest(".form-group").removeClass("hidden");
+      if (self.reused != undefined) {
+        self.ui.msg.sender.val(self.reused["sender"]);
+      }
+    });
+  };
+
   self.init();
 }
 
@@ -312,10 +515,21 @@ function Targets(p_app) {
     orgs          : $("#tgt-orgs"),
     spaces        : $("#tgt-spaces"),
     services      : $("#tgt-services"),
+    service_plans : $("#tgt-service_plans"),
+    service_brokers : $("#tgt-service_brokers"),
+    deprecated    : $("#tgt-deprecated-plans"),
+    apps          : $("#tgt-apps"),
+    bp_versions   : $("#tgt-buildpack_versions"),
+    bp_name       : $("#tgt-bp-versions input[name=name]"),
+    bp_version    : $("#tgt-bp-versions input[name=version]"),
+    bp_add        : $("#tgt-bp-versions button"),
     buildpacks    : $("#tgt-buildpacks"),
+    stacks        : $("#tgt-stacks"),
     users         : $("#tgt-users"),
     externals     : $("#tgt-externals"),
     externals_add : $("#tgt-externals-add"),
+    org_roles     : $("#tgt-roles input[name=org_roles]"),
+    space_roles   : $("#tgt-roles input[name=space_roles]"),
     modal         : $("#tgt-mail"),
     modal_add     : $("#tgt-mail button.btn-success"),
     modal_mail    : $("#tgt-mail input"),
@@ -334,7 +548,8 @@ function Targets(p_app) {
       return true;
     }
 
-    if ($("button[data-id]", self.ui.accordion).length) {
+    if ($("button[data-id]", self.ui.accordion).length || self.ui.deprecated.is(":checked") ||
+        undefined != self.getAppFilter()) {
       self.hideError();
       return true;
     }
@@ -357,20 +572,75 @@ function Targets(p_app) {
     self.ui.error.show();
   };
 
+  self.decodeBuildpackVersion = function(p_id) {
+    var l_parts = String(p_id).split(":");
+    return {
+      "name"    : decodeURIComponent(l_parts[0]),
+      "version" : decodeURIComponent(l_parts[1] || "")
+    };
+  };
+
+  self.onBuildpackVersionAdd = function() {
+    var l_name    = self.ui.bp_name.val();
+    var l_version = self.ui.bp_version.val();
+    if (!l_name) {
+      return;
+    }
+    var l_id = encodeURIComponent(l_name) + ":" + encodeURIComponent(l_version);
+    var l_label = $("<span/>").text(l_version ? l_name + " " + l_version : l_name).html();
+    self.addTarget("buildpack_versions", l_id, l_label);
+    self.ui.bp_name.val("");
+    self.ui.bp_version.val("");
+    self.ui.bp_add.blur();
+  };
+
+  self.getAppFilter = function() {
+    var l_res = {};
+    var l_set = false;
+
+    $("select, input", self.ui.apps).each(function() {
+      var l_val = $(this).val();
+      if (!l_val) {
+        return;
+      }
+      if ("number" == $(this).attr("type")) {
+        l_val = parseInt(l_val, 10);
+      }
+      l_res[$(this).attr("name")] = l_val;
+      l_set = true;
+    });
+    return l_set ? l_res : undefined;
+  };
+
   self.getTargetData = function() {
     var l_res   = {
       "orgs"       : [],
       "spaces"     : [],
       "services"   : [],
+      "service_plans" : [],
+      "service_brokers" : [],
       "buildpacks" : [],
+      "buildpack_versions" : [],
+      "stacks"     : [],
       "users"      : [],
       "externals"  : []
     };
     $("button[data-id]", self.ui.accordion).each(function() {
       var l_type = $(this).data("type");
       var l_id   = $(this).data("id");
+      if ("buildpack_versions" == l_type) {
+        l_id = self.decodeBuildpackVersion(l_id);
+      }
       l_res[l_type].push(l_id);
     });
+    l_res["org_roles"] = self.ui.org_roles.filter(":checked").map(function() {
+      return $(this).val();
+    }).get();
+    l_res["space_roles"] = self.ui.space_roles.filter(":checked").map(function() {
+      return $(this).val();
+    }).get();
+    l_res["deprecated_plans"] = self.ui.deprecated.is(":checked");
+    l_res["apps"] = self.getAppFilter();
     return l_res;
   };
 
@@ -378,7 +648,11 @@ function Targets(p_app) {
     if (p_type == "orgs")       return self.ui.orgs;
     if (p_type == "spaces")     return self.ui.spaces;
     if (p_type == "services")   return self.ui.services;
+    if (p_type == "service_plans") return self.ui.service_plans;
+    if (p_type == "service_brokers") return self.ui.service_brokers;
     if (p_type == "buildpacks") return self.ui.buildpacks;
+    if (p_type == "stacks")     return self.ui.stacks;
+    if (p_type == "buildpack_versions") return self.ui.bp_versions;
     if (p_type == "users")      return self.ui.users;
     if (p_type == "externals")  return self.ui.externals;
     return undefined;
@@ -422,6 +696,39 @@ function Targets(p_app) {
     self.validate();
   };
 
+  // restore adds targets of given request, labeled by their identifier
+  self.restore = function(p_req, p_all) {
+    if (p_all) {
+      self.ui.all.addClass("active");
+      self.validate();
+      return;
+    }
+    $.each(["orgs", "spaces", "services", "service_plans", "service_brokers", "buildpacks", "stacks", "users"], function(c_idx, c_type) {
+      $.each(p_req[c_type] || [], function(c_idx, c_id) {
+        self.addTarget(c_type, c_id, $("<span/>").text(c_id).html());
+      });
+    });
+    $.each(p_req["recipients"] || [], function(c_idx, c_addr) {
+      self.addTarget("externals", c_addr, $("<span/>").text(c_addr).html());
+    });
+    $.each(p_req["buildpack_versions"] || [], function(c_idx, c_sel) {
+      var l_id = encodeURIComponent(c_sel["name"]) + ":" + encodeURIComponent(c_sel["version"] || "");
+      var l_label = c_sel["version"] ? c_sel["name"] + " " + c_sel["version"] : c_sel["name"];
+      self.addTarget("buildpack_versions", l_id, $("<span/>").text(l_label).html());
+    });
+    self.ui.org_roles.each(function() {
+      $(this).prop("checked", -1 != $.inArray($(this).val(), p_req["org_roles"] || []));
+    });
+    self.ui.space_roles.each(function() {
+      $(this).prop("checked", -1 != $.inArray($(this).val(), p_req["space_roles"] || []));
+    });
+    self.ui.deprecated.prop("checked", true == p_req["deprecated_plans"]);
+    $.each(p_req["apps"] || {}, function(c_name, c_val) {
+      $('[name="' + c_name + '"]', self.ui.apps).val(c_val);
+    });
+    self.validate();
+  };
+
   self.updateBadges = function() {
     $("div.panel", self.ui.accordion).each(function() {
       var l_badge = $(".label", $(this));
@@ -451,6 +758,9 @@ function Targets(p_app) {
     self.ui.modal_add.click(self.onModalAddClick);
     self.ui.externals_add.click(self.onExternalClick);
     self.ui.all.click(self.onAllClick);
+    self.ui.deprecated.change(self.validate);
+    self.ui.bp_add.click(self.onBuildpackVersionAdd);
+    $("select, input", self.ui.apps).change(self.validate);
   };
 
   self.init = function() {
@@ -700,6 +1010,10 @@ function ServiceTable(p_app) {
       p_app.targets.addTarget("services", $(this).data("id"), $(this).data("name"));
       $(this).blur();
     });
+    $("button.service_plans", self.ui.table).click(function() {
+      p_app.plan.loadService($(this).data("id"));
+      $(this).blur();
+    });
   };
 
   self.init = function() {
@@ -710,6 +1024,113 @@ function ServiceTable(p_app) {
 }
 
 
+function BrokerTable(p_app) {
+  var self = this;
+
+  GenericTable(self, "service_brokers", p_app);
+
+  self.initTable = function(p_data) {
+    var l_cols = [
+        {
+          "data"      : "name",
+          "className" : "text-center"
+        },
+        {
+          "data"      : "space_guid",
+          "className" : "text-center",
+          "defaultContent" : ""
+        },
+        {
+          "data"      : "guid",
+          "className" : "text-center",
+          "visible"   : true
+        },
+        {
+          "data" :  "actions",
+          "render" : function(p_data, p_type, p_row, p_meta) {
+            return template($("#tpl-broker-btn"), p_row);
+          },
+          "className" : "text-center"
+        }
+    ];
+    self.createTable(p_data, l_cols, self.bind);
+  };
+
+  self.bind = function() {
+    $('[data-toggle="tooltip"]').tooltip();
+    $("button.add_item",   self.ui.table).click(function() {
+      p_app.targets.addTarget("service_brokers", $(this).data("id"), $(this).data("name"));
+      $(this).blur();
+    });
+  };
+
+  self.init = function() {
+    p_app.api.getServiceBrokers(self.initTable);
+  };
+
+  self.init();
+}
+
+
+function PlanTable(p_app) {
+  var self = this;
+
+  GenericTable(self, "service_plans", p_app);
+
+  self.initTable = function(p_data) {
+    var l_cols = [
+        {
+          "data"      : "name",
+          "className" : "text-center"
+        },
+        {
+          "data"      : "deprecated",
+          "className" : "text-center",
+          "render"    : function(p_data, p_type, p_row, p_meta) {
+            return p_data ? "deprecated" : "active";
+          }
+        },
+        {
+          "data"      : "guid",
+          "className" : "text-center",
+          "visible"   : true
+        },
+        {
+          "data" :  "actions",
+          "render" : function(p_data, p_type, p_row, p_meta) {
+            return template($("#tpl-plan-btn"), p_row);
+          },
+          "className" : "text-center"
+        }
+    ];
+    self.createTable(p_data, l_cols, self.bind);
+  };
+
+  self.loadService = function(p_service) {
+    p_app.api.getServicePlans(p_service, function(p_data) {
+      self.dtable.clear();
+      self.dtable.rows.add(self.addActionColumn(p_data));
+      self.dtable.draw();
+      self.showTab();
+    });
+  };
+
+  self.bind = function() {
+    $('[data-toggle="tooltip"]').tooltip();
+    $("button.add_item",   self.ui.table).off("click").click(function() {
+      p_app.targets.addTarget("service_plans", $(this).data("id"), $(this).data("name"));
+      $(this).blur();
+    });
+  };
+
+  self.init = function() {
+    self.initTable([]);
+  };
+
+  self.init();
+}
+
+
 function BuildpackTable(p_app) {
   var self = this;
 
@@ -753,7 +1174,285 @@ function BuildpackTable(p_app) {
 }
 
 
-function App() {
+function StackTable(p_app) {
+  var self = this;
+
+  GenericTable(self, "stacks", p_app);
+
+  self.initTable = function(p_data) {
+    var l_cols = [
+        {
+          "data"      : "name",
+          "className" : "text-center"
+        },
+        {
+          "data"      : "description",
+          "className" : "text-center",
+          "defaultContent" : ""
+        },
+        {
+          "data"      : "guid",
+          "className" : "text-center",
+          "visible"   : true
+        },
+        {
+          "data" :  "actions",
+          "render" : function(p_data, p_type, p_row, p_meta) {
+            return template($("#tpl-stack-btn"), p_row);
+          },
+          "className" : "text-center"
+        }
+    ];
+    self.createTable(p_data, l_cols, self.bind);
+  };
+
+  self.bind = function() {
+    $('[data-toggle="tooltip"]').tooltip();
+    $("button.add_item",   self.ui.table).click(function() {
+      p_app.targets.addTarget("stacks", $(this).data("id"), $(this).data("name"));
+      $(this).blur();
+    });
+  };
+
+  self.init = function() {
+    p_app.api.getStacks(self.initTable);
+  };
+
+  self.init();
+}
+
+
+function History(p_app) {
+  var self = this;
+
+  self.entries = {};
+  self.ui = {
+    table  : $("#history_table"),
+    detail : {
+      modal   : $("#history-detail"),
+      subject : $("#history-detail-subject"),
+      info    : $("#history-detail-info"),
+      body    : $("#history-detail-body"),
+      reuse   : $("#history-detail-reuse")
+    }
+  };
+
+  self.formatTargets = function(p_req) {
+    var l_res = [];
+    $.each(["orgs", "spaces", "services", "service_plans", "service_brokers", "buildpacks", "buildpack_versions", "stacks", "users", "recipients"], function(c_idx, c_key) {
+      if (p_req[c_key] != undefined && 0 != p_req[c_key].length) {
+        l_res.push(p_req[c_key].length + " " + c_key);
+      }
+    });
+    if (p_req["apps"]) {
+      l_res.push("apps filter");
+    }
+    return l_res.join(", ");
+  };
+
+  self.formatDate = function(p_date) {
+    return new Date(p_date).toLocaleString();
+  };
+
+  self.initTable = function(p_data) {
+    $.each(p_data, function(c_idx, c_entry) {
+      self.entries[c_entry["id"]] = c_entry;
+    });
+
+    self.ui.table.DataTable({
+      "data"    : p_data,
+      "order"   : [[ 0, "desc" ]],
+      "columns" : [
+        {
+          "data"      : "created",
+          "className" : "text-center",
+          "render"    : function(p_data, p_type, p_row, p_meta) {
+            return ("display" == p_type) ? self.formatDate(p_data) : p_data;
+          }
+        },
+        { "data" : "subject", "render" : $.fn.dataTable.render.text() },
+        { "data" : "user", "className" : "text-center", "render" : $.fn.dataTable.render.text() },
+        {
+          "data"      : "request",
+          "className" : "text-center",
+          "render"    : function(p_data, p_type, p_row, p_meta) {
+            if ("message_all" == p_row["kind"])
+              return "everyone";
+            return self.formatTargets(p_data);
+          }
+        },
+        { "data" : "outcome", "className" : "text-center", "render" : $.fn.dataTable.render.text() },
+        {
+          "data"      : "delivered",
+          "className" : "text-center",
+          "render"    : function(p_data, p_type, p_row, p_meta) {
+            return p_row["delivered"] + " / " + p_row["count"] + " (" + p_row["failed"] + " failed)";
+          }
+        },
+        {
+          "data"      : "id",
+          "className" : "text-center",
+          "render"    : function(p_data, p_type, p_row, p_meta) {
+            return template($("#tpl-history-btn"), p_row);
+          }
+        }
+      ],
+      "drawCallback" : self.bind
+    });
+  };
+
+  self.showDetail = function(p_id) {
+    var l_entry = self.entries[p_id];
+    var l_info  = {
+      "Sender"   : l_entry["user"] + " <" + l_entry["email"] + ">",
+      "Date"     : self.formatDate(l_entry["created"]),
+      "Kind"     : l_entry["kind"],
+      "Targets"  : ("message_all" == l_entry["kind"]) ? "everyone" : self.formatTargets(l_entry["request"]),
+      "Outcome"  : l_entry["outcome"],
+      "Delivery" : l_entry["delivered"] + " / " + l_entry["count"] + " (" + l_entry["failed"] + " failed)"
+    };
+
+    self.ui.detail.subject.text(l_entry["subject"]);
+    self.ui.detail.info.empty();
+    $.each(l_info, function(c_key, c_val) {
+      self.ui.detail.info.append($("<dt/>").text(c_key));
+      self.ui.detail.info.append($("<dd/>").text(c_val));
+    });
+    self.ui.detail.reuse.data("id", p_id);
+    self.ui.detail.body.empty();
+    p_app.api.postRender({ "message" : l_entry["request"]["message"] }, function(p_data) {
+      self.ui.detail.body.prepend($("<div/>").html(p_data["html"]));
+      self.ui.detail.modal.modal("show");
+    });
+    $.each(l_entry["request"]["messages"] || {}, function(c_lang, c_msg) {
+      var l_el = $("<div/>");
+      var l_sub = (l_entry["request"]["subjects"] || {})[c_lang];
+      self.ui.detail.body.append($("<hr/>"));
+      self.ui.detail.body.append($("<h4/>").text(c_lang + (l_sub ? " - " + l_sub : "")));
+      self.ui.detail.body.append(l_el);
+      p_app.api.postRender({ "message" : c_msg }, function(p_data) {
+        l_el.html(p_data["html"]);
+      });
+    });
+  };
+
+  self.reuse = function(p_id) {
+    var l_entry = self.entries[p_id];
+    var l_req   = l_entry["request"];
+    window.localStorage.setItem("subject", l_req["subject"]);
+    window.localStorage.setItem("message", l_req["message"]);
+    window.localStorage.setItem("request", JSON.stringify({
+      "all"     : ("message_all" == l_entry["kind"]),
+      "request" : l_req
+    }));
+    window.location.href = "/ui";
+  };
+
+  self.bind = function() {
+    $('[data-toggle="tooltip"]').tooltip();
+    $("button.history_view", self.ui.table).off("click").click(function() {
+      self.showDetail($(this).data("id"));
+    });
+    $("button.history_reuse", self.ui.table).off("click").click(function() {
+      self.reuse($(this).data("id"));
+    });
+  };
+
+  self.load = function() {
+    p_app.api.getAudit(self.initTable);
+  };
+
+  self.init = function() {
+    self.ui.detail.modal.modal({ "show" : false });
+    self.ui.detail.reuse.click(function() {
+      self.reuse($(this).data("id"));
+    });
+  };
+
+  self.init();
+}
+
+
+function Preferences(p_app) {
+  var self = this;
+
+  self.ui = {
+    form       : $("#pref_form"),
+    language   : $("#pref_language"),
+    categories : $("#pref_categories tbody"),
+    channels   : $("#pref_categories thead tr")
+  };
+
+  self.render = function(p_cats, p_pref) {
+    var l_prefs = p_pref["categories"] || {};
+
+    self.ui.language.val(p_pref["language"]);
+    $.each(p_cats["channels"], function(c_idx, c_channel) {
+      self.ui.channels.append($("<th class='text-center'/>").text(c_channel));
+    });
+    $.each(p_cats["categories"], function(c_idx, c_cat) {
+      var l_row = $("<tr/>").append($("<td/>").text(c_cat["name"]));
+      $.each(p_cats["channels"], function(c_jdx, c_channel) {
+        var l_box = $("<input type='checkbox'/>").
+            attr("data-category", c_cat["name"]).
+            attr("data-channel", c_channel);
+        var l_set = l_prefs[c_cat["name"]];
+        var l_optin = (-1 != $.inArray(c_channel, p_cats["opt_in"] || []));
+        if (l_set == undefined) {
+          l_box.prop("checked", !l_optin);
+        } else {
+          l_box.prop("checked", -1 != $.inArray(c_channel, l_set));
+        }
+        if (c_cat["mandatory"] && !l_optin) {
+          l_box.prop("checked", true).prop("disabled", true).attr("title", "mandatory");
+        }
+        l_row.append($("<td class='text-center'/>").append(l_box));
+      });
+      self.ui.categories.append(l_row);
+    });
+  };
+
+  self.getData = function() {
+    var l_res = {
+      "language"   : self.ui.language.val(),
+      "categories" : {}
+    };
+    $("input[type=checkbox]", self.ui.categories).each(function() {
+      var l_cat = $(this).data("category");
+      if (l_res["categories"][l_cat] == undefined) {
+        l_res["categories"][l_cat] = [];
+      }
+      if ($(this).prop("checked")) {
+        l_res["categories"][l_cat].push($(this).data("channel"));
+      }
+    });
+    return l_res;
+  };
+
+  self.onSubmit = function() {
+    p_app.api.putPreferences(self.getData(), function(p_data) {
+      p_app.addMessage("Preferences saved.");
+    });
+    return false;
+  };
+
+  self.load = function() {
+    p_app.api.getCategories(function(p_cats) {
+      p_app.api.getPreferences(function(p_pref) {
+        self.render(p_cats, p_pref);
+      });
+    });
+  };
+
+  self.init = function() {
+    self.ui.form.submit(self.onSubmit);
+  };
+
+  self.init();
+}
+
+
+function App(p_page) {
   var app = this;
 
   self.errors = [];
@@ -823,8 +1522,13 @@ function App() {
     self.space     = new SpaceTable(self);
     self.user      = new UserTable(self);
     self.service   = new ServiceTable(self);
+    self.plan      = new PlanTable(self);
+    self.broker    = new BrokerTable(self);
     self.buildpack = new BuildpackTable(self);
+    self.stack     = new StackTable(self);
     self.org.showTab();
+    self.message.loadSenders();
+    self.message.loadCategories();
   };
 
   self.init = function() {
@@ -832,10 +1536,20 @@ function App() {
     self.ui.msg.modal.modal({ "show" : false });
     self.bind();
 
-    self.targets = new Targets(self);
-    self.message = new Message(self);
-    self.api     = new Api(self);
-    self.api.init(self.initTables);
+    if ("history" == p_page) {
+      self.api     = new Api(self);
+      self.history = new History(self);
+      self.api.init(self.history.load);
+    } else if ("preferences" == p_page) {
+      self.api         = new Api(self);
+      self.preferences = new Preferences(self);
+      self.api.init(self.preferences.load);
+    } else {
+      self.targets = new Targets(self);
+      self.message = new Message(self);
+      self.api     = new Api(self);
+      self.api.init(self.initTables);
+    }
 
     self.updateMailCount();
     window.setInterval(self.updateMailCount, 60 * 1000);
@@ -0,0 +1,61 @@
+    <title> CloudFoundry Wall Ui </title>
+    <script src="/ui/static/bower_components/jquery/dist/jquery.min.js"></script>
+    <script src="/ui/static/bower_components/bootstrap/dist/js/bootstrap.min.js"></script>
+    <script src="/ui/static/bower_components/datatables.net/js/jquery.dataTables.min.js"></script>
+    <script src="/ui/static/bower_components/datatables.net-bs/js/dataTables.bootstrap.min.js"></script>
+    <script src="/ui/static/bower_components/jquery-validation/dist/jquery.validate.min.js"></script>
+    <script src="/ui/static/bower_components/jquery.cookie/jquery.cookie.js"></script>
+    <script src="/ui/static/cf-wall.js"></script>
+    <link rel="shortcut icon" href="/ui/static/favicon.ico" />
+    <link rel="stylesheet"    href="/ui/static/bower_components/bootstrap/dist/css/bootstrap.min.css"/>
+    <link rel="stylesheet"    href="/ui/static/bower_components/datatables.net-bs/css/dataTables.bootstrap.min.css"/>
+    <link rel="stylesheet"    href="/ui/static/bower_components/font-awesome/css/font-awesome.min.css" type="text/css" media="all" />
+    <link rel="stylesheet"    href="/ui/static/bower_components/PACE/themes/blue/pace-theme-corner-indicator.css" type="text/css" media="all" />
+    <link rel="stylesheet"    href="/ui/static/style.css" type="text/css" media="all" />
+    <script>
+     window.paceOptions = {
+       document: false, // disabled
+       eventLag: false, // disabled
+       restartOnPushState: false,
+       restartOnRequestAfter: false,
+       startOnPageLoad: false
+     }
+    </script>
+
+    <script src="/ui/static/bower_components/PACE/pace.min.js"></script>
+
+    <style>
+     .modal-content
+     {
+       border-bottom-left-radius: 6px;
+       border-bottom-right-radius: 6px;
+       -webkit-border-bottom-left-radius: 6px;
+       -webkit-border-bottom-right-radius: 6px;
+       -moz-border-radius-bottomleft: 6px;
+       -moz-border-radius-bottomright: 6px;
+     }
+
+     .modal-header
+     {
+       border-top-left-radius: 6px;
+       border-top-right-radius: 6px;
+       -webkit-border-top-left-radius: 6px;
+       -webkit-border-top-right-radius: 6px;
+       -moz-border-radius-topleft: 6px;
+       -moz-border-radius-topright: 6px;
+     }
+
+     div.dataTables_filter {
+       width: 100%;
+     }
+     div.dataTables_filter label {
+       width:100%;
+     }
+     div.dataTables_filter label input {
+       width:80% !important;
+     }
+     #app-msg-content, #app-errors-content {
+       max-height: calc(100vh - 110px);
+       overflow-y: scroll;
+     }
+    </style>
@@ -24,6 +24,25 @@
         <li class="dropdown">
           <a href="#" class="dropdown-toggle" data-toggle="dropdown" role="button" aria-haspopup="true" aria-expanded="false"><span class="glyphicon glyphicon-menu-hamburger"></span></a>
           <ul class="dropdown-menu">
+            <li>
+              <a href="/ui">
+                <span class="fa fa-pencil"></span>
+                Compose
+              </a>
+            </li>
+            <li>
+              <a href="/ui/history">
+                <span class="fa fa-history"></span>
+                History
+              </a>
+            </li>
+            <li>
+              <a href="/ui/preferences">
+                <span class="fa fa-sliders"></span>
+                My preferences
+              </a>
+            </li>
+            <li role="separator" class="divider"></li>
             <li>
               <a href="https://github.com/orange-cloudfoundry/cf-wall/blob/master/README.md">
                 <span class="fa fa-file-text-o"></span>
@@ -0,0 +1,67 @@
+<html lang="en">
+  <head>
+    {{ template "head.tpl" }}
+    <script>
+     $(document).ready(function(){
+       var g_app = new App("history");
+     });
+    </script>
+  </head>
+  <body>
+    {{ template "header.tpl" }}
+    <div class="container-fluid">
+      <div class="row">
+        <div class="col-md-10 col-md-offset-1">
+          <h3>Sent messages</h3>
+          <table id="history_table" class="table table-striped table-bordered table-hover table-condensed" cellspacing="0" width="100%">
+            <thead>
+              <tr>
+                <th class="text-center">Date</th>
+                <th class="text-center">Subject</th>
+                <th class="text-center">Sender</th>
+                <th class="text-center">Targets</th>
+                <th class="text-center">Outcome</th>
+                <th class="text-center">Delivery</th>
+                <th>Actions</th>
+              </tr>
+            </thead>
+            <tbody/>
+          </table>
+        </div>
+      </div>
+    </div>
+
+    <div id="history-detail" class="modal fade" tabindex="-1" role="dialog">
+      <div class="modal-dialog modal-lg" role="document">
+        <div class="modal-content">
+          <div class="modal-header">
+            <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
+            <h4 class="modal-title" id="history-detail-subject"></h4>
+          </div>
+          <div class="modal-body">
+            <dl class="dl-horizontal" id="history-detail-info"></dl>
+            <div id="history-detail-body"></div>
+          </div>
+          <div class="modal-footer">
+            <div class="text-center">
+              <div class="btn-group">
+                <button class="btn btn-default" data-dismiss="modal">Close</button>
+                <button class="btn btn-success" id="history-detail-reuse">Reuse as new message</button>
+              </div>
+            </div>
+          </div>
+        </div>
+      </div>
+    </div>
+
+    {{ template "modals.tpl" }}
+
+    <!-- Templates -->
+    <div class="hidden" id="tpl-history-btn">
+      <div class="btn-group">
+        <button data-toggle="tooltip" data-placement="right" title="View message" class='btn btn-primary btn-xs glyphicon glyphicon-eye-open history_view' data-id='[[id]]'></button>
+        <button data-toggle="tooltip" data-placement="right" title="Reuse as new message" class='btn btn-success btn-xs glyphicon glyphicon-duplicate history_reuse' data-id='[[id]]'></button>
+      </div>
+    </div>
+  </body>
+</html>
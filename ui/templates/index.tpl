@@ -1,71 +1,11 @@
 <html lang="en">
   <head>
-    <title> CloudFoundry Wall Ui </title>
-    <script src="/ui/static/bower_components/jquery/dist/jquery.min.js"></script>
-    <script src="/ui/static/bower_components/bootstrap/dist/js/bootstrap.min.js"></script>
-    <script src="/ui/static/bower_components/datatables.net/js/jquery.dataTables.min.js"></script>
-    <script src="/ui/static/bower_components/datatables.net-bs/js/dataTables.bootstrap.min.js"></script>
-    <script src="/ui/static/bower_components/jquery-validation/dist/jquery.validate.min.js"></script>
-    <script src="/ui/static/bower_components/markdown-it/dist/markdown-it.min.js"></script>
-    <script src="/ui/static/bower_components/jquery.cookie/jquery.cookie.js"></script>
-    <script src="/ui/static/cf-wall.js"></script>
-    <link rel="shortcut icon" href="/ui/static/favicon.ico" />
-    <link rel="stylesheet"    href="/ui/static/bower_components/bootstrap/dist/css/bootstrap.min.css"/>
-    <link rel="stylesheet"    href="/ui/static/bower_components/datatables.net-bs/css/dataTables.bootstrap.min.css"/>
-    <link rel="stylesheet"    href="/ui/static/bower_components/font-awesome/css/font-awesome.min.css" type="text/css" media="all" />
-    <link rel="stylesheet"    href="/ui/static/bower_components/PACE/themes/blue/pace-theme-corner-indicator.css" type="text/css" media="all" />
-    <link rel="stylesheet"    href="/ui/static/style.css" type="text/css" media="all" />
+    {{ template "head.tpl" }}
     <script>
-     window.paceOptions = {
-       document: false, // disabled
-       eventLag: false, // disabled
-       restartOnPushState: false,
-       restartOnRequestAfter: false,
-       startOnPageLoad: false
-     }
-
      $(document).ready(function(){
        var g_app = new App();
      });
     </script>
-
-    <script src="/ui/static/bower_components/PACE/pace.min.js"></script>
-
-    <style>
-     .modal-content
-     {
-       border-bottom-left-radius: 6px;
-       border-bottom-right-radius: 6px;
-       -webkit-border-bottom-left-radius: 6px;
-       -webkit-border-bottom-right-radius: 6px;
-       -moz-border-radius-bottomleft: 6px;
-       -moz-border-radius-bottomright: 6px;
-     }
-
-     .modal-header
-     {
-       border-top-left-radius: 6px;
-       border-top-right-radius: 6px;
-       -webkit-border-top-left-radius: 6px;
-       -webkit-border-top-right-radius: 6px;
-       -moz-border-radius-topleft: 6px;
-       -moz-border-radius-topright: 6px;
-     }
-
-     div.dataTables_filter {
-       width: 100%;
-     }
-     div.dataTables_filter label {
-       width:100%;
-     }
-     div.dataTables_filter label input {
-       width:80% !important;
-     }
-     #app-msg-content, #app-errors-content {
-       max-height: calc(100vh - 110px);
-       overflow-y: scroll;
-     }
-    </style>
   </head>
   <body>
     {{ template "header.tpl" }}
@@ -75,14 +15,20 @@
           <li role="presentation"> <a href="#orgs"       aria-controls="orgs"       role="tab" data-toggle="tab">Orgs</a></li>
           <li role="presentation"> <a href="#spaces"     aria-controls="spaces"     role="tab" data-toggle="tab">Spaces</a></li>
           <li role="presentation"> <a href="#services"   aria-controls="services"   role="tab" data-toggle="tab">Services</a></li>
+          <li role="presentation"> <a href="#service_plans" aria-controls="service_plans" role="tab" data-toggle="tab">Plans</a></li>
+          <li role="presentation"> <a href="#service_brokers" aria-controls="service_brokers" role="tab" data-toggle="tab">Brokers</a></li>
           <li role="presentation"> <a href="#buildpacks" aria-controls="buildpacks" role="tab" data-toggle="tab">Build Packs</a></li>
+          <li role="presentation"> <a href="#stacks"     aria-controls="stacks"     role="tab" data-toggle="tab">Stacks</a></li>
           <li role="presentation"> <a href="#users"      aria-controls="users"      role="tab" data-toggle="tab">Users</a></li>
         </ul>
         <div class="tab-content objects">
           {{ template "table.tpl" mkDict "Id" "orgs"       "Cols" (mkSlice "Name" "Guid")         }}
           {{ template "table.tpl" mkDict "Id" "spaces"     "Cols" (mkSlice "Name" "Guid" "Org")   }}
           {{ template "table.tpl" mkDict "Id" "services"   "Cols" (mkSlice "Name" "Guid") }}
+          {{ template "table.tpl" mkDict "Id" "service_plans" "Cols" (mkSlice "Name" "Status" "Guid") }}
+          {{ template "table.tpl" mkDict "Id" "service_brokers" "Cols" (mkSlice "Name" "Space" "Guid") }}
           {{ template "table.tpl" mkDict "Id" "buildpacks" "Cols" (mkSlice "Name" "Guid") }}
+          {{ template "table.tpl" mkDict "Id" "stacks"     "Cols" (mkSlice "Name" "Description" "Guid") }}
           {{ template "table.tpl" mkDict "Id" "users"      "Cols" (mkSlice "Name" "Guid")         }}
         </div>
       </div>
@@ -104,10 +50,72 @@
               {{ template "accordion.tpl" mkDict "Name" "orgs"       "Title" "Organizations" }}
               {{ template "accordion.tpl" mkDict "Name" "spaces"     "Title" "Spaces"        }}
               {{ template "accordion.tpl" mkDict "Name" "services"   "Title" "Services"      }}
+              {{ template "accordion.tpl" mkDict "Name" "service_plans" "Title" "Service Plans" }}
+              {{ template "accordion.tpl" mkDict "Name" "service_brokers" "Title" "Service Brokers" }}
               {{ template "accordion.tpl" mkDict "Name" "buildpacks" "Title" "Build Packs"   }}
+              {{ template "accordion.tpl" mkDict "Name" "buildpack_versions" "Title" "Build Pack Versions" }}
+              {{ template "accordion.tpl" mkDict "Name" "stacks"     "Title" "Stacks"        }}
               {{ template "accordion.tpl" mkDict "Name" "users"      "Title" "Users"         }}
               {{ template "accordion.tpl" mkDict "Name" "externals"  "Title" "Externals"     }}
             </div>
+            <div id="tgt-roles" class="form-group">
+              <label>Organization roles</label><br/>
+              <label class="checkbox-inline"><input type="checkbox" name="org_roles" value="OrgManager"> Manager</label>
+              <label class="checkbox-inline"><input type="checkbox" name="org_roles" value="BillingManager"> Billing</label>
+              <label class="checkbox-inline"><input type="checkbox" name="org_roles" value="OrgAuditor"> Auditor</label>
+              <br/>
+              <label>Space roles</label><br/>
+              <label class="checkbox-inline"><input type="checkbox" name="space_roles" value="SpaceManager"> Manager</label>
+              <label class="checkbox-inline"><input type="checkbox" name="space_roles" value="SpaceDeveloper"> Developer</label>
+              <label class="checkbox-inline"><input type="checkbox" name="space_roles" value="SpaceAuditor"> Auditor</label>
+              <label class="checkbox-inline"><input type="checkbox" name="space_roles" value="SpaceSupporter"> Supporter</label>
+              <p class="help-block">Leave unchecked to reach all users.</p>
+              <div class="checkbox">
+                <label><input type="checkbox" id="tgt-deprecated-plans"> Owners of instances on deprecated plans</label>
+              </div>
+            </div>
+            <div id="tgt-bp-versions" class="form-group">
+              <label>Build pack versions</label>
+              <div class="input-group input-group-sm">
+                <input type="text" name="name" class="form-control" placeholder="Name regexp"/>
+                <span class="input-group-btn" style="width:0px;"></span>
+                <input type="text" name="version" class="form-control" placeholder="Version, ex: < 4.10"/>
+                <span class="input-group-btn">
+                  <button type="button" class="btn btn-success fa fa-plus" data-toggle="tooltip" title="Add build pack version"></button>
+                </span>
+              </div>
+            </div>
+            <div id="tgt-apps" class="form-group">
+              <label>Applications matching</label>
+              <div class="row">
+                <div class="col-xs-6">
+                  <select name="state" class="form-control input-sm">
+                    <option value="">Any state</option>
+                    <option value="STARTED">Started</option>
+                    <option value="STOPPED">Stopped</option>
+                  </select>
+                </div>
+                <div class="col-xs-6">
+                  <select name="lifecycle" class="form-control input-sm">
+                    <option value="">Any lifecycle</option>
+                    <option value="buildpack">Buildpack</option>
+                    <option value="docker">Docker</option>
+                  </select>
+                </div>
+              </div>
+              <input type="text" name="name" class="form-control input-sm" placeholder="Name regexp"/>
+              <div class="row">
+                <div class="col-xs-4">
+                  <input type="number" min="0" name="min_instances" class="form-control input-sm" placeholder="Min instances"/>
+                </div>
+                <div class="col-xs-4">
+                  <input type="number" min="0" name="min_memory" class="form-control input-sm" placeholder="Min memory (MB)"/>
+                </div>
+                <div class="col-xs-4">
+                  <input type="number" min="0" name="not_pushed_months" class="form-control input-sm" placeholder="Not pushed (months)"/>
+                </div>
+              </div>
+            </div>
             <div class="form-group has-error has-danger text-center">
               <label id="tgt-error" class="text-danger" for="msg_subject">You must add at least one target.</label>
             </div>
@@ -124,9 +132,33 @@
             <div role="tabpanel" class="tab-pane active" id="message">
               <br/>
               <form id="msg_form" role="form">
+                <div class="form-group hidden">
+                  <select id="msg_sender" name="sender" class="form-control">
+                    <option value="">Default sender</option>
+                  </select>
+                </div>
+                <div class="form-group">
+                  <select id="msg_category" name="category" class="form-control">
+                    <option value="">No category</option>
+                  </select>
+                </div>
+                <div class="form-group">
+                  <label class="checkbox-inline"><input type="checkbox" name="channels" value="email" checked> Email</label>
+                  <label class="checkbox-inline"><input type="checkbox" name="channels" value="chat"> Chat</label>
+                  <label class="checkbox-inline"><input type="checkbox" name="channels" value="sms"> SMS</label>
+                </div>
+                <div class="form-group form-inline" data-toggle="tooltip" data-placement="top" title="Optionally display message as a dashboard banner">
+                  <label for="msg_display_start">Banner from</label>
+                  <input type="datetime-local" id="msg_display_start" class="form-control input-sm">
+                  <label for="msg_display_end">until</label>
+                  <input type="datetime-local" id="msg_display_end" class="form-control input-sm">
+                </div>
                 <div class="form-group">
                   <input name="subject" type="text" class="required form-control" id="msg_subject" placeholder="Subject...">
                 </div>
+                <div class="form-group">
+                  <input name="summary" type="text" class="form-control" id="msg_summary" maxlength="160" placeholder="Short summary for SMS (optional)...">
+                </div>
                 <div class="form-group has-feedback">
                   <textarea style="min-height:200px;" id="msg_content" name="message" class="required form-control" placeholder="Markdown message..."></textarea>
                 </div>
@@ -134,17 +166,28 @@
             </div>
             <div role="tabpanel" class="tab-pane" id="preview">
               <br/>
-              <div id="msg_preview">
-              </div>
+              <p>
+                Sample recipient: <strong id="msg_preview_recipient"></strong>
+                <a id="msg_preview_download" class="btn btn-default btn-xs pull-right" download="preview.eml">
+                  <span class="fa fa-download"></span> .eml
+                </a>
+              </p>
+              <pre id="msg_preview_headers"></pre>
+              <iframe id="msg_preview" style="width:100%;min-height:400px;border:1px solid #ddd;"></iframe>
+              <pre id="msg_preview_text"></pre>
             </div>
           </div>
 
           <div class="row">
             <br/>
-            <button id="msg_send" class="btn btn-success btn-large col-xs-2 col-xs-offset-5">
+            <button id="msg_send" class="btn btn-success btn-large col-xs-2 col-xs-offset-4">
               <span class="glyphicon glyphicon-envelope pull-left"></span>
               Send
             </button>
+            <button id="msg_test" class="btn btn-default btn-large col-xs-2 col-xs-offset-1" data-toggle="tooltip" data-placement="top" title="Send to my own address only">
+              <span class="glyphicon glyphicon-user pull-left"></span>
+              Send test
+            </button>
           </div>
         </div>
       </div>
@@ -196,32 +239,7 @@
     </div>
 
 
-    <div id='app-errors' class="modal fade" tabindex="-1" role="dialog">
-      <div class="modal-dialog" role="document">
-        <div class="modal-content">
-          <div class="modal-header alert-danger">
-            <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
-            <h4 class="modal-title">API Errors</h4>
-          </div>
-          <div class="modal-body" id='app-errors-content'>
-          </div>
-        </div>
-      </div>
-    </div>
-
-    <div id='app-msg' class="modal fade" tabindex="-1" role="dialog">
-      <div class="modal-dialog" role="document">
-        <div class="modal-content">
-          <div class="modal-header alert-success">
-            <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
-            <h4 class="modal-title">Messages</h4>
-          </div>
-          <div class="modal-body" id='app-msg-content'>
-          </div>
-        </div>
-      </div>
-    </div>
-
+    {{ template "modals.tpl" }}
 
     <!-- Templates -->
     <div class="hidden" id="tpl-org-btn">
@@ -243,6 +261,17 @@
     <div class="hidden" id="tpl-service-btn">
       <div class="btn-group">
         <button data-toggle="tooltip" data-placement="right" title="Add service" class='btn btn-success btn-xs glyphicon glyphicon-check add_item' data-id='[[guid]]' data-name='[[name]]'></button>
+        <button data-toggle="tooltip" data-placement="right" title="Show plans"  class='btn btn-primary btn-xs glyphicon glyphicon-arrow-right service_plans' data-id='[[guid]]'></button>
+      </div>
+    </div>
+    <div class="hidden" id="tpl-broker-btn">
+      <div class="btn-group">
+        <button data-toggle="tooltip" data-placement="right" title="Add service broker" class='btn btn-success btn-xs glyphicon glyphicon-check add_item' data-id='[[guid]]' data-name='[[name]]'></button>
+      </div>
+    </div>
+    <div class="hidden" id="tpl-plan-btn">
+      <div class="btn-group">
+        <button data-toggle="tooltip" data-placement="right" title="Add service plan" class='btn btn-success btn-xs glyphicon glyphicon-check add_item' data-id='[[guid]]' data-name='[[name]]'></button>
       </div>
     </div>
     <div class="hidden" id="tpl-buildpack-btn">
@@ -250,6 +279,11 @@
         <button data-toggle="tooltip" data-placement="right" title="Add buildpack" class='btn btn-success btn-xs glyphicon glyphicon-check add_item' data-id='[[guid]]' data-name='[[name]]'></button>
       </div>
     </div>
+    <div class="hidden" id="tpl-stack-btn">
+      <div class="btn-group">
+        <button data-toggle="tooltip" data-placement="right" title="Add stack" class='btn btn-success btn-xs glyphicon glyphicon-check add_item' data-id='[[guid]]' data-name='[[name]]'></button>
+      </div>
+    </div>
     <div class="hidden" id="tpl-target">
       <span>
         <button data-toggle="tooltip" data-placement="right" title="Remove target" data-id="[[id]]" data-type="[[type]]" class="btn btn-danger btn-xs glyphicon glyphicon-remove"></button>
@@ -0,0 +1,25 @@
+    <div id='app-errors' class="modal fade" tabindex="-1" role="dialog">
+      <div class="modal-dialog" role="document">
+        <div class="modal-content">
+          <div class="modal-header alert-danger">
+            <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
+            <h4 class="modal-title">API Errors</h4>
+          </div>
+          <div class="modal-body" id='app-errors-content'>
+          </div>
+        </div>
+      </div>
+    </div>
+
+    <div id='app-msg' class="modal fade" tabindex="-1" role="dialog">
+      <div class="modal-dialog" role="document">
+        <div class="modal-content">
+          <div class="modal-header alert-success">
+            <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
+            <h4 class="modal-title">Messages</h4>
+          </div>
+          <div class="modal-body" id='app-msg-content'>
+          </div>
+        </div>
+      </div>
+    </div>
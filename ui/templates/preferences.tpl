@@ -0,0 +1,41 @@
+<html lang="en">
+  <head>
+    {{ template "head.tpl" }}
+    <script>
+     $(document).ready(function(){
+       var g_app = new App("preferences");
+     });
+    </script>
+  </head>
+  <body>
+    {{ template "header.tpl" }}
+    <div class="container-fluid">
+      <div class="row">
+        <div class="col-md-6 col-md-offset-3">
+          <h3>My preferences</h3>
+          <form id="pref_form" role="form">
+            <div class="form-group">
+              <label for="pref_language">Language</label>
+              <input type="text" class="form-control" id="pref_language" placeholder="en, fr, fr-be...">
+            </div>
+            <div class="form-group">
+              <label>Received announcements</label>
+              <table id="pref_categories" class="table table-striped table-bordered table-condensed">
+                <thead>
+                  <tr>
+                    <th>Category</th>
+                  </tr>
+                </thead>
+                <tbody/>
+              </table>
+              <p class="help-block">Mandatory categories cannot be opted out of.</p>
+            </div>
+            <button type="submit" class="btn btn-success">Save</button>
+          </form>
+        </div>
+      </div>
+    </div>
+
+    {{ template "modals.tpl" }}
+  </body>
+</html>
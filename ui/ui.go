@@ -28,6 +28,8 @@ func NewUiHandler(pConf *core.AppConfig, pRouter *mux.Router) *UiHandler {
 	pRouter.PathPrefix("/ui/static/").
 		Handler(http.StripPrefix("/ui/static/", http.FileServer(http.Dir("ui/static"))))
 	pRouter.HandleFunc("/ui", core.DecorateHandler(lObj.HandlerRequest))
+	pRouter.HandleFunc("/ui/history", core.DecorateHandler(lObj.HandleHistory))
+	pRouter.HandleFunc("/ui/preferences", core.DecorateHandler(lObj.HandlePreferences))
 	pRouter.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/ui", http.StatusMovedPermanently)
 	})
@@ -42,7 +44,15 @@ func createTemplates() (*template.Template, error) {
 
 	lTpl, lErr := template.New("index.tpl").
 		Funcs(template.FuncMap(lFuncMap)).
-		ParseFiles("ui/templates/index.tpl", "ui/templates/header.tpl", "ui/templates/table.tpl", "ui/templates/accordion.tpl")
+		ParseFiles(
+			"ui/templates/index.tpl",
+			"ui/templates/history.tpl",
+			"ui/templates/preferences.tpl",
+			"ui/templates/head.tpl",
+			"ui/templates/modals.tpl",
+			"ui/templates/header.tpl",
+			"ui/templates/table.tpl",
+			"ui/templates/accordion.tpl")
 
 	if lErr != nil {
 		log.WithError(lErr).Error("unable to parse ui template")
@@ -61,7 +71,7 @@ func (self *UiHandler) reloadTempaltes() error {
 	return nil
 }
 
-func (self *UiHandler) HandlerRequest(pRes http.ResponseWriter, pReq *http.Request) {
+func (self *UiHandler) render(pRes http.ResponseWriter, pName string) {
 	if self.Config.ReloadTemplates {
 		lErr := self.reloadTempaltes()
 		if lErr != nil {
@@ -69,13 +79,25 @@ func (self *UiHandler) HandlerRequest(pRes http.ResponseWriter, pReq *http.Reque
 		}
 	}
 
-	lErr := self.Tpl.Execute(pRes, nil)
+	lErr := self.Tpl.ExecuteTemplate(pRes, pName, nil)
 	if lErr != nil {
 		log.WithError(lErr).Error("unable to render ui template")
 		pRes.Write([]byte(lErr.Error()))
 	}
 }
 
+func (self *UiHandler) HandlerRequest(pRes http.ResponseWriter, pReq *http.Request) {
+	self.render(pRes, "index.tpl")
+}
+
+func (self *UiHandler) HandleHistory(pRes http.ResponseWriter, pReq *http.Request) {
+	self.render(pRes, "history.tpl")
+}
+
+func (self *UiHandler) HandlePreferences(pRes http.ResponseWriter, pReq *http.Request) {
+	self.render(pRes, "preferences.tpl")
+}
+
 func mkSlice(pArgs ...interface{}) []interface{} {
 	return pArgs
 }